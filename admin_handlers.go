@@ -13,3 +13,24 @@ func PutUser(w http.ResponseWriter, r *http.Request) {
 	adm := &ap.FedAdminProtocol{}
 	adm.Handle(r.Context(), w, r)
 }
+
+func PutDeleteDomainBlock(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PutDeleteDomainBlock(%v)", r.URL)
+
+	adm := &ap.FedAdminProtocol{}
+	adm.Handle(r.Context(), w, r)
+}
+
+func DeleteUserTOTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DeleteUserTOTP(%v)", r.URL)
+
+	adm := &ap.FedAdminProtocol{}
+	adm.Handle(r.Context(), w, r)
+}
+
+func GetDeleteLockouts(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetDeleteLockouts(%v)", r.URL)
+
+	adm := &ap.FedAdminProtocol{}
+	adm.Handle(r.Context(), w, r)
+}
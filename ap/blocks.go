@@ -0,0 +1,218 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"log"
+	"net/url"
+)
+
+// The key under which we remember the inbox a federated request was
+// POSTed to.
+type inboxKey struct{}
+
+// Remember the target inbox of the federated request in c. Blocked
+// only gets a context, but needs to know whose inbox is targeted.
+func withInbox(c context.Context, inbox *url.URL) context.Context {
+	return context.WithValue(c, inboxKey{}, inbox)
+}
+
+// Return the owner of the inbox the federated request in c is
+// targeting. Returns nil if there is no such user.
+func inboxOwner(c context.Context) *db.FedUser {
+	inbox, ok := c.Value(inboxKey{}).(*url.URL)
+	if !ok {
+		return nil
+	}
+
+	username, err := fediri.IRI{inbox}.InboxOwner()
+	if err != nil {
+		return nil
+	}
+
+	user, err := fedcontext.From(c).Storage.RetrieveUser(username)
+	if err != nil {
+		log.Printf("no owner for inbox=%v: %v", inbox, err)
+		return nil
+	}
+
+	return user
+}
+
+// Return whether any of actors is blocked, either on the whole
+// instance or by the owner of the inbox targeted by the request
+// in c.
+func isBlocked(c context.Context, actors []*url.URL) bool {
+	bl := fedcontext.LoadBlocklist(fedcontext.From(c).Storage)
+	owner := inboxOwner(c)
+
+	for _, actor := range actors {
+		if bl.Rejects(actor) {
+			return true
+		}
+
+		if owner != nil && owner.HasBlocked(actor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the recipients we are still willing to forward activity to.
+// Recipients on rejected domains are dropped, as are collections of
+// local users that blocked one of the actors of activity.
+func unblockedRecipients(c context.Context, recipients []*url.URL, activity pub.Activity) (filtered []*url.URL) {
+	storage := fedcontext.From(c).Storage
+	bl := fedcontext.LoadBlocklist(storage)
+	actors := prop.IRIs(activity, "actor")
+
+	for _, recipient := range recipients {
+		if bl.Rejects(recipient) {
+			continue
+		}
+
+		if owner := collectionOwner(storage, recipient); owner != nil && blocksAny(owner, actors) {
+			continue
+		}
+
+		filtered = append(filtered, recipient)
+	}
+
+	return filtered
+}
+
+// Return the local user that owns the collection at iri. Returns nil
+// if iri does not point to a local collection.
+func collectionOwner(storage db.Storer, iri *url.URL) *db.FedUser {
+	if !(fediri.IRI{iri}).IsLocal() {
+		return nil
+	}
+
+	username, err := fediri.IRI{iri}.Owner()
+	if err != nil {
+		return nil
+	}
+
+	user, err := storage.RetrieveUser(username)
+	if err != nil {
+		return nil
+	}
+
+	return user
+}
+
+// Return whether user blocked any of actors.
+func blocksAny(user *db.FedUser, actors []*url.URL) bool {
+	for _, actor := range actors {
+		if user.HasBlocked(actor) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add the actors blocked by block to the blocked actors of the logged
+// in user. As blocking ends all relationships, the blocked actors are
+// also removed from following and followers.
+func addToBlocked(c context.Context, block vocab.ActivityStreamsBlock) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	for _, iri := range prop.IRIs(block, "object") {
+		if !util.UrlIn(iri, user.BlockedActors) {
+			user.BlockedActors = append(user.BlockedActors, iri)
+		}
+
+		user.Following = util.UrlRemove(iri, user.Following)
+		user.PendingFollowing = util.UrlRemove(iri, user.PendingFollowing)
+		user.Followers = util.UrlRemove(iri, user.Followers)
+	}
+
+	return storage.StoreUser(user)
+}
+
+// For all Block activities undone by undo, remove the blocked actors
+// from the blocked actors of the logged in user.
+func removeFromBlocked(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := objects(c, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		if _, ok := block.(vocab.ActivityStreamsBlock); !ok {
+			continue
+		}
+
+		user.BlockedActors = util.UrlsRemove(prop.IRIs(block, "object"), user.BlockedActors)
+	}
+
+	return storage.StoreUser(user)
+}
+
+// If the actor of create is on a domain we reject media from,
+// remove all attachments from the created objects.
+func stripMedia(c context.Context, create vocab.ActivityStreamsCreate) error {
+	type attacher interface {
+		GetActivityStreamsAttachment() vocab.ActivityStreamsAttachmentProperty
+		SetActivityStreamsAttachment(vocab.ActivityStreamsAttachmentProperty)
+	}
+
+	storage := fedcontext.From(c).Storage
+	bl := fedcontext.LoadBlocklist(storage)
+
+	if !anyIRI(prop.IRIs(create, "actor"), bl.RejectsMedia) {
+		return nil
+	}
+
+	created, err := objects(c, create)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range created {
+		a, ok := obj.(attacher)
+		if !ok || a.GetActivityStreamsAttachment() == nil {
+			continue
+		}
+
+		a.SetActivityStreamsAttachment(nil)
+
+		if err := storage.StoreObject(prop.Id(obj), obj); err != nil {
+			return errors.Wrapf(err, "cannot strip media from object=%v", prop.Id(obj))
+		}
+	}
+
+	return nil
+}
+
+// Return whether predicate holds for any of iris.
+func anyIRI(iris []*url.URL, predicate func(*url.URL) bool) bool {
+	for _, iri := range iris {
+		if predicate(iri) {
+			return true
+		}
+	}
+
+	return false
+}
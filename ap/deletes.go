@@ -0,0 +1,405 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Return a Tombstone that replaces the object at id. If old is not
+// nil, its type is recorded as the former type of the Tombstone.
+func tombstone(id *url.URL, old vocab.Type) vocab.ActivityStreamsTombstone {
+	t := streams.NewActivityStreamsTombstone()
+	prop.SetIdOn(t, id)
+
+	if old != nil {
+		former := streams.NewActivityStreamsFormerTypeProperty()
+		former.AppendXMLSchemaString(prop.Type(old))
+		t.SetActivityStreamsFormerType(former)
+	}
+
+	deleted := streams.NewActivityStreamsDeletedProperty()
+	deleted.Set(time.Now())
+	t.SetActivityStreamsDeleted(deleted)
+
+	return t
+}
+
+// Ensure that an incoming Update or Delete only touches objects that
+// live on the same host as the actor that sent it. Otherwise anyone
+// could edit or delete everybody else's posts. Other activities are
+// always accepted.
+func sameOrigin(activity pub.Activity) error {
+	switch activity.(type) {
+	case vocab.ActivityStreamsUpdate, vocab.ActivityStreamsDelete:
+	default:
+		return nil
+	}
+
+	actors := prop.IRIs(activity, "actor")
+	if len(actors) == 0 {
+		return errors.NewWith(http.StatusBadRequest, "activity has no actor")
+	}
+
+	for _, actor := range actors {
+		for _, obj := range prop.IRIs(activity, "object") {
+			if obj.Host != actor.Host {
+				return errors.NewfWith(http.StatusForbidden, "actor=%v may not modify object=%v", actor, obj)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove all activities that are about objects deleted by del from
+// the inboxes and outboxes of all users on this instance. This way
+// deleted objects stop showing up in streams.
+func removeDeleted(c context.Context, del vocab.ActivityStreamsDelete) error {
+	storage := fedcontext.From(c).Storage
+
+	deleted := prop.IRIs(del, "object")
+
+	users, err := storage.RetrieveUsers()
+	if err != nil {
+		return errors.Wrap(err, "cannot list users")
+	}
+
+	for _, user := range users {
+		changed := false
+
+		for _, box := range boxes(user) {
+			var kept []*url.URL
+
+			for _, iri := range *box {
+				if !refersTo(storage, iri, deleted) {
+					kept = append(kept, iri)
+				}
+			}
+
+			changed = changed || len(kept) != len(*box)
+			*box = kept
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := storage.StoreUser(user); err != nil {
+			return errors.Wrapf(err, "cannot update boxes of user=%v", user.Name)
+		}
+	}
+
+	return nil
+}
+
+// If del deletes actors, that is the deleted object is the actor
+// itself, remove everything we know about them. Their activities
+// are removed from all inboxes and storage and they are removed
+// from all follow relationships.
+func purgeDeletedActors(c context.Context, del vocab.ActivityStreamsDelete) error {
+	storage := fedcontext.From(c).Storage
+
+	var gone []*url.URL
+
+	for _, actor := range prop.IRIs(del, "actor") {
+		if util.UrlIn(actor, prop.IRIs(del, "object")) {
+			gone = append(gone, actor)
+		}
+	}
+
+	if len(gone) == 0 {
+		return nil
+	}
+
+	users, err := storage.RetrieveUsers()
+	if err != nil {
+		return errors.Wrap(err, "cannot list users")
+	}
+
+	for _, user := range users {
+		user.Following = util.UrlsRemove(gone, user.Following)
+		user.PendingFollowing = util.UrlsRemove(gone, user.PendingFollowing)
+		user.Followers = util.UrlsRemove(gone, user.Followers)
+
+		var kept []*url.URL
+
+		for _, iri := range user.Inbox {
+			if activity, err := storage.RetrieveObject(iri); err != nil {
+				kept = append(kept, iri)
+			} else if !authoredByAny(activity, gone) {
+				kept = append(kept, iri)
+			} else if err := purgeActivity(storage, activity); err != nil {
+				return err
+			}
+		}
+
+		user.Inbox = kept
+
+		if err := storage.StoreUser(user); err != nil {
+			return errors.Wrapf(err, "cannot update user=%v", user.Name)
+		}
+	}
+
+	return nil
+}
+
+// For all objects updated by update, replace copies of these objects
+// embedded in the activities in the inboxes and outboxes of users on
+// this instance. Otherwise streams would keep showing the old version.
+func refreshEmbedded(c context.Context, update vocab.ActivityStreamsUpdate) error {
+	storage := fedcontext.From(c).Storage
+
+	updated, err := objects(c, update)
+	if err != nil {
+		return err
+	}
+
+	users, err := storage.RetrieveUsers()
+	if err != nil {
+		return errors.Wrap(err, "cannot list users")
+	}
+
+	// activities might be in the inbox of more than one user; we
+	// only want to look at each of them once
+
+	seen := make(map[string]bool)
+
+	for _, user := range users {
+		for _, box := range boxes(user) {
+			for _, iri := range *box {
+				if seen[iri.String()] {
+					continue
+				}
+
+				seen[iri.String()] = true
+
+				activity, err := storage.RetrieveObject(iri)
+				if err != nil {
+					continue
+				}
+
+				if !replaceEmbedded(activity, updated) {
+					continue
+				}
+
+				if err := storage.StoreObject(iri, activity); err != nil {
+					return errors.Wrapf(err, "cannot update activity=%v", iri)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Ensure that an Update or Delete posted to the outbox at outbox only
+// touches objects authored by the owner of that outbox. The owner may
+// also update their own actor. Other activities are always accepted.
+func mustOwn(c context.Context, outbox *url.URL, activity vocab.Type) error {
+	switch activity.(type) {
+	case vocab.ActivityStreamsUpdate, vocab.ActivityStreamsDelete:
+	default:
+		return nil
+	}
+
+	username, err := fediri.IRI{outbox}.OutboxOwner()
+	if err != nil {
+		return errors.WrapWith(http.StatusInternalServerError, err, "not an outbox")
+	}
+
+	owner := fediri.ActorIRI(username).URL()
+	storage := fedcontext.From(c).Storage
+
+	_, isUpdate := activity.(vocab.ActivityStreamsUpdate)
+
+	for _, iri := range prop.IRIs(activity, "object") {
+		if isUpdate && util.UrlEq(iri, owner) {
+			continue
+		}
+
+		obj, err := storage.RetrieveObject(iri)
+		if err != nil {
+			return errors.Wrapf(err, "cannot look up object=%v", iri)
+		}
+
+		if !util.UrlIn(owner, prop.IRIs(obj, "attributedTo", "actor")) {
+			return errors.NewfWith(http.StatusForbidden, "object=%v not owned by user=%v", iri, username)
+		}
+	}
+
+	return nil
+}
+
+// Return the boxes of user that contain activities about objects,
+// that is the inbox and the outbox.
+func boxes(user *db.FedUser) []*[]*url.URL {
+	return []*[]*url.URL{&user.Inbox, &user.Outbox}
+}
+
+// Return whether the activity at iri is one of the IRIs in deleted
+// or is about one of the objects in deleted.
+func refersTo(storage db.Storer, iri *url.URL, deleted []*url.URL) bool {
+	if util.UrlIn(iri, deleted) {
+		return true
+	}
+
+	activity, err := storage.RetrieveObject(iri)
+	if err != nil {
+		return false
+	}
+
+	for _, obj := range prop.IRIs(activity, "object") {
+		if util.UrlIn(obj, deleted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether activity or any object embedded in it was authored
+// by one of the actors in actors.
+func authoredByAny(activity vocab.Type, actors []*url.URL) bool {
+	for _, author := range prop.IRIs(activity, "actor", "attributedTo") {
+		if util.UrlIn(author, actors) {
+			return true
+		}
+	}
+
+	for _, obj := range embedded(activity) {
+		for _, author := range prop.IRIs(obj, "attributedTo") {
+			if util.UrlIn(author, actors) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Remove activity and all objects embedded in it from storage.
+func purgeActivity(storage db.Storer, activity vocab.Type) error {
+	for _, obj := range embedded(activity) {
+		if err := deleteIfExists(storage, prop.Id(obj)); err != nil {
+			return err
+		}
+	}
+
+	return deleteIfExists(storage, prop.Id(activity))
+}
+
+// Delete the object at iri from storage. Objects that are not in
+// storage are ignored.
+func deleteIfExists(storage db.Storer, iri *url.URL) error {
+	if iri == nil {
+		return nil
+	}
+
+	err := storage.DeleteObject(iri)
+	if status, ok := errors.Status(err); ok && status == http.StatusNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "cannot delete object=%v", iri)
+	}
+
+	return nil
+}
+
+// Return the objects embedded in the object property of activity.
+// Objects only referenced by IRI are not included.
+func embedded(activity vocab.Type) (vs []vocab.Type) {
+	type objecter interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}
+
+	o, ok := activity.(objecter)
+	if !ok || o.GetActivityStreamsObject() == nil {
+		return nil
+	}
+
+	property := o.GetActivityStreamsObject()
+
+	for it := property.Begin(); it != property.End(); it = it.Next() {
+		if obj := it.GetType(); obj != nil && obj.GetJSONLDId() != nil {
+			vs = append(vs, obj)
+		}
+	}
+
+	return vs
+}
+
+// In the object property of activity, replace all embedded objects
+// that have a newer version in updated with that newer version.
+// Returns whether anything was replaced.
+func replaceEmbedded(activity vocab.Type, updated []vocab.Type) (replaced bool) {
+	type objecter interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+		SetActivityStreamsObject(vocab.ActivityStreamsObjectProperty)
+	}
+
+	o, ok := activity.(objecter)
+	if !ok || o.GetActivityStreamsObject() == nil {
+		return false
+	}
+
+	property := o.GetActivityStreamsObject()
+	fresh := streams.NewActivityStreamsObjectProperty()
+
+	for it := property.Begin(); it != property.End(); it = it.Next() {
+		obj := it.GetType()
+
+		if obj == nil {
+			if it.IsIRI() {
+				fresh.AppendIRI(it.GetIRI())
+			}
+
+			continue
+		}
+
+		if obj.GetJSONLDId() != nil {
+			if newer := findById(prop.Id(obj), updated); newer != nil {
+				obj = newer
+				replaced = true
+			}
+		}
+
+		if err := fresh.AppendType(obj); err != nil {
+			log.Printf("cannot embed object=%v: %v", prop.Id(obj), err)
+			return false
+		}
+	}
+
+	if replaced {
+		o.SetActivityStreamsObject(fresh)
+	}
+
+	return replaced
+}
+
+// Return the object from vs with the given id or nil if there is
+// no such object.
+func findById(id *url.URL, vs []vocab.Type) vocab.Type {
+	if id == nil {
+		return nil
+	}
+
+	for _, v := range vs {
+		if util.UrlEq(id, prop.Id(v)) {
+			return v
+		}
+	}
+
+	return nil
+}
@@ -2,9 +2,13 @@ package ap
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/kissen/fed/config"
 	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fedcontext"
 	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/throttle"
 	"log"
 	"net/http"
 	"sync"
@@ -19,8 +23,40 @@ type FedAdminProtocol struct {
 	lock sync.Mutex
 }
 
+// Return whether the request may run administrator tasks. Clients
+// need to be logged in as one of the configured administrators with
+// a token that carries the admin scopes. As long as no administrators
+// are configured, the admin API is open s.t. a local admin tool can
+// create the first users.
 func (f *FedAdminProtocol) AuthenticateAdmin(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authed bool, err error) {
 	log.Println("AuthenticateAdmin()")
+
+	if len(config.Get().Admins) == 0 {
+		log.Println("no admins configured, admin API is open")
+		return c, true, nil
+	}
+
+	fc := fedcontext.From(c)
+
+	if fc.Client == nil {
+		return c, false, nil
+	}
+
+	username, ok := fedcontext.LocalUsername(fc.Client)
+	if !ok || !config.Get().IsAdmin(username) {
+		return c, false, nil
+	}
+
+	scope := "admin:write"
+
+	if r.Method == "GET" {
+		scope = "admin:read"
+	}
+
+	if !fc.Scope.Allows(scope) {
+		return c, false, nil
+	}
+
 	return c, true, nil
 }
 
@@ -35,6 +71,58 @@ func (f *FedAdminProtocol) CreateUser(c context.Context, username string) (*db.F
 	return fedcontext.From(c).Storage.RetrieveUser(username)
 }
 
+// Block domain on the whole instance with given severity. Existing
+// blocks of domain are replaced.
+func (f *FedAdminProtocol) BlockDomain(c context.Context, domain string, severity db.Severity) error {
+	log.Printf("BlockDomain(%v, %v)", domain, severity)
+
+	block := db.NewFedDomainBlock(domain, severity)
+	return fedcontext.From(c).Storage.StoreDomainBlock(block)
+}
+
+// Remove the instance-wide block of domain. Blocks from the
+// configuration file cannot be removed this way.
+func (f *FedAdminProtocol) UnblockDomain(c context.Context, domain string) error {
+	log.Printf("UnblockDomain(%v)", domain)
+	return fedcontext.From(c).Storage.DeleteDomainBlock(domain)
+}
+
+// Remove the second factor of the user with given username, e.g.
+// because they lost their device and their recovery codes. Sessions
+// of the user are left alone.
+func (f *FedAdminProtocol) ResetTOTP(c context.Context, username string) error {
+	log.Printf("ResetTOTP(%v)", username)
+
+	storage := fedcontext.From(c).Storage
+
+	user, err := storage.RetrieveUser(username)
+	if err != nil {
+		return err
+	}
+
+	user.TOTP = nil
+	return storage.StoreUser(user)
+}
+
+// Return the keys that had failed logins recently together with
+// their lockouts.
+func (f *FedAdminProtocol) Lockouts(c context.Context) []throttle.Entry {
+	log.Println("Lockouts()")
+	return throttle.Logins().Entries()
+}
+
+// Forget the failed logins for key, e.g. "user:alice" or
+// "ip:192.0.2.1", lifting a lockout if there is one.
+func (f *FedAdminProtocol) LiftLockout(c context.Context, key string) error {
+	log.Printf("LiftLockout(%v)", key)
+
+	if !throttle.Logins().Reset(key) {
+		return errors.NewfWith(http.StatusNotFound, "no failed logins for key=%v", key)
+	}
+
+	return nil
+}
+
 func (f *FedAdminProtocol) Handle(c context.Context, w http.ResponseWriter, r *http.Request) {
 	log.Printf("Handle(%v)", r.URL)
 
@@ -43,11 +131,12 @@ func (f *FedAdminProtocol) Handle(c context.Context, w http.ResponseWriter, r *h
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	// so far we only support PUT; this works nicely because Activity Pub only
-	// uses GET and POST
+	// we mostly use PUT and DELETE; this works nicely because
+	// Activity Pub only uses GET and POST; the few GET routes use
+	// reserved names
 
-	if r.Method != "PUT" {
-		http.Error(w, "method is not PUT", http.StatusMethodNotAllowed)
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		http.Error(w, "method is neither GET nor PUT nor DELETE", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -66,7 +155,27 @@ func (f *FedAdminProtocol) Handle(c context.Context, w http.ResponseWriter, r *h
 
 	iri := fediri.IRI{Target: r.URL}
 
-	if username, err := iri.Actor(); err == nil {
+	if iri.IsLockouts() && r.Method == "GET" {
+		f.handleLockouts(c, w, r)
+		return
+	}
+
+	if key, err := iri.Lockout(); err == nil && r.Method == "DELETE" {
+		if err := f.LiftLockout(c, key); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "Deleted", http.StatusOK)
+		}
+
+		return
+	}
+
+	if domain, err := iri.BlockedDomain(); err == nil {
+		f.handleDomainBlock(c, w, r, domain)
+		return
+	}
+
+	if username, err := iri.Actor(); err == nil && r.Method == "PUT" {
 		if _, err := f.CreateUser(c, username); err != nil {
 			// creating user failed
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -79,7 +188,56 @@ func (f *FedAdminProtocol) Handle(c context.Context, w http.ResponseWriter, r *h
 		return
 	}
 
+	if username, err := iri.TOTPOwner(); err == nil && r.Method == "DELETE" {
+		if err := f.ResetTOTP(c, username); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			http.Error(w, "Deleted", http.StatusOK)
+		}
+
+		return
+	}
+
 	// don't know what to do
 
 	http.Error(w, "Bad Admin Request", http.StatusBadRequest)
 }
+
+// Handle a PUT or DELETE to the block of domain. PUT accepts the
+// severity as query parameter ?severity=.
+func (f *FedAdminProtocol) handleDomainBlock(c context.Context, w http.ResponseWriter, r *http.Request, domain string) {
+	if r.Method == "DELETE" {
+		if err := f.UnblockDomain(c, domain); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			http.Error(w, "Deleted", http.StatusOK)
+		}
+
+		return
+	}
+
+	severity, err := db.ParseSeverity(r.URL.Query().Get("severity"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := f.BlockDomain(c, domain, severity); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		http.Error(w, "Created", http.StatusCreated)
+	}
+}
+
+// Handle a GET of the list of failed logins. Replies with the
+// entries as JSON.
+func (f *FedAdminProtocol) handleLockouts(c context.Context, w http.ResponseWriter, r *http.Request) {
+	bytes, err := json.Marshal(f.Lockouts(c))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
 	"log"
 	"net/http"
 	"net/url"
@@ -31,8 +36,29 @@ type FedCommonBehavior struct{}
 // Finally, if the authentication and authorization succeeds, then
 // authenticated must be true and error nil. The request will continue
 // to be processed.
+//
+// Only the owner may read an inbox. Inboxes contain direct messages
+// and other objects not meant for the public.
 func (f *FedCommonBehavior) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authed bool, err error) {
 	log.Println("AuthenticateGetInbox()")
+
+	username, err := fediri.IRI{r.URL}.InboxOwner()
+	if err != nil {
+		// this should not happen; if we are authenticating an
+		// inbox, why isn't the IRI an inbox IRI?
+		return c, false, errors.WrapWith(http.StatusInternalServerError, err, "not an inbox")
+	}
+
+	requester := Requester(c)
+
+	if requester == nil {
+		return c, false, errors.NewWith(http.StatusUnauthorized, "authentication required")
+	}
+
+	if !util.UrlEq(requester, fediri.ActorIRI(username).URL()) {
+		return c, false, errors.NewWith(http.StatusForbidden, "inbox belongs to another actor")
+	}
+
 	return c, true, nil
 }
 
@@ -55,6 +81,9 @@ func (f *FedCommonBehavior) AuthenticateGetInbox(c context.Context, w http.Respo
 // Finally, if the authentication and authorization succeeds, then
 // authenticated must be true and error nil. The request will continue
 // to be processed.
+//
+// Everyone may read an outbox, but GetOutbox only returns the objects
+// the requester is allowed to see.
 func (f *FedCommonBehavior) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authed bool, err error) {
 	log.Println("AuthenticateGetOutbox()")
 	return c, true, nil
@@ -70,7 +99,29 @@ func (f *FedCommonBehavior) AuthenticateGetOutbox(c context.Context, w http.Resp
 // API is enabled.
 func (f *FedCommonBehavior) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
 	log.Println("GetOutbox()")
-	return pageFor(c, r.URL, "Outbox")
+
+	storage := fedcontext.From(c).Storage
+	iri := fediri.IRI{r.URL}
+
+	user, err := retrieveOwner(&iri, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// the owner gets to see everything; everyone else only
+	// what was addressed to them
+
+	requester := Requester(c)
+	outbox := user.Outbox
+
+	if !util.UrlEq(requester, fediri.ActorIRI(user.Name).URL()) {
+		outbox = visibleIRIs(c, outbox, requester)
+	}
+
+	page := prop.ToPage(outbox)
+	prop.SetIdOn(page, fediri.OutboxIRI(user.Name).URL())
+
+	return page, nil
 }
 
 // NewTransport returns a new Transport on behalf of a specific actor.
@@ -210,7 +210,7 @@ func (f *FedDatabase) Get(c context.Context, addr *url.URL) (value vocab.Type, e
 	}
 
 	if _, err := iri.FollowersOwner(); err == nil {
-		return f.Following(c, iri.URL())
+		return f.Followers(c, iri.URL())
 	}
 
 	if _, err := iri.LikedOwner(); err == nil {
@@ -272,20 +272,16 @@ func (f *FedDatabase) Update(c context.Context, asType vocab.Type) error {
 		return errors.NewWith(http.StatusNotImplemented, "update of owner not supported")
 	}
 
-	if _, err := iri.FollowingOwner(); err == nil {
-		return errors.NewWith(http.StatusNotImplemented, "update of following not supported")
+	if username, err := iri.FollowingOwner(); err == nil {
+		return f.updateCollection(c, username, "Following", asType)
 	}
 
-	if _, err := iri.FollowersOwner(); err == nil {
-		return errors.NewWith(http.StatusNotImplemented, "update of followers not supported")
+	if username, err := iri.FollowersOwner(); err == nil {
+		return f.updateCollection(c, username, "Followers", asType)
 	}
 
-	if _, err := iri.LikedOwner(); err == nil {
-		if liked, ok := asType.(vocab.ActivityStreamsCollection); !ok {
-			return errors.NewfWith(http.StatusInternalServerError, "bad runtime type %T for liked collection", asType)
-		} else {
-			return f.updateLiked(c, iri, liked)
-		}
+	if username, err := iri.LikedOwner(); err == nil {
+		return f.updateCollection(c, username, "Liked", asType)
 	}
 
 	// try out actors
@@ -300,7 +296,7 @@ func (f *FedDatabase) Update(c context.Context, asType vocab.Type) error {
 
 	// try storage as a last resort
 
-	return fedcontext.From(c).Storage.StoreObject(id, asType)
+	return f.updateObject(c, id, asType)
 }
 
 // Delete removes the entry with the given id.
@@ -308,11 +304,27 @@ func (f *FedDatabase) Update(c context.Context, asType vocab.Type) error {
 // Delete is only called for federated objects. Deletes from the Social
 // Protocol instead call Update to create a Tombstone.
 //
+// We do the same here and replace the object with a Tombstone. This
+// way we remember that the object is gone and do not fetch it again.
+//
 // The library makes this call only after acquiring a lock first.
 func (f *FedDatabase) Delete(c context.Context, id *url.URL) error {
 	log.Printf("Delete(%v)", id)
 
-	return fedcontext.From(c).Storage.DeleteObject(id)
+	storage := fedcontext.From(c).Storage
+
+	old, err := storage.RetrieveObject(id)
+	if status, ok := errors.Status(err); ok && status == http.StatusNotFound {
+		return storage.StoreObject(id, tombstone(id, nil))
+	} else if err != nil {
+		return err
+	}
+
+	if err := storage.StoreRevision(id, old); err != nil {
+		return errors.Wrapf(err, "cannot keep revision of id=%v", id)
+	}
+
+	return storage.StoreObject(id, tombstone(id, old))
 }
 
 // GetOutbox returns the first ordered collection page of the outbox
@@ -412,6 +424,14 @@ func (f *FedDatabase) getActor(c context.Context, actorIRI *url.URL) (actor voca
 	name.AppendXMLSchemaString(user.Name)
 	actor.SetActivityStreamsName(name)
 
+	preferredUsername := streams.NewActivityStreamsPreferredUsernameProperty()
+	preferredUsername.SetXMLSchemaString(user.Name)
+	actor.SetActivityStreamsPreferredUsername(preferredUsername)
+
+	profileURL := streams.NewActivityStreamsUrlProperty()
+	profileURL.AppendIRI(fediri.ActorIRI(user.Name).URL())
+	actor.SetActivityStreamsUrl(profileURL)
+
 	inbox := streams.NewActivityStreamsInboxProperty()
 	inbox.SetIRI(fediri.InboxIRI(user.Name).URL())
 	actor.SetActivityStreamsInbox(inbox)
@@ -432,7 +452,40 @@ func (f *FedDatabase) getActor(c context.Context, actorIRI *url.URL) (actor voca
 	liked.SetIRI(fediri.LikedIRI(user.Name).URL())
 	actor.SetActivityStreamsLiked(liked)
 
-	return actor, nil
+	return withExtras(actor, user)
+}
+
+// Add the profile of user (which overrides the default name) and the
+// endpoints property that advertises where user can upload files to
+// actor.
+//
+// go-fed has no typed support for endpoints and profile fields, which
+// is why we go through the serialized form; go-fed keeps unknown
+// properties around when serializing.
+func withExtras(actor vocab.ActivityStreamsPerson, user *db.FedUser) (vocab.ActivityStreamsPerson, error) {
+	mappings, err := streams.Serialize(actor)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize actor")
+	}
+
+	for key, value := range fedcontext.ProfileMappings(&user.Profile) {
+		mappings[key] = value
+	}
+
+	mappings["endpoints"] = map[string]interface{}{
+		"uploadMedia": fediri.UploadMediaIRI(user.Name).String(),
+	}
+
+	obj, err := streams.ToType(context.Background(), mappings)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot deserialize actor")
+	}
+
+	if person, ok := obj.(vocab.ActivityStreamsPerson); !ok {
+		return nil, errors.NewfWith(http.StatusInternalServerError, "bad runtime type %T for actor", obj)
+	} else {
+		return person, nil
+	}
 }
 
 func (f *FedDatabase) getStorage(c context.Context, addr *url.URL) (vocab.Type, error) {
@@ -448,14 +501,39 @@ func (f *FedDatabase) getStorage(c context.Context, addr *url.URL) (vocab.Type,
 	}
 }
 
-func (f *FedDatabase) updateLiked(c context.Context, actoriri fediri.IRI, liked vocab.ActivityStreamsCollection) error {
+// Overwrite the object at id with obj. If there already is a version
+// of the object in storage, that old version is kept as a revision.
+func (f *FedDatabase) updateObject(c context.Context, id *url.URL, obj vocab.Type) error {
 	storage := fedcontext.From(c).Storage
 
-	username, err := actoriri.LikedOwner()
-	if err != nil {
+	old, err := storage.RetrieveObject(id)
+	if status, ok := errors.Status(err); ok && status == http.StatusNotFound {
+		return storage.StoreObject(id, obj)
+	} else if err != nil {
 		return err
 	}
 
+	if err := storage.StoreRevision(id, old); err != nil {
+		return errors.Wrapf(err, "cannot keep revision of id=%v", id)
+	}
+
+	return storage.StoreObject(id, obj)
+}
+
+// Overwrite field (e.g. "Following") of the user with given username
+// with the contents of collection.
+func (f *FedDatabase) updateCollection(c context.Context, username string, field string, collection vocab.Type) error {
+	storage := fedcontext.From(c).Storage
+
+	if _, ok := collection.(vocab.ActivityStreamsCollection); !ok {
+		return errors.NewfWith(http.StatusInternalServerError, "bad runtime type %T for %v collection", collection, field)
+	}
+
+	iris, err := f.iris(collection)
+	if err != nil {
+		return errors.Wrapf(err, "bad %v collection", field)
+	}
+
 	tx, err := storage.Begin()
 	if err != nil {
 		return err
@@ -468,9 +546,16 @@ func (f *FedDatabase) updateLiked(c context.Context, actoriri fediri.IRI, liked
 		return err
 	}
 
-	user.Liked, err = f.iris(liked)
-	if err != nil {
-		return errors.Wrap(err, "bad liked collection")
+	switch field {
+	case "Following":
+		user.Following = iris
+		user.PendingFollowing = util.UrlsRemove(iris, user.PendingFollowing)
+	case "Followers":
+		user.Followers = iris
+	case "Liked":
+		user.Liked = iris
+	default:
+		log.Fatalf("bad field=%v", field)
 	}
 
 	if err = tx.StoreUser(user); err != nil {
@@ -480,8 +565,9 @@ func (f *FedDatabase) updateLiked(c context.Context, actoriri fediri.IRI, liked
 	return tx.Commit()
 }
 
-// Update actor which should represent a user on our instance. In particular, update
-// the liked, follows (and so on) collections.
+// Update actor which should represent a user on our instance. Only
+// the profile is taken from actor; the collections of the user are
+// updated separately with their own IRIs.
 func (f *FedDatabase) updatePerson(c context.Context, actoriri fediri.IRI, actor vocab.ActivityStreamsPerson) error {
 	storage := fedcontext.From(c).Storage
 
@@ -492,6 +578,18 @@ func (f *FedDatabase) updatePerson(c context.Context, actoriri fediri.IRI, actor
 		return err
 	}
 
+	profile, err := fedcontext.ParseProfile(actor)
+	if err != nil {
+		return errors.WrapWith(http.StatusBadRequest, err, "bad profile")
+	}
+
+	// actors without a display name show the username; do not
+	// store that as display name
+
+	if profile.DisplayName == username {
+		profile.DisplayName = ""
+	}
+
 	tx, err := storage.Begin()
 	if err != nil {
 		return err
@@ -504,29 +602,23 @@ func (f *FedDatabase) updatePerson(c context.Context, actoriri fediri.IRI, actor
 		return err
 	}
 
-	// for each supported collection, fetch the iris and update
-	// the user meta data accordingly
+	profile.KeepVerified(&user.Profile)
+	user.Profile = *profile
 
-	user.Followers, err = f.iris(actor.GetActivityStreamsFollowers)
-	if err != nil {
-		return errors.Wrap(err, "bad followers collection")
+	if err := tx.StoreUser(user); err != nil {
+		return errors.Wrap(err, "overwriting user failed")
 	}
 
-	user.Following, err = f.iris(actor.GetActivityStreamsFollowing)
-	if err != nil {
-		return errors.Wrap(err, "bad following collection")
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	user.Liked, err = f.iris(actor.GetActivityStreamsLiked)
-	if err != nil {
-		return errors.Wrap(err, "bad liked collection")
-	}
+	// fetching the linked pages might take a while; do not let
+	// the client wait for it
 
-	if err := tx.StoreUser(user); err != nil {
-		return errors.Wrap(err, "overwriting user failed")
-	}
+	go verifyFields(storage, username)
 
-	return tx.Commit()
+	return nil
 }
 
 // Ensure that all objects in collection are part of our storage. Returns a
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/config"
 	"log"
 	"net/http"
 	"net/url"
@@ -30,7 +31,12 @@ type FedFederatingProtocol struct{}
 // to PostInbox will do so when handling the error.
 func (f *FedFederatingProtocol) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
 	log.Printf("PostInboxRequestBodyHook(%v)", r.URL)
-	return c, nil
+
+	if err := sameOrigin(activity); err != nil {
+		return c, err
+	}
+
+	return withActivity(withInbox(c, r.URL), activity), nil
 }
 
 // AuthenticatePostInbox delegates the authentication of a POST to an
@@ -51,6 +57,13 @@ func (f *FedFederatingProtocol) PostInboxRequestBodyHook(c context.Context, r *h
 // to be processed.
 func (f *FedFederatingProtocol) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authed bool, err error) {
 	log.Printf("AuthenticatePostInbox(%v)", r.URL)
+
+	if err := signedByActor(c); err != nil {
+		log.Printf("rejecting post to inbox=%v: %v", r.URL, err)
+		http.Error(w, "Not Authorized", http.StatusUnauthorized)
+		return c, false, nil
+	}
+
 	return c, true, nil
 }
 
@@ -70,7 +83,7 @@ func (f *FedFederatingProtocol) AuthenticatePostInbox(c context.Context, w http.
 // to be processed.
 func (f *FedFederatingProtocol) Blocked(c context.Context, actorIRIs []*url.URL) (blocked bool, err error) {
 	log.Printf("Blocked(%v)", actorIRIs)
-	return false, nil
+	return isBlocked(c, actorIRIs), nil
 }
 
 // Callbacks returns the application logic that handles ActivityStreams
@@ -102,9 +115,14 @@ func (f *FedFederatingProtocol) Callbacks(c context.Context) (wrapped pub.Federa
 	// 'object' property is created in the database.
 	//
 	// Create calls Create for each object in the federated Activity.
-	wrapped.Create = func(context.Context, vocab.ActivityStreamsCreate) error {
+	wrapped.Create = func(c context.Context, create vocab.ActivityStreamsCreate) error {
 		log.Println("Create()")
-		return nil
+
+		if err := stripMedia(c, create); err != nil {
+			return err
+		}
+
+		return addToReplies(c, create)
 	}
 
 	// Update handles additional side effects for the Update ActivityStreams
@@ -115,18 +133,23 @@ func (f *FedFederatingProtocol) Callbacks(c context.Context) (wrapped pub.Federa
 	//
 	// Update calls Update on the federated entry from the database, with a
 	// new value.
-	wrapped.Update = func(context.Context, vocab.ActivityStreamsUpdate) error {
+	wrapped.Update = func(c context.Context, update vocab.ActivityStreamsUpdate) error {
 		log.Println("Update()")
-		return nil
+		return refreshEmbedded(c, update)
 	}
 
 	// Delete handles additional side effects for the Delete ActivityStreams
 	// type, specific to the application using go-fed.
 	//
 	// Delete removes the federated entry from the database.
-	wrapped.Delete = func(context.Context, vocab.ActivityStreamsDelete) error {
+	wrapped.Delete = func(c context.Context, del vocab.ActivityStreamsDelete) error {
 		log.Println("Delete()")
-		return nil
+
+		if err := removeDeleted(c, del); err != nil {
+			return err
+		}
+
+		return purgeDeletedActors(c, del)
 	}
 
 	// Follow handles additional side effects for the Follow ActivityStreams
@@ -151,9 +174,9 @@ func (f *FedFederatingProtocol) Callbacks(c context.Context) (wrapped pub.Federa
 	// 'following' collection.
 	//
 	// Otherwise, no side effects are done by go-fed.
-	wrapped.Accept = func(context.Context, vocab.ActivityStreamsAccept) error {
+	wrapped.Accept = func(c context.Context, accept vocab.ActivityStreamsAccept) error {
 		log.Println("Accept()")
-		return nil
+		return removeFromPendingFollowing(c, accept)
 	}
 
 	// Reject handles additional side effects for the Reject ActivityStreams
@@ -163,9 +186,9 @@ func (f *FedFederatingProtocol) Callbacks(c context.Context) (wrapped pub.Federa
 	// 'Reject' is in response to a 'Follow' then the client MUST NOT go
 	// forward with adding the 'actor' to the original 'actor's 'following'
 	// collection by the client application.
-	wrapped.Reject = func(context.Context, vocab.ActivityStreamsReject) error {
+	wrapped.Reject = func(c context.Context, reject vocab.ActivityStreamsReject) error {
 		log.Println("Reject()")
-		return nil
+		return removeFromPendingFollowing(c, reject)
 	}
 
 	// Add handles additional side effects for the Add ActivityStreams
@@ -220,9 +243,14 @@ func (f *FedFederatingProtocol) Callbacks(c context.Context) (wrapped pub.Federa
 	//
 	// It is expected that the application will implement the proper
 	// reversal of activities that are being undone.
-	wrapped.Undo = func(context.Context, vocab.ActivityStreamsUndo) error {
+	wrapped.Undo = func(c context.Context, undo vocab.ActivityStreamsUndo) error {
 		log.Println("Undo()")
-		return nil
+
+		if err := removeFromInboxes(c, undo); err != nil {
+			return err
+		}
+
+		return removeFromFollowers(c, undo)
 	}
 
 	// Block handles additional side effects for the Block ActivityStreams
@@ -258,7 +286,7 @@ func (f *FedFederatingProtocol) DefaultCallback(c context.Context, activity pub.
 // Zero or negative numbers indicate infinite recursion.
 func (f *FedFederatingProtocol) MaxInboxForwardingRecursionDepth(c context.Context) int {
 	log.Println("MaxInboxForwardingRecursionDepth()")
-	return -1
+	return config.Get().ForwardingDepth()
 }
 
 // MaxDeliveryRecursionDepth determines how deep to search within
@@ -280,7 +308,7 @@ func (f *FedFederatingProtocol) MaxDeliveryRecursionDepth(c context.Context) int
 // logic to be used, but the implementation must not modify it.
 func (f *FedFederatingProtocol) FilterForwarding(c context.Context, potentialRecipients []*url.URL, a pub.Activity) (filteredRecipients []*url.URL, err error) {
 	log.Println("FilterForwarding()")
-	return nil, nil
+	return forwardingRecipients(c, potentialRecipients, a), nil
 }
 
 // GetInbox returns the OrderedCollection inbox of the actor for this
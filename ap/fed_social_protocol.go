@@ -32,6 +32,15 @@ type FedSocialProtocol struct{}
 // to PostOutbox will do so when handling the error.
 func (f *FedSocialProtocol) PostOutboxRequestBodyHook(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
 	log.Println("PostOutboxRequestBodyHook()")
+
+	if err := mustHaveScope(c, data); err != nil {
+		return c, err
+	}
+
+	if err := mustOwn(c, r.URL, data); err != nil {
+		return c, err
+	}
+
 	return c, nil
 }
 
@@ -113,9 +122,9 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	// The wrapping callback copies the actor(s) to the 'attributedTo'
 	// property and copies recipients between the Create activity and all
 	// objects. It then saves the entry in the database.
-	wrapped.Create = func(context.Context, vocab.ActivityStreamsCreate) error {
+	wrapped.Create = func(c context.Context, create vocab.ActivityStreamsCreate) error {
 		log.Println("Create()")
-		return nil
+		return addToReplies(c, create)
 	}
 
 	// Update handles additional side effects for the Update ActivityStreams
@@ -124,9 +133,9 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	// The wrapping callback applies new top-level values on an object to
 	// the stored objects. Any top-level null literals will be deleted on
 	// the stored objects as well.
-	wrapped.Update = func(context.Context, vocab.ActivityStreamsUpdate) error {
+	wrapped.Update = func(c context.Context, update vocab.ActivityStreamsUpdate) error {
 		log.Println("Update()")
-		return nil
+		return refreshEmbedded(c, update)
 	}
 
 	// Delete handles additional side effects for the Delete ActivityStreams
@@ -134,9 +143,9 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	//
 	// The wrapping callback replaces the object(s) with tombstones in the
 	// database.
-	wrapped.Delete = func(context.Context, vocab.ActivityStreamsDelete) error {
+	wrapped.Delete = func(c context.Context, del vocab.ActivityStreamsDelete) error {
 		log.Println("Delete()")
-		return nil
+		return removeDeleted(c, del)
 	}
 
 	// Follow handles additional side effects for the Follow ActivityStreams
@@ -144,9 +153,9 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	//
 	// The wrapping callback only ensures the 'Follow' has at least one
 	// 'object' entry, but otherwise has no default side effect.
-	wrapped.Follow = func(context.Context, vocab.ActivityStreamsFollow) error {
+	wrapped.Follow = func(c context.Context, follow vocab.ActivityStreamsFollow) error {
 		log.Println("Follow()")
-		return nil
+		return addToPendingFollowing(c, follow)
 	}
 
 	// Add handles additional side effects for the Add ActivityStreams
@@ -193,9 +202,18 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	//
 	// It is expected that the application will implement the proper
 	// reversal of activities that are being undone.
-	wrapped.Undo = func(context.Context, vocab.ActivityStreamsUndo) error {
+	wrapped.Undo = func(c context.Context, undo vocab.ActivityStreamsUndo) error {
 		log.Println("Undo()")
-		return nil
+
+		if err := removeFromRepeated(c, undo); err != nil {
+			return err
+		}
+
+		if err := removeFromBlocked(c, undo); err != nil {
+			return err
+		}
+
+		return removeFromFollowing(c, undo)
 	}
 
 	// Block handles additional side effects for the Block ActivityStreams
@@ -208,12 +226,20 @@ func (f *FedSocialProtocol) Callbacks(c context.Context) (wrapped pub.SocialWrap
 	//
 	// Note that go-fed does not federate 'Block' activities received in the
 	// Social Protocol.
-	wrapped.Block = func(context.Context, vocab.ActivityStreamsBlock) error {
+	wrapped.Block = func(c context.Context, block vocab.ActivityStreamsBlock) error {
 		log.Println("Block()")
-		return nil
+		return addToBlocked(c, block)
+	}
+
+	// Announce is not wrapped by go-fed in the Social Protocol. We
+	// remember what was announced so we can show it in the web
+	// interface; delivery happens like with any other activity.
+	announce := func(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+		log.Println("Announce()")
+		return addToRepeated(c, announce)
 	}
 
-	return wrapped, nil, nil
+	return wrapped, []interface{}{announce}, nil
 }
 
 // DefaultCallback is called for types that go-fed can deserialize but
@@ -2,10 +2,13 @@ package ap
 
 import (
 	"context"
+	"github.com/kissen/fed/db"
 	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fedcontext"
 	"github.com/kissen/fed/fetch"
 	"github.com/kissen/fed/marshal"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
 	"log"
 	"net/url"
 )
@@ -34,17 +37,22 @@ func (f *FedTransport) Dereference(c context.Context, iri *url.URL) ([]byte, err
 // Deliver sends an ActivityStreams object.
 func (f *FedTransport) Deliver(c context.Context, b []byte, to *url.URL) (err error) {
 	log.Printf("Deliver(%v)", to)
-	return fetch.Post(b, to)
+	return f.deliver(b, to, f.blocks(c))
 }
 
 // BatchDeliver sends an ActivityStreams object to multiple recipients.
 func (f *FedTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
 	log.Printf("BatchDeliver(%v)", recipients)
 
+	// blocks are the same for all recipients, no need to look
+	// them up again and again
+
+	blocks := f.blocks(c)
+
 	// XXX: slow and wrong (quits halfway through on errors)
 
 	for _, recipent := range recipients {
-		if err := f.Deliver(c, b, recipent); err != nil {
+		if err := f.deliver(b, recipent, blocks); err != nil {
 			return err
 		}
 	}
@@ -52,6 +60,75 @@ func (f *FedTransport) BatchDeliver(c context.Context, b []byte, recipients []*u
 	return nil
 }
 
+// Send b to inbox to unless blocks says otherwise.
+func (f *FedTransport) deliver(b []byte, to *url.URL, blocks *deliveryBlocks) error {
+	if blocks.Rejects(to) {
+		log.Printf("not delivering to blocked recipient=%v", to)
+		return nil
+	}
+
+	return fetch.Post(b, to)
+}
+
+// The blocks that apply to a delivery. We refuse to deliver to
+// inboxes on domains rejected on the whole instance and to inboxes
+// of actors and domains blocked by the sender.
+type deliveryBlocks struct {
+	// The instance-wide domain blocks.
+	blocklist fedcontext.Blocklist
+
+	// The user the delivery is made for. Nil if the delivery
+	// is not made for any user of ours.
+	sender *db.FedUser
+
+	// Inboxes of the actors sender blocked.
+	inboxes []*url.URL
+}
+
+// Look up the blocks that apply to deliveries made with f.
+func (f *FedTransport) blocks(c context.Context) *deliveryBlocks {
+	storage := fedcontext.From(c).Storage
+
+	blocks := &deliveryBlocks{
+		blocklist: fedcontext.LoadBlocklist(storage),
+		sender:    collectionOwner(storage, f.Target),
+	}
+
+	if blocks.sender == nil {
+		return blocks
+	}
+
+	// we deliver to inboxes, not actors, so we need to know
+	// the inboxes of blocked actors
+
+	for _, actor := range blocks.sender.BlockedActors {
+		obj, err := storage.RetrieveObject(actor)
+		if err != nil {
+			if obj, err = fetch.Fetch(actor); err != nil {
+				log.Printf("cannot look up inbox of blocked actor=%v: %v", actor, err)
+				continue
+			}
+		}
+
+		blocks.inboxes = append(blocks.inboxes, prop.IRIs(obj, "inbox")...)
+	}
+
+	return blocks
+}
+
+// Return whether we refuse to deliver to inbox recipient.
+func (bs *deliveryBlocks) Rejects(recipient *url.URL) bool {
+	if bs.blocklist.Rejects(recipient) {
+		return true
+	}
+
+	if bs.sender == nil {
+		return false
+	}
+
+	return bs.sender.HasBlocked(recipient) || util.UrlIn(recipient, bs.inboxes)
+}
+
 func (f *FedTransport) dereferenceFromStorage(c context.Context, iri *url.URL) ([]byte, error) {
 	if obj, err := fedcontext.From(c).Storage.RetrieveObject(iri); err != nil {
 		return nil, err
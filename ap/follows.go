@@ -0,0 +1,153 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"log"
+	"net/url"
+)
+
+// Remember the actors the logged in user sent follow to as pending
+// until they accept or reject the request.
+func addToPendingFollowing(c context.Context, follow vocab.ActivityStreamsFollow) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	for _, iri := range prop.IRIs(follow, "object") {
+		if !user.IsFollowing(iri) && !user.IsPendingFollowing(iri) {
+			user.PendingFollowing = append(user.PendingFollowing, iri)
+		}
+	}
+
+	return storage.StoreUser(user)
+}
+
+// Given an Accept or Reject activity from a remote actor, remove
+// that actor from the pending following collection of all local
+// users whose Follow is answered by response.
+//
+// For Accepts, go-fed adds the actor to the following collection
+// itself.
+func removeFromPendingFollowing(c context.Context, response vocab.Type) error {
+	storage := fedcontext.From(c).Storage
+
+	follows, err := objects(c, response)
+	if err != nil {
+		return err
+	}
+
+	responders := prop.IRIs(response, "actor")
+
+	for _, follow := range follows {
+		if _, ok := follow.(vocab.ActivityStreamsFollow); !ok {
+			continue
+		}
+
+		for _, user := range localUsers(storage, prop.IRIs(follow, "actor")) {
+			for _, responder := range responders {
+				user.PendingFollowing = util.UrlRemove(responder, user.PendingFollowing)
+			}
+
+			if err := storage.StoreUser(user); err != nil {
+				return errors.Wrapf(err, "cannot update user=%v", user.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// For all Follow activities undone by undo, remove the followed
+// actors from the following collection of the logged in user.
+func removeFromFollowing(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	follows, err := objects(c, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, follow := range follows {
+		if _, ok := follow.(vocab.ActivityStreamsFollow); !ok {
+			continue
+		}
+
+		for _, iri := range prop.IRIs(follow, "object") {
+			user.Following = util.UrlRemove(iri, user.Following)
+			user.PendingFollowing = util.UrlRemove(iri, user.PendingFollowing)
+		}
+	}
+
+	return storage.StoreUser(user)
+}
+
+// For all Follow activities undone by undo, remove the actor that
+// sent the original Follow from the followers collection of the
+// followed local users.
+func removeFromFollowers(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	storage := fedcontext.From(c).Storage
+
+	follows, err := objects(c, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, follow := range follows {
+		if _, ok := follow.(vocab.ActivityStreamsFollow); !ok {
+			continue
+		}
+
+		followers := prop.IRIs(follow, "actor")
+
+		for _, user := range localUsers(storage, prop.IRIs(follow, "object")) {
+			for _, follower := range followers {
+				user.Followers = util.UrlRemove(follower, user.Followers)
+			}
+
+			if err := storage.StoreUser(user); err != nil {
+				return errors.Wrapf(err, "cannot update user=%v", user.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the users on this instance that are identified by one of
+// the actor IRIs in iris. IRIs that do not point to local actors are
+// ignored.
+func localUsers(storage db.Storer, iris []*url.URL) (users []*db.FedUser) {
+	for _, iri := range iris {
+		if !(fediri.IRI{iri}).IsLocal() {
+			continue
+		}
+
+		username, err := fediri.IRI{iri}.Actor()
+		if err != nil {
+			continue
+		}
+
+		if user, err := storage.RetrieveUser(username); err != nil {
+			log.Printf("no local user for actor=%v: %v", iri, err)
+		} else {
+			users = append(users, user)
+		}
+	}
+
+	return users
+}
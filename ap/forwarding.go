@@ -0,0 +1,87 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"log"
+	"net/url"
+)
+
+// Properties we look at to find out which objects an activity is
+// about. See section 7.1.2 of the ActivityPub specification.
+var _FORWARDING_KEYS = []string{"inReplyTo", "object", "target", "tag"}
+
+// Return the recipients activity should be forwarded to.
+//
+// go-fed already ensures that activity was not seen before and that
+// it is addressed to at least one collection on this instance. We only
+// forward to the followers collections of local users that own one of
+// the objects activity references (e.g. the post that was replied to)
+// and respect blocks.
+func forwardingRecipients(c context.Context, potentialRecipients []*url.URL, activity pub.Activity) (filtered []*url.URL) {
+	owners := referencedOwners(c, activity)
+
+	for _, recipient := range potentialRecipients {
+		username, err := fediri.IRI{recipient}.FollowersOwner()
+		if err != nil || !(fediri.IRI{recipient}).IsLocal() {
+			continue
+		}
+
+		if !util.UrlIn(fediri.ActorIRI(username).URL(), owners) {
+			continue
+		}
+
+		filtered = append(filtered, recipient)
+	}
+
+	filtered = unblockedRecipients(c, filtered, activity)
+	log.Printf("forwarding to recipients=%v", filtered)
+
+	return filtered
+}
+
+// Return the actors that authored the local objects referenced by
+// activity. Objects embedded into activity are considered as well,
+// e.g. for a Create we look at what the created Note replies to.
+func referencedOwners(c context.Context, activity vocab.Type) (owners []*url.URL) {
+	storage := fedcontext.From(c).Storage
+
+	// collect the IRIs of everything activity is about
+
+	references := prop.IRIs(activity, _FORWARDING_KEYS...)
+
+	embedded, err := objects(c, activity)
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, obj := range embedded {
+		references = append(references, prop.IRIs(obj, _FORWARDING_KEYS...)...)
+	}
+
+	// look up the authors of the local ones
+
+	for _, iri := range references {
+		if !(fediri.IRI{iri}).IsLocal() {
+			continue
+		}
+
+		obj, err := storage.RetrieveObject(iri)
+		if err != nil {
+			continue
+		}
+
+		for _, author := range prop.IRIs(obj, "attributedTo", "actor") {
+			if (fediri.IRI{author}).IsLocal() && !util.UrlIn(author, owners) {
+				owners = append(owners, author)
+			}
+		}
+	}
+
+	return owners
+}
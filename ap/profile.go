@@ -0,0 +1,77 @@
+package ap
+
+import (
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/fetch"
+	"log"
+	"time"
+)
+
+// Verify the profile fields of the user with given username that link
+// to web pages and were not verified yet. A field is verified if the
+// page it links to links back to the profile of the user with rel=me.
+func verifyFields(storage db.Storer, username string) {
+	user, err := storage.RetrieveUser(username)
+	if err != nil {
+		log.Printf("cannot look up user=%v: %v", username, err)
+		return
+	}
+
+	profile := fediri.ActorIRI(username).URL()
+	verified := make(map[string]time.Time)
+
+	for _, field := range user.Profile.Fields {
+		page := field.Link()
+
+		if page == nil || field.VerifiedAt != nil {
+			continue
+		}
+
+		if ok, err := fetch.RelMe(page, profile); err != nil {
+			log.Printf("cannot verify page=%v: %v", page, err)
+		} else if ok {
+			verified[field.Value] = time.Now()
+		}
+	}
+
+	if len(verified) == 0 {
+		return
+	}
+
+	// the profile might have changed while we were fetching; only
+	// mark fields that are still around
+
+	if err := markVerified(storage, username, verified); err != nil {
+		log.Printf("cannot store verification of user=%v: %v", username, err)
+	}
+}
+
+// Set the verification time of the profile fields of the user with
+// given username to the times in verified, which are identified by
+// the value of the field.
+func markVerified(storage db.Storer, username string, verified map[string]time.Time) error {
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	user, err := tx.RetrieveUser(username)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range user.Profile.Fields {
+		if at, ok := verified[field.Value]; ok {
+			field.VerifiedAt = &at
+		}
+	}
+
+	if err := tx.StoreUser(user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,144 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"log"
+)
+
+// Remember the objects announced by the logged in user as repeated.
+func addToRepeated(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	for _, iri := range prop.IRIs(announce, "object") {
+		if !user.HasRepeated(iri) {
+			user.Repeated = append(user.Repeated, iri)
+		}
+	}
+
+	return storage.StoreUser(user)
+}
+
+// For all Announce activities undone by undo, remove the announced
+// objects from the repeated collection of the logged in user. The
+// Announce itself is removed from the outbox.
+func removeFromRepeated(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	storage := fedcontext.From(c).Storage
+
+	user, err := clientUser(c)
+	if err != nil {
+		return err
+	}
+
+	announces, err := objects(c, undo)
+	if err != nil {
+		return err
+	}
+
+	for _, announce := range announces {
+		if _, ok := announce.(vocab.ActivityStreamsAnnounce); !ok {
+			continue
+		}
+
+		for _, iri := range prop.IRIs(announce, "object") {
+			user.Repeated = util.UrlRemove(iri, user.Repeated)
+		}
+
+		user.Outbox = util.UrlRemove(prop.Id(announce), user.Outbox)
+	}
+
+	return storage.StoreUser(user)
+}
+
+// Remove the activities undone by undo from the inboxes of all users
+// on this instance. This way undone activities (e.g. repeats) stop
+// showing up in streams.
+func removeFromInboxes(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	storage := fedcontext.From(c).Storage
+
+	activities, err := objects(c, undo)
+	if err != nil {
+		return err
+	}
+
+	users, err := storage.RetrieveUsers()
+	if err != nil {
+		return errors.Wrap(err, "cannot list users")
+	}
+
+	for _, activity := range activities {
+		id := prop.Id(activity)
+
+		for _, user := range users {
+			if !util.UrlIn(id, user.Inbox) {
+				continue
+			}
+
+			user.Inbox = util.UrlRemove(id, user.Inbox)
+
+			if err := storage.StoreUser(user); err != nil {
+				return errors.Wrapf(err, "cannot update inbox of user=%v", user.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Return the objects of activity. Objects only referenced by IRI
+// are looked up in storage; objects we do not know about are
+// skipped.
+func objects(c context.Context, activity vocab.Type) (vs []vocab.Type, err error) {
+	type objecter interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}
+
+	storage := fedcontext.From(c).Storage
+
+	o, ok := activity.(objecter)
+	if !ok || o.GetActivityStreamsObject() == nil {
+		return nil, nil
+	}
+
+	property := o.GetActivityStreamsObject()
+
+	for it := property.Begin(); it != property.End(); it = it.Next() {
+		if it.IsIRI() {
+			if obj, err := storage.RetrieveObject(it.GetIRI()); err != nil {
+				log.Printf("unknown object=%v", it.GetIRI())
+			} else {
+				vs = append(vs, obj)
+			}
+		} else if obj := it.GetType(); obj != nil {
+			vs = append(vs, obj)
+		}
+	}
+
+	return vs, nil
+}
+
+// Return the user that is logged in for the request in c.
+func clientUser(c context.Context) (*db.FedUser, error) {
+	fc := fedcontext.From(c)
+
+	if fc.Client == nil {
+		return nil, errors.New("no client for request")
+	}
+
+	username, ok := fedcontext.LocalUsername(fc.Client)
+	if !ok {
+		return nil, errors.New("client is not a local user")
+	}
+
+	return fc.Storage.RetrieveUser(username)
+}
@@ -0,0 +1,73 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"log"
+	"net/url"
+)
+
+// For each object created by create that is a reply to an object
+// on this instance, add the object to the replies collection of
+// the object it is replying to.
+func addToReplies(c context.Context, create vocab.ActivityStreamsCreate) error {
+	objects := create.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+
+	for it := objects.Begin(); it != objects.End(); it = it.Next() {
+		// we only look at embedded objects; dereferencing objects
+		// here does not seem worth it
+
+		obj := it.GetType()
+		if obj == nil || obj.GetJSONLDId() == nil {
+			continue
+		}
+
+		reply := prop.Id(obj)
+
+		for _, parent := range prop.IRIs(obj, "inReplyTo") {
+			if err := addReply(c, parent, reply); err != nil {
+				return errors.Wrapf(err, "cannot add reply=%v to parent=%v", reply, parent)
+			}
+		}
+	}
+
+	return nil
+}
+
+// If parent is an object stored on this instance, add reply to
+// its replies collection.
+func addReply(c context.Context, parent, reply *url.URL) error {
+	storage := fedcontext.From(c).Storage
+
+	// we only keep track of replies to our own objects; everybody
+	// else will have to take care of their own replies
+
+	if _, err := (fediri.IRI{parent}).Object(); err != nil {
+		return nil
+	}
+
+	if !(fediri.IRI{parent}).IsLocal() {
+		return nil
+	}
+
+	obj, err := storage.RetrieveObject(parent)
+	if err != nil {
+		log.Printf("reply=%v to unknown parent=%v", reply, parent)
+		return nil
+	}
+
+	// add the reply and write back
+
+	if err := prop.AddReply(obj, reply); err != nil {
+		return err
+	}
+
+	return storage.StoreObject(parent, obj)
+}
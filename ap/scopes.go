@@ -0,0 +1,84 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+)
+
+// Return an error if the token of the client in c does not allow for
+// posting activity to the outbox.
+func mustHaveScope(c context.Context, activity vocab.Type) error {
+	fc := fedcontext.From(c)
+
+	for _, scope := range requiredScopes(c, activity) {
+		if err := fc.RequireScope(scope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return the scopes a token needs to post activity to the outbox.
+func requiredScopes(c context.Context, activity vocab.Type) []string {
+	switch activity.(type) {
+	case vocab.ActivityStreamsCreate, vocab.ActivityStreamsDelete, vocab.ActivityStreamsAnnounce:
+		return []string{"write:statuses"}
+
+	case vocab.ActivityStreamsUpdate:
+		if updatesActor(activity) {
+			return []string{"write:accounts"}
+		} else {
+			return []string{"write:statuses"}
+		}
+
+	case vocab.ActivityStreamsLike:
+		return []string{"write:favourites"}
+
+	case vocab.ActivityStreamsFollow:
+		return []string{"write:follows"}
+
+	case vocab.ActivityStreamsBlock:
+		return []string{"write:blocks"}
+
+	case vocab.ActivityStreamsUndo:
+		return undoScopes(c, activity)
+
+	default:
+		return []string{"write"}
+	}
+}
+
+// Return the scopes required for undoing the objects of undo. Undoing
+// something requires the same scopes as doing it in the first place.
+func undoScopes(c context.Context, undo vocab.Type) (scopes []string) {
+	undone, err := objects(c, undo)
+	if err != nil || len(undone) == 0 {
+		return []string{"write"}
+	}
+
+	for _, obj := range undone {
+		if _, ok := obj.(vocab.ActivityStreamsUndo); ok {
+			return []string{"write"}
+		}
+
+		scopes = append(scopes, requiredScopes(c, obj)...)
+	}
+
+	return scopes
+}
+
+// Return whether update is about an actor, that is whether it
+// changes a profile.
+func updatesActor(update vocab.Type) bool {
+	for _, iri := range prop.IRIs(update, "object") {
+		if _, err := (fediri.IRI{iri}).Actor(); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
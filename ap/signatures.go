@@ -0,0 +1,84 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"net/url"
+)
+
+// The key under which we remember the activity POSTed to an inbox.
+type activityKey struct{}
+
+// Remember the activity of the federated request in c.
+// AuthenticatePostInbox only gets the request, but needs to know
+// what is posted.
+func withActivity(c context.Context, activity pub.Activity) context.Context {
+	return context.WithValue(c, activityKey{}, activity)
+}
+
+// Ensure that an incoming Delete, Update or Undo was sent by the
+// actor it names. These activities change what we have in storage,
+// so we require an HTTP signature of that actor. Other activities
+// are always accepted.
+//
+// We do not sign our own deliveries, so activities of local actors
+// are accepted unsigned if they are in the outbox of that actor;
+// only the outbox puts them there.
+func signedByActor(c context.Context) error {
+	activity, ok := c.Value(activityKey{}).(pub.Activity)
+	if !ok {
+		return errors.New("no activity in request")
+	}
+
+	switch activity.(type) {
+	case vocab.ActivityStreamsDelete, vocab.ActivityStreamsUpdate, vocab.ActivityStreamsUndo:
+	default:
+		return nil
+	}
+
+	fc := fedcontext.From(c)
+
+	actors := prop.IRIs(activity, "actor")
+	if len(actors) == 0 {
+		return errors.New("activity has no actor")
+	}
+
+	for _, actor := range actors {
+		if fc.Signer != nil && util.UrlEq(actor, fc.Signer) {
+			continue
+		}
+
+		if (fediri.IRI{actor}).IsLocal() && inOutboxOf(fc, actor, prop.Id(activity)) {
+			continue
+		}
+
+		return errors.Newf("activity not signed by actor=%v", actor)
+	}
+
+	return nil
+}
+
+// Return whether iri is in the outbox of the local actor.
+func inOutboxOf(fc *fedcontext.FedContext, actor *url.URL, iri *url.URL) bool {
+	if iri == nil {
+		return false
+	}
+
+	username, err := fediri.IRI{actor}.Actor()
+	if err != nil {
+		return false
+	}
+
+	user, err := fc.Storage.RetrieveUser(username)
+	if err != nil {
+		return false
+	}
+
+	return util.UrlIn(iri, user.Outbox)
+}
@@ -0,0 +1,69 @@
+package ap
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"net/url"
+)
+
+// Return the actor that issued the request in c. Returns nil for
+// anonymous requests.
+func Requester(c context.Context) *url.URL {
+	return fedcontext.From(c).Requester
+}
+
+// Return whether requester may see object. Requester may be nil for
+// anonymous requests in which case only public objects are visible.
+//
+// Besides public objects, requester can see objects they authored,
+// objects addressed to them and objects addressed to the followers
+// of a local author they are following.
+func VisibleTo(c context.Context, object vocab.Type, requester *url.URL) bool {
+	if prop.IsPublic(object) {
+		return true
+	}
+
+	if requester == nil {
+		return false
+	}
+
+	authors := prop.IRIs(object, "attributedTo", "actor")
+	recipients := prop.Recipients(object)
+
+	if util.UrlIn(requester, authors) || util.UrlIn(requester, recipients) {
+		return true
+	}
+
+	// check whether it was addressed to the followers of a local
+	// author and requester is one of these followers
+
+	storage := fedcontext.From(c).Storage
+
+	for _, user := range localUsers(storage, authors) {
+		followers := fediri.FollowersIRI(user.Name).URL()
+
+		if util.UrlIn(followers, recipients) && user.IsFollowedBy(requester) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the IRIs in iris that point to objects requester may see.
+// IRIs of objects that cannot be found in storage are dropped.
+func visibleIRIs(c context.Context, iris []*url.URL, requester *url.URL) (visible []*url.URL) {
+	storage := fedcontext.From(c).Storage
+
+	for _, iri := range iris {
+		if obj, err := storage.RetrieveObject(iri); err == nil && VisibleTo(c, obj, requester) {
+			visible = append(visible, iri)
+		}
+	}
+
+	return visible
+}
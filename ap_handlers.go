@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"github.com/kissen/fed/ap"
 	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
 	"log"
 	"net/http"
 )
@@ -35,6 +37,14 @@ func ApGetPostInbox(w http.ResponseWriter, r *http.Request) {
 func ApGetPostActivity(w http.ResponseWriter, r *http.Request) {
 	log.Printf("ActivityHandler(%v)", r.URL)
 
+	// objects that are not public may only be seen by whoever
+	// they were addressed to; pretend the others do not exist
+
+	if r.Method == http.MethodGet && !visible(r) {
+		ApiError(w, r, "not found", http.StatusNotFound)
+		return
+	}
+
 	if done, err := HandleWithHandleFunc(w, r); err != nil {
 		ApiError(w, r, err, http.StatusInternalServerError)
 	} else if !done {
@@ -42,6 +52,25 @@ func ApGetPostActivity(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Return whether the object requested with r may be seen by the
+// requester. Requests that do not point to objects in storage are
+// always visible.
+func visible(r *http.Request) bool {
+	iri := fediri.NewIRI(r.URL.Path)
+
+	if _, err := iri.Object(); err != nil {
+		return true
+	}
+
+	obj, err := fedcontext.Context(r).Storage.RetrieveObject(iri.URL())
+	if err != nil {
+		return true
+	}
+
+	c := r.Context()
+	return ap.VisibleTo(c, obj, ap.Requester(c))
+}
+
 func ApGetRemote(w http.ResponseWriter, r *http.Request) {
 	DoError(w, r, nil, http.StatusNotImplemented)
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
 	"log"
 	"net/http"
 )
@@ -61,3 +62,21 @@ func ApiError(w http.ResponseWriter, r *http.Request, cause interface{}, status
 		log.Printf("writing err json to client failed: %v", err)
 	}
 }
+
+// Check that the client of r may act with scope. If not, the error
+// is written out and done is true. The status tells clients whether
+// they need to authenticate or need a token with more scope.
+func apiRequireScope(w http.ResponseWriter, r *http.Request, scope string) (done bool) {
+	err := fedcontext.Context(r).RequireScope(scope)
+	if err == nil {
+		return false
+	}
+
+	status, ok := errors.Status(err)
+	if !ok {
+		status = http.StatusForbidden
+	}
+
+	ApiError(w, r, err, status)
+	return true
+}
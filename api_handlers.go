@@ -0,0 +1,613 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/gorilla/mux"
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/mastodon"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/template"
+	"github.com/kissen/fed/util"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The version we report to clients. Clients decide which features
+// to use based on the Mastodon version; we implement the core of the
+// API as it was in Mastodon 2.7.
+const _API_VERSION = "2.7.0 (compatible; fed 0.x)"
+
+// How many statuses timelines return if clients do not ask for
+// anything else.
+const _API_DEFAULT_LIMIT = 20
+
+// The most statuses timelines return at once.
+const _API_MAX_LIMIT = 40
+
+// POST /api/v1/apps
+//
+// Registers a new OAuth client. Compatible with the endpoint of the
+// same name in the Mastodon API. Parameter redirect_uris holds the
+// allowed redirect URIs separated by white space, parameter scopes
+// the most the client will ask for when requesting authorization.
+func PostApiApps(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostApiApps()")
+
+	params, err := apiParams(r)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	name := params["client_name"]
+	if strings.TrimSpace(name) == "" {
+		ApiError(w, r, "missing client_name", http.StatusUnprocessableEntity)
+		return
+	}
+
+	scope, err := db.ParseOAuthScope(params["scopes"])
+	if err != nil {
+		ApiError(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	client := db.NewFedOAuthClient(name, params["website"], params["redirect_uris"], scope)
+	if len(client.RedirectURIs) == 0 {
+		ApiError(w, r, "missing redirect_uris", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := fedcontext.Context(r).Storage.StoreClient(client); err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var website interface{}
+
+	if client.Website != "" {
+		website = client.Website
+	}
+
+	reply := map[string]interface{}{
+		"id":            client.Id,
+		"name":          client.Name,
+		"website":       website,
+		"redirect_uri":  strings.Join(client.RedirectURIs, "\n"),
+		"client_id":     client.Id,
+		"client_secret": client.Secret,
+		"scopes":        client.Scope.Scopes(),
+	}
+
+	apiReply(w, r, http.StatusOK, reply)
+	log.Printf("registered client=%v name=%v", client.Id, client.Name)
+}
+
+// Return the parameters of an API request. Clients send them either
+// as form values or as a JSON object. Arrays in JSON objects are
+// joined with white space.
+func apiParams(r *http.Request) (map[string]string, error) {
+	params := make(map[string]string)
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body map[string]interface{}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, errors.Wrap(err, "bad json body")
+		}
+
+		for key, value := range body {
+			params[key] = apiString(value)
+		}
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "bad form")
+	}
+
+	for key, values := range r.Form {
+		if _, ok := params[key]; !ok {
+			params[key] = strings.Join(values, " ")
+		}
+	}
+
+	return params, nil
+}
+
+// Return the string representation of value which was decoded from
+// JSON.
+func apiString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		var ss []string
+		for _, entry := range v {
+			ss = append(ss, apiString(entry))
+		}
+		return strings.Join(ss, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Write out reply as JSON with the given HTTP status.
+func apiReply(w http.ResponseWriter, r *http.Request, status int, reply interface{}) {
+	bs, err := json.Marshal(reply)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(bs); err != nil {
+		log.Printf("writing reply to client failed: %v", err)
+	}
+}
+
+// GET /api/v1/instance
+//
+// Returns information about this instance. Clients ask for it
+// before anything else.
+func GetApiInstance(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetApiInstance()")
+
+	users, err := fedcontext.Context(r).Storage.RetrieveUsers()
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	statuses := 0
+
+	for _, user := range users {
+		statuses += len(user.Outbox)
+	}
+
+	hostname := config.Get().Hostname
+
+	reply := map[string]interface{}{
+		"uri":               hostname,
+		"title":             hostname,
+		"short_description": "",
+		"description":       "",
+		"email":             "",
+		"version":           _API_VERSION,
+		"urls":              map[string]interface{}{},
+		"thumbnail":         nil,
+		"languages":         []string{},
+		"registrations":     false,
+		"approval_required": false,
+		"invites_enabled":   false,
+		"contact_account":   nil,
+		"max_toot_chars":    _MAX_NOTE_LENGTH,
+		"stats": map[string]interface{}{
+			"user_count":   len(users),
+			"status_count": statuses,
+			"domain_count": 0,
+		},
+	}
+
+	apiReply(w, r, http.StatusOK, reply)
+}
+
+// GET /api/v1/accounts/verify_credentials
+//
+// Returns the account of the logged in user. Clients use this to
+// test whether their token works.
+func GetApiVerifyCredentials(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetApiVerifyCredentials()")
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "read:accounts") {
+		return
+	}
+
+	user, err := fc.Storage.RetrieveUser(fc.Client.Username())
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	actor, err := fc.Client.Get(fc.Client.IRI())
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	account, err := mastodon.Account(fc, actor)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the logged in user also gets the profile as they entered it
+
+	account["source"] = map[string]interface{}{
+		"note":      template.Plaintext(user.Profile.Summary),
+		"fields":    account["fields"],
+		"privacy":   "public",
+		"sensitive": false,
+		"language":  "",
+	}
+
+	apiReply(w, r, http.StatusOK, account)
+}
+
+// GET /api/v1/accounts/{id}
+//
+// Returns the account with given id. Accounts may be local or
+// remote.
+func GetApiAccount(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetApiAccount(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	iri, err := mastodon.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		ApiError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	actor, err := mastodon.Retrieve(fc, iri)
+	if err != nil {
+		ApiError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	if !mastodon.IsActor(actor) {
+		ApiError(w, r, "id does not refer to an account", http.StatusNotFound)
+		return
+	}
+
+	account, err := mastodon.Account(fc, actor)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	apiReply(w, r, http.StatusOK, account)
+}
+
+// POST /api/v1/statuses
+//
+// Posts a new status. Parameter status holds the text, visibility
+// and spoiler_text work like in Mastodon. If in_reply_to_id is set,
+// the status is a reply. Attaching media is not supported yet.
+func PostApiStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostApiStatus()")
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "write:statuses") {
+		return
+	}
+
+	params, err := apiParams(r)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := strings.TrimSpace(params["status"])
+
+	if payload == "" {
+		ApiError(w, r, "missing status", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if len(payload) > _MAX_NOTE_LENGTH {
+		ApiError(w, r, "status too long", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if params["media_ids"] != "" || params["media_ids[]"] != "" {
+		ApiError(w, r, "media_ids not supported", http.StatusUnprocessableEntity)
+		return
+	}
+
+	visibility, err := mastodon.ParseVisibility(params["visibility"])
+	if err != nil {
+		ApiError(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	client := fc.Client
+	note := newNote(client, payload)
+
+	if spoiler := strings.TrimSpace(params["spoiler_text"]); spoiler != "" {
+		summary := streams.NewActivityStreamsSummaryProperty()
+		summary.AppendXMLSchemaString(spoiler)
+		note.SetActivityStreamsSummary(summary)
+	}
+
+	var parent *url.URL
+
+	if parentId := params["in_reply_to_id"]; parentId != "" {
+		if parent, err = mastodon.ParseID(parentId); err != nil {
+			ApiError(w, r, err, http.StatusNotFound)
+			return
+		}
+	}
+
+	var created *url.URL
+
+	if parent != nil {
+		created, err = client.Reply(parent, note, visibility)
+	} else {
+		created, err = client.Create(note, visibility)
+	}
+
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	// the outbox assigned an id to the note; look it up s.t. we
+	// can reply with the status as it was stored
+
+	if created == nil {
+		ApiError(w, r, "outbox did not report location of status", http.StatusBadGateway)
+		return
+	}
+
+	create, err := client.Get(created)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	apiReplyStatus(w, r, create)
+}
+
+// GET /api/v1/statuses/{id}
+//
+// Returns the status with given id.
+func GetApiStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetApiStatus(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	// statuses that are public can be looked up by anyone; if
+	// there is a token, it needs to allow reading
+
+	if fc.Client != nil {
+		if apiRequireScope(w, r, "read:statuses") {
+			return
+		}
+	}
+
+	_, obj, done := apiGetStatus(w, r)
+	if done {
+		return
+	}
+
+	apiReplyStatus(w, r, obj)
+}
+
+// DELETE /api/v1/statuses/{id}
+//
+// Deletes the status with given id. Only statuses written by the
+// logged in user can be deleted. Replies with the deleted status.
+func DeleteApiStatus(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DeleteApiStatus(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "write:statuses") {
+		return
+	}
+
+	iri, obj, done := apiGetStatus(w, r)
+	if done {
+		return
+	}
+
+	status, err := mastodon.Status(fc, obj)
+	if err != nil {
+		ApiError(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := fc.Client.Delete(iri); err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	apiReply(w, r, http.StatusOK, status)
+}
+
+// POST /api/v1/statuses/{id}/favourite
+//
+// Likes the status with given id. Replies with the liked status.
+func PostApiFavourite(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostApiFavourite(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "write:favourites") {
+		return
+	}
+
+	iri, obj, done := apiGetStatus(w, r)
+	if done {
+		return
+	}
+
+	if err := fc.Client.Like(iri); err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	apiReplyStatus(w, r, obj)
+}
+
+// POST /api/v1/statuses/{id}/reblog
+//
+// Repeats the status with given id. Replies with the new status
+// that contains the repeated status.
+func PostApiReblog(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostApiReblog(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "write:statuses") {
+		return
+	}
+
+	iri, _, done := apiGetStatus(w, r)
+	if done {
+		return
+	}
+
+	if err := fc.Client.Repeat(iri); err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	announce, err := fc.Client.FindInOutbox(func(activity vocab.Type) bool {
+		_, ok := activity.(vocab.ActivityStreamsAnnounce)
+		return ok && util.UrlIn(iri, prop.IRIs(activity, "object"))
+	})
+
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	apiReplyStatus(w, r, announce)
+}
+
+// GET /api/v1/timelines/home?max_id={id}&limit={limit}
+//
+// Returns the stream of the logged in user, newest first. At most
+// limit statuses are returned, starting after the status with
+// max_id if given.
+func GetApiHomeTimeline(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetApiHomeTimeline(%v)", r.URL)
+
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "read:statuses") {
+		return
+	}
+
+	limit := _API_DEFAULT_LIMIT
+
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+			ApiError(w, r, "bad limit", http.StatusBadRequest)
+			return
+		} else if n < _API_MAX_LIMIT {
+			limit = n
+		} else {
+			limit = _API_MAX_LIMIT
+		}
+	}
+
+	stream, err := fc.Client.Stream()
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	// the stream is ordered already; we only walk as far as we
+	// need to, skipping everything up to and including max_id
+
+	maxId := r.URL.Query().Get("max_id")
+	found := maxId == ""
+	statuses := []interface{}{}
+
+	var last string
+
+	for it := stream; it != it.End() && len(statuses) < limit; it = it.Next() {
+		activity, err := fetch.FetchIter(it)
+		if err != nil {
+			continue
+		}
+
+		if !found {
+			if iri := mastodon.StatusIRI(activity); iri != nil && mastodon.ID(iri) == maxId {
+				found = true
+			}
+
+			continue
+		}
+
+		status, err := mastodon.Status(fc, activity)
+		if err != nil {
+			continue
+		}
+
+		statuses = append(statuses, status)
+		last = status["id"].(string)
+	}
+
+	if !found {
+		ApiError(w, r, "max_id is not in the timeline", http.StatusNotFound)
+		return
+	}
+
+	// clients page through the timeline by following the link
+	// in the Link header
+
+	if len(statuses) == limit {
+		next := config.Get().GlobalURL()
+		next.Path = "/api/v1/timelines/home"
+		next.RawQuery = url.Values{
+			"max_id": {last},
+			"limit":  {strconv.Itoa(limit)},
+		}.Encode()
+
+		w.Header().Set("Link", fmt.Sprintf(`<%v>; rel="next"`, next))
+	}
+
+	apiReply(w, r, http.StatusOK, statuses)
+}
+
+// Look up the object that the {id} path variable of r refers to.
+// Returns its IRI and the object itself. If it cannot be looked up,
+// an error is written out and done is true.
+func apiGetStatus(w http.ResponseWriter, r *http.Request) (iri *url.URL, obj vocab.Type, done bool) {
+	fc := fedcontext.Context(r)
+
+	iri, err := mastodon.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		ApiError(w, r, err, http.StatusNotFound)
+		return nil, nil, true
+	}
+
+	obj, err = mastodon.Retrieve(fc, iri)
+	if err != nil {
+		ApiError(w, r, err, http.StatusNotFound)
+		return nil, nil, true
+	}
+
+	return iri, obj, false
+}
+
+// Write out obj as Status entity.
+func apiReplyStatus(w http.ResponseWriter, r *http.Request, obj vocab.Type) {
+	status, err := mastodon.Status(fedcontext.Context(r), obj)
+	if err != nil {
+		ApiError(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	apiReply(w, r, http.StatusOK, status)
+}
@@ -0,0 +1,192 @@
+// Package compose turns the plain text users type into the web
+// interface into the HTML content and tags of an ActivityPub note.
+package compose
+
+import (
+	"html"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Matches everything that is not plain text, that is links,
+// mentions of the form @user@host and hashtags.
+var token = regexp.MustCompile(
+	`(https?://[^\s<>"]+)|(@[\w.\-]+@[\w\-]+(?:\.[\w\-]+)+)|(#[\pL\pN_]+)`,
+)
+
+// Matches the empty lines between paragraphs.
+var paragraphSeparator = regexp.MustCompile(`\n\s*\n`)
+
+// Characters that are usually not part of a link when they appear
+// at the very end, e.g. the dot after an URL at the end of a
+// sentence.
+const _TRAILING_PUNCTUATION = `.,;:!?)'"`
+
+// Configures how text is turned into content.
+type Composer struct {
+	// Return the IRI of the actor with the given handle of
+	// the form @user@host.
+	Resolve func(handle string) (*url.URL, error)
+
+	// Return the IRI of the page that lists posts tagged
+	// with tag. Tag does not include the leading '#'.
+	TagIRI func(tag string) *url.URL
+}
+
+// The result of composing some text.
+type Post struct {
+	// HTML content to be used as the content of a note.
+	Content string
+
+	// Actors mentioned in the text. Each actor is only
+	// contained once.
+	Mentions []Tag
+
+	// Hashtags used in the text. Each hashtag is only
+	// contained once.
+	Hashtags []Tag
+}
+
+// A reference to an actor or a hashtag.
+type Tag struct {
+	// Human-readable name, e.g. "@alice@example.com" or
+	// "#cats".
+	Name string
+
+	// Target of the reference.
+	Href *url.URL
+}
+
+// Turn text into a post. Each paragraph of text is put into its own
+// HTML paragraph, everything else is escaped except for links,
+// mentions and hashtags.
+//
+// Mentions that cannot be resolved are left as plain text.
+func (c *Composer) Compose(text string) *Post {
+	post := &Post{}
+
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.TrimSpace(text)
+
+	var paragraphs []string
+
+	for _, paragraph := range paragraphSeparator.Split(text, -1) {
+		var lines []string
+
+		for _, line := range strings.Split(strings.TrimSpace(paragraph), "\n") {
+			lines = append(lines, c.line(post, line))
+		}
+
+		paragraphs = append(paragraphs, "<p>"+strings.Join(lines, "<br>")+"</p>")
+	}
+
+	post.Content = strings.Join(paragraphs, "")
+	return post
+}
+
+// Convert a single line of text to HTML. Mentions and hashtags
+// found are added to post.
+func (c *Composer) line(post *Post, line string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, match := range token.FindAllStringSubmatchIndex(line, -1) {
+		start, end := match[0], match[1]
+
+		// mentions and hashtags need to stand on their own; in
+		// the middle of a word they are just text
+
+		if start > 0 && match[2] < 0 {
+			if r, _ := utf8.DecodeLastRuneInString(line[:start]); isWordRune(r) {
+				continue
+			}
+		}
+
+		// do not make punctuation at the end part of a link
+
+		if match[2] >= 0 {
+			end = start + len(strings.TrimRight(line[start:end], _TRAILING_PUNCTUATION))
+		}
+
+		b.WriteString(html.EscapeString(line[last:start]))
+		last = end
+
+		s := line[start:end]
+
+		switch {
+		case match[2] >= 0:
+			b.WriteString(c.link(s))
+		case match[4] >= 0:
+			b.WriteString(c.mention(post, s))
+		case match[6] >= 0:
+			b.WriteString(c.hashtag(post, s))
+		}
+	}
+
+	b.WriteString(html.EscapeString(line[last:]))
+	return b.String()
+}
+
+// Return the HTML for a link to addr.
+func (c *Composer) link(addr string) string {
+	escaped := html.EscapeString(addr)
+	return `<a href="` + escaped + `" rel="nofollow noopener" target="_blank">` + escaped + `</a>`
+}
+
+// Return the HTML for a mention of handle. If handle can be resolved,
+// the mention is added to post.
+func (c *Composer) mention(post *Post, handle string) string {
+	if c.Resolve == nil {
+		return html.EscapeString(handle)
+	}
+
+	href, err := c.Resolve(handle)
+	if err != nil {
+		log.Printf("cannot resolve handle=%v: %v", handle, err)
+		return html.EscapeString(handle)
+	}
+
+	post.Mentions = addTag(post.Mentions, Tag{Name: handle, Href: href})
+
+	user := strings.Split(strings.TrimPrefix(handle, "@"), "@")[0]
+
+	return `<span class="h-card"><a href="` + html.EscapeString(href.String()) +
+		`" class="u-url mention">@<span>` + html.EscapeString(user) + `</span></a></span>`
+}
+
+// Return the HTML for hashtag. The hashtag is added to post.
+func (c *Composer) hashtag(post *Post, hashtag string) string {
+	if c.TagIRI == nil {
+		return html.EscapeString(hashtag)
+	}
+
+	name := strings.TrimPrefix(hashtag, "#")
+	href := c.TagIRI(strings.ToLower(name))
+
+	post.Hashtags = addTag(post.Hashtags, Tag{Name: hashtag, Href: href})
+
+	return `<a href="` + html.EscapeString(href.String()) +
+		`" class="mention hashtag" rel="tag">#<span>` + html.EscapeString(name) + `</span></a>`
+}
+
+// Return tags with tag appended, unless tags already contains a tag
+// with the same name.
+func addTag(tags []Tag, tag Tag) []Tag {
+	for _, t := range tags {
+		if strings.EqualFold(t.Name, tag.Name) {
+			return tags
+		}
+	}
+
+	return append(tags, tag)
+}
+
+// Return whether r is a rune that makes up words. Mentions and
+// hashtags directly following such runes are not considered.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@' || r == '/' || r == '#'
+}
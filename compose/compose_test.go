@@ -0,0 +1,93 @@
+package compose
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func testComposer(t *testing.T) *Composer {
+	return &Composer{
+		Resolve: func(handle string) (*url.URL, error) {
+			if handle != "@alice@example.com" {
+				return nil, errors.New("unknown handle")
+			}
+
+			return url.Parse("https://example.com/alice")
+		},
+
+		TagIRI: func(tag string) *url.URL {
+			iri, err := url.Parse("https://fed.example/tags/" + tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return iri
+		},
+	}
+}
+
+func TestComposeEscapes(t *testing.T) {
+	post := testComposer(t).Compose("<b>bold</b> & more")
+	expected := "<p>&lt;b&gt;bold&lt;/b&gt; &amp; more</p>"
+
+	if post.Content != expected {
+		t.Errorf("bad content expected=%v got=%v", expected, post.Content)
+	}
+}
+
+func TestComposeParagraphs(t *testing.T) {
+	post := testComposer(t).Compose("first\nline\n\nsecond")
+	expected := "<p>first<br>line</p><p>second</p>"
+
+	if post.Content != expected {
+		t.Errorf("bad content expected=%v got=%v", expected, post.Content)
+	}
+}
+
+func TestComposeLinks(t *testing.T) {
+	post := testComposer(t).Compose("see https://example.com/a?b=c.")
+	expected := `<p>see <a href="https://example.com/a?b=c" rel="nofollow noopener" target="_blank">https://example.com/a?b=c</a>.</p>`
+
+	if post.Content != expected {
+		t.Errorf("bad content expected=%v got=%v", expected, post.Content)
+	}
+}
+
+func TestComposeMentions(t *testing.T) {
+	post := testComposer(t).Compose("hi @alice@example.com and @bob@example.com, mail@alice@example.com")
+
+	if count := len(post.Mentions); count != 1 {
+		t.Fatalf("bad number of mentions expected=1 got=%v", count)
+	}
+
+	if href := post.Mentions[0].Href.String(); href != "https://example.com/alice" {
+		t.Errorf("bad mention href=%v", href)
+	}
+
+	expected := `<p>hi <span class="h-card"><a href="https://example.com/alice" class="u-url mention">@<span>alice</span></a></span>` +
+		` and @bob@example.com, mail@alice@example.com</p>`
+
+	if post.Content != expected {
+		t.Errorf("bad content expected=%v got=%v", expected, post.Content)
+	}
+}
+
+func TestComposeHashtags(t *testing.T) {
+	post := testComposer(t).Compose("#Cats are great #cats issue#1")
+
+	if count := len(post.Hashtags); count != 1 {
+		t.Fatalf("bad number of hashtags expected=1 got=%v", count)
+	}
+
+	if href := post.Hashtags[0].Href.String(); href != "https://fed.example/tags/cats" {
+		t.Errorf("bad hashtag href=%v", href)
+	}
+
+	expected := `<p><a href="https://fed.example/tags/cats" class="mention hashtag" rel="tag">#<span>Cats</span></a> are great ` +
+		`<a href="https://fed.example/tags/cats" class="mention hashtag" rel="tag">#<span>cats</span></a> issue#1</p>`
+
+	if post.Content != expected {
+		t.Errorf("bad content expected=%v got=%v", expected, post.Content)
+	}
+}
@@ -0,0 +1,68 @@
+package compose
+
+import (
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"net/url"
+)
+
+// Write post to note. This sets the content and tags of note. All
+// mentioned actors are added to cc, everything else that might
+// already be addressed is kept.
+func (p *Post) Apply(note vocab.ActivityStreamsNote) {
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString(p.Content)
+	note.SetActivityStreamsContent(content)
+
+	// tag mentions and hashtags
+
+	tag := streams.NewActivityStreamsTagProperty()
+
+	for _, m := range p.Mentions {
+		mention := streams.NewActivityStreamsMention()
+		mention.SetActivityStreamsHref(href(m.Href))
+		mention.SetActivityStreamsName(name(m.Name))
+		tag.AppendActivityStreamsMention(mention)
+	}
+
+	for _, h := range p.Hashtags {
+		hashtag := streams.NewTootHashtag()
+		hashtag.SetActivityStreamsHref(href(h.Href))
+		hashtag.SetActivityStreamsName(name(h.Name))
+		tag.AppendTootHashtag(hashtag)
+	}
+
+	note.SetActivityStreamsTag(tag)
+
+	// address mentioned actors
+
+	cc := note.GetActivityStreamsCc()
+	if cc == nil {
+		cc = streams.NewActivityStreamsCcProperty()
+	}
+
+	addressed := prop.IRIs(note, "to", "cc")
+
+	for _, m := range p.Mentions {
+		if !util.UrlIn(m.Href, addressed) {
+			cc.AppendIRI(m.Href)
+			addressed = append(addressed, m.Href)
+		}
+	}
+
+	note.SetActivityStreamsCc(cc)
+}
+
+func href(iri *url.URL) vocab.ActivityStreamsHrefProperty {
+	p := streams.NewActivityStreamsHrefProperty()
+	p.Set(iri)
+	return p
+}
+
+func name(s string) vocab.ActivityStreamsNameProperty {
+	p := streams.NewActivityStreamsNameProperty()
+	p.AppendXMLSchemaString(s)
+	return p
+}
@@ -9,6 +9,20 @@ import (
 	"sync"
 )
 
+// How deep to look into received activities for inbox forwarding
+// if nothing else is configured.
+const _DEFAULT_FORWARDING_DEPTH = 4
+
+// Where uploaded files are kept if nothing else is configured.
+const _DEFAULT_MEDIA_DIRECTORY = "/var/tmp/fed-media"
+
+// Where remote files are cached if nothing else is configured.
+const _DEFAULT_MEDIA_CACHE_DIRECTORY = "/var/tmp/fed-cache"
+
+// How many megabytes the cache of remote files may take up if
+// nothing else is configured.
+const _DEFAULT_MEDIA_CACHE_QUOTA = 512
+
 type FedConfig struct {
 	// Hostname under which the instance is reachable in the
 	// open web. Something like "fed.example.com"
@@ -22,6 +36,63 @@ type FedConfig struct {
 	// will need rw permissions on that file and the directory
 	// it is in.
 	StorageFile string
+
+	// Directory uploaded files are kept in. The process running
+	// fed will need rw permissions on that directory. If empty, a
+	// default is used.
+	MediaDirectory string
+
+	// Directory remote files shown in the web interface are cached
+	// in. If empty, a default is used.
+	MediaCacheDirectory string
+
+	// How many megabytes the cache of remote files may take up.
+	// Least recently used files are evicted first. If zero, a
+	// default is used.
+	MediaCacheQuota int64
+
+	// Secret the cookies of the web interface are encrypted with.
+	// If empty, a random secret is used and users have to log in
+	// again after each restart.
+	CookieSecret string
+
+	// If set, requests with HTTP basic authentication are not
+	// accepted. Clients have to use OAuth tokens instead.
+	DisableBasicAuth bool
+
+	// File failed login attempts are written to s.t. lockouts
+	// survive a restart. If empty, they are only kept in memory.
+	ThrottleFile string
+
+	// Header that contains the address of clients, e.g.
+	// "X-Forwarded-For" if fed runs behind a reverse proxy. If
+	// empty, the address of the connection is used.
+	ClientAddressHeader string
+
+	// Usernames of users that may administrate the instance, e.g.
+	// manage domain blocks with the admin API.
+	Admins []string
+
+	// Domains blocked on the whole instance. More blocks can be
+	// added at runtime with the admin API.
+	DomainBlocks []DomainBlock
+
+	// How deep to look into activities received in an inbox to
+	// decide whether they need to be forwarded, e.g. how far to
+	// follow a chain of replies. If zero, a default is used.
+	MaxForwardingDepth int
+}
+
+// An instance-wide block of a domain as it is written in the
+// configuration file.
+type DomainBlock struct {
+	// The domain to block, e.g. "spam.example". Subdomains are
+	// blocked as well.
+	Domain string
+
+	// One of "reject", "silence" or "media". If empty, "reject"
+	// is assumed.
+	Severity string
 }
 
 // Pointer to the singelton instance of the global config.
@@ -44,6 +115,58 @@ func (fc *FedConfig) GlobalURL() *url.URL {
 	}
 }
 
+// Return whether the user with given username is an administrator of
+// this instance.
+func (fc *FedConfig) IsAdmin(username string) bool {
+	for _, admin := range fc.Admins {
+		if admin == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the MaxForwardingDepth property. If it is not set, a sane
+// default is returned. We never allow unlimited recursion.
+func (fc *FedConfig) ForwardingDepth() int {
+	if fc.MaxForwardingDepth > 0 {
+		return fc.MaxForwardingDepth
+	} else {
+		return _DEFAULT_FORWARDING_DEPTH
+	}
+}
+
+// Return the MediaDirectory property. If it is not set, a default
+// is returned.
+func (fc *FedConfig) MediaPath() string {
+	if fc.MediaDirectory != "" {
+		return fc.MediaDirectory
+	} else {
+		return _DEFAULT_MEDIA_DIRECTORY
+	}
+}
+
+// Return the MediaCacheDirectory property. If it is not set, a default
+// is returned.
+func (fc *FedConfig) MediaCachePath() string {
+	if fc.MediaCacheDirectory != "" {
+		return fc.MediaCacheDirectory
+	} else {
+		return _DEFAULT_MEDIA_CACHE_DIRECTORY
+	}
+}
+
+// Return the MediaCacheQuota property in bytes. If it is not set, a
+// default is returned.
+func (fc *FedConfig) MediaCacheSize() int64 {
+	if fc.MediaCacheQuota > 0 {
+		return fc.MediaCacheQuota << 20
+	} else {
+		return _DEFAULT_MEDIA_CACHE_QUOTA << 20
+	}
+}
+
 // Fill in the singleton global or stop the program on failure.
 func fillInSingleton() {
 	filename := "doc/fed.conf"
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/template"
+	"log"
+	"net/http"
+)
+
+// Wrap web handler h s.t. it is only called if the request carries
+// the CSRF token of the session. Other requests are answered with
+// an error page.
+func RequireCSRF(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fedcontext.CheckCSRF(r); err != nil {
+			log.Printf("rejecting request to %v: %v", r.URL, err)
+			template.Error(w, r, http.StatusForbidden, err, nil)
+			return
+		}
+
+		h(w, r)
+	}
+}
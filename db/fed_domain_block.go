@@ -0,0 +1,59 @@
+package db
+
+import (
+	"github.com/kissen/fed/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How harshly we treat a blocked domain.
+type Severity string
+
+const (
+	// Reject all activities from the domain and do not deliver
+	// anything to it.
+	REJECT Severity = "reject"
+
+	// Accept activities from the domain, but only show them to
+	// users that follow the author.
+	SILENCE Severity = "silence"
+
+	// Accept activities from the domain, but drop all media
+	// attached to them.
+	REJECT_MEDIA Severity = "media"
+)
+
+// Parse s into a Severity. The empty string is interpreted as REJECT.
+func ParseSeverity(s string) (Severity, error) {
+	switch severity := Severity(strings.ToLower(strings.TrimSpace(s))); severity {
+	case "":
+		return REJECT, nil
+	case REJECT, SILENCE, REJECT_MEDIA:
+		return severity, nil
+	default:
+		return "", errors.NewfWith(http.StatusBadRequest, "unknown severity=%v", s)
+	}
+}
+
+// An instance-wide block of a whole domain.
+type FedDomainBlock struct {
+	Domain    string
+	Severity  Severity
+	CreatedOn time.Time
+}
+
+// Create a new block for domain with given severity.
+func NewFedDomainBlock(domain string, severity Severity) *FedDomainBlock {
+	return &FedDomainBlock{
+		Domain:    NormalizeDomain(domain),
+		Severity:  severity,
+		CreatedOn: time.Now().UTC(),
+	}
+}
+
+// Return domain in the form we use for comparisons and as key in
+// storage.
+func NormalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSpace(domain))
+}
@@ -1,6 +1,9 @@
 package db
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/go-fed/activity/streams/vocab"
@@ -21,7 +24,13 @@ const _READ_WRITE = true
 var _USERS_BUCKET = []byte("Users")
 var _CODES_BUCKET = []byte("OAuth/Codes")
 var _TOKENS_BUCKET = []byte("OAuth/Tokens")
+var _REFRESH_TOKENS_BUCKET = []byte("OAuth/RefreshTokens")
+var _USER_TOKENS_BUCKET = []byte("OAuth/UserTokens")
+var _CLIENTS_BUCKET = []byte("OAuth/Clients")
 var _DOCUMENTS_BUCKET = []byte("Documents")
+var _REVISIONS_BUCKET = []byte("Revisions")
+var _MEDIA_BUCKET = []byte("Media")
+var _DOMAIN_BLOCKS_BUCKET = []byte("Blocks/Domains")
 
 type FedEmbeddedStorage struct {
 	Filepath   string
@@ -62,7 +71,9 @@ func (fs *FedEmbeddedStorage) Open() (err error) {
 
 	err = fs.connection.Update(func(tx *bbolt.Tx) error {
 		buckets := [][]byte{
-			_USERS_BUCKET, _CODES_BUCKET, _TOKENS_BUCKET, _DOCUMENTS_BUCKET,
+			_USERS_BUCKET, _CODES_BUCKET, _TOKENS_BUCKET, _CLIENTS_BUCKET,
+			_DOCUMENTS_BUCKET, _REVISIONS_BUCKET, _MEDIA_BUCKET,
+			_DOMAIN_BLOCKS_BUCKET, _REFRESH_TOKENS_BUCKET, _USER_TOKENS_BUCKET,
 		}
 
 		for _, bucket := range buckets {
@@ -71,7 +82,10 @@ func (fs *FedEmbeddedStorage) Open() (err error) {
 			}
 		}
 
-		return nil
+		// databases created before tokens were indexed need
+		// their indices filled in
+
+		return indexTokens(tx)
 	})
 
 	if err != nil {
@@ -145,6 +159,17 @@ func (fs *FedEmbeddedStorage) StoreUser(user *FedUser) error {
 	}
 }
 
+func (fs *FedEmbeddedStorage) RetrieveUsers() ([]*FedUser, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if users, err := tx.RetrieveUsers(); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return users, tx.Commit()
+	}
+}
+
 func (fs *FedEmbeddedStorage) RetrieveCode(code string) (*FedOAuthCode, error) {
 	if tx, err := fs.Begin(); err != nil {
 		return nil, err
@@ -167,6 +192,28 @@ func (fs *FedEmbeddedStorage) StoreCode(code *FedOAuthCode) error {
 	}
 }
 
+func (fs *FedEmbeddedStorage) DeleteCode(code string) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.DeleteCode(code); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) TakeCode(code string) (*FedOAuthCode, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if oc, err := tx.TakeCode(code); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return oc, tx.Commit()
+	}
+}
+
 func (fs *FedEmbeddedStorage) RetrieveToken(token string) (*FedOAuthToken, error) {
 	if tx, err := fs.Begin(); err != nil {
 		return nil, err
@@ -189,6 +236,83 @@ func (fs *FedEmbeddedStorage) StoreToken(token *FedOAuthToken) error {
 	}
 }
 
+func (fs *FedEmbeddedStorage) DeleteToken(token string) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.DeleteToken(token); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveTokens() ([]*FedOAuthToken, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if tokens, err := tx.RetrieveTokens(); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return tokens, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveTokenByRefresh(refresh string) (*FedOAuthToken, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if ot, err := tx.RetrieveTokenByRefresh(refresh); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return ot, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveUserTokens(username string) ([]*FedOAuthToken, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if tokens, err := tx.RetrieveUserTokens(username); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return tokens, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RotateToken(old string, token *FedOAuthToken) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.RotateToken(old, token); err != nil {
+		tx.Rollback()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveClient(id string) (*FedOAuthClient, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if client, err := tx.RetrieveClient(id); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return client, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) StoreClient(client *FedOAuthClient) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.StoreClient(client); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
 func (fs *FedEmbeddedStorage) RetrieveObject(iri *url.URL) (obj vocab.Type, err error) {
 	if tx, err := fs.Begin(); err != nil {
 		return nil, err
@@ -222,6 +346,83 @@ func (fs *FedEmbeddedStorage) DeleteObject(iri *url.URL) error {
 	}
 }
 
+func (fs *FedEmbeddedStorage) RetrieveRevisions(iri *url.URL) ([]vocab.Type, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if revisions, err := tx.RetrieveRevisions(iri); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return revisions, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) StoreRevision(iri *url.URL, obj vocab.Type) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.StoreRevision(iri, obj); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveMedia(id string) (*FedMedia, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if media, err := tx.RetrieveMedia(id); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return media, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) StoreMedia(media *FedMedia) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.StoreMedia(media); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) RetrieveDomainBlocks() ([]*FedDomainBlock, error) {
+	if tx, err := fs.Begin(); err != nil {
+		return nil, err
+	} else if blocks, err := tx.RetrieveDomainBlocks(); err != nil {
+		tx.Commit()
+		return nil, err
+	} else {
+		return blocks, tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) StoreDomainBlock(block *FedDomainBlock) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.StoreDomainBlock(block); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
+func (fs *FedEmbeddedStorage) DeleteDomainBlock(domain string) error {
+	if tx, err := fs.Begin(); err != nil {
+		return err
+	} else if err := tx.DeleteDomainBlock(domain); err != nil {
+		tx.Commit()
+		return err
+	} else {
+		return tx.Commit()
+	}
+}
+
 // Keep garbage collecting the database.
 func (fs *FedEmbeddedStorage) gcLoop() {
 	for !fs.closed {
@@ -249,12 +450,12 @@ func (fs *FedEmbeddedStorage) gc() (err error) {
 
 	etx := tx.(*fedembeddedtx)
 
-	if err := fs.gcBucket(etx, _CODES_BUCKET); err != nil {
-		err = errors.Wrap(err, "code garbage collection failed")
+	if cerr := fs.gcBucket(etx, _CODES_BUCKET); cerr != nil {
+		err = errors.Wrap(cerr, "code garbage collection failed")
 	}
 
-	if err := fs.gcBucket(etx, _TOKENS_BUCKET); err != nil {
-		err = errors.Wrap(err, "token garbage collection failed")
+	if terr := fs.gcTokens(etx); terr != nil {
+		err = errors.Wrap(terr, "token garbage collection failed")
 	}
 
 	return err
@@ -326,6 +527,46 @@ func (fs *FedEmbeddedStorage) gcBucket(tx *fedembeddedtx, bucket []byte) (err er
 	})
 }
 
+// Delete all expired tokens together with their index entries. Only
+// call this method if you are holding the write lock.
+func (fs *FedEmbeddedStorage) gcTokens(tx *fedembeddedtx) error {
+	return tx.update(func(tx *bbolt.Tx) error {
+		var b *bbolt.Bucket
+
+		if b = tx.Bucket(_TOKENS_BUCKET); b == nil {
+			return fmt.Errorf("cannot open bucket=%v", string(_TOKENS_BUCKET))
+		}
+
+		var expired []string
+
+		err := b.ForEach(func(key, value []byte) error {
+			var ot FedOAuthToken
+
+			if err := json.Unmarshal(value, &ot); err != nil {
+				return errors.Wrapf(err, "deserializing token=%v failed", redact(string(key)))
+			}
+
+			if ot.Expired() {
+				expired = append(expired, ot.Token)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return errors.Wrap(err, "error while trying to determine expired tokens")
+		}
+
+		for _, token := range expired {
+			if _, err := deleteToken(tx, token); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func (fs *fedembeddedtx) Commit() (err error) {
 	log.Println("Commit()")
 
@@ -402,6 +643,29 @@ func (fs *fedembeddedtx) StoreUser(user *FedUser) error {
 	return fs.store(_USERS_BUCKET, user.Name, bytes)
 }
 
+func (fs *fedembeddedtx) RetrieveUsers() (users []*FedUser, err error) {
+	log.Println("RetrieveUsers()")
+
+	err = fs.view(func(tx *bbolt.Tx) error {
+		var b *bbolt.Bucket
+
+		if b = tx.Bucket(_USERS_BUCKET); b == nil {
+			return fmt.Errorf("cannot open bucket=%v", string(_USERS_BUCKET))
+		}
+
+		return b.ForEach(func(key, value []byte) error {
+			if user, err := bytesToUser(value); err != nil {
+				return errors.Wrapf(err, "deserializing user=%v failed", string(key))
+			} else {
+				users = append(users, user)
+				return nil
+			}
+		})
+	})
+
+	return users, err
+}
+
 func (fs *fedembeddedtx) RetrieveCode(code string) (*FedOAuthCode, error) {
 	log.Printf("RetrieveCode(%s)", code)
 
@@ -429,12 +693,72 @@ func (fs *fedembeddedtx) StoreCode(code *FedOAuthCode) error {
 	return fs.store(_CODES_BUCKET, code.Code, bs)
 }
 
+func (fs *fedembeddedtx) DeleteCode(code string) error {
+	log.Printf("DeleteCode(%s)", code)
+
+	return fs.update(func(tx *bbolt.Tx) error {
+		var bucket *bbolt.Bucket
+
+		if bucket = tx.Bucket(_CODES_BUCKET); bucket == nil {
+			return errors.New("could not open codes bucket")
+		}
+
+		if err := bucket.Delete([]byte(code)); err != nil {
+			return errors.Wrap(err, "delete from bucket failed")
+		}
+
+		return nil
+	})
+}
+
+func (fs *fedembeddedtx) TakeCode(code string) (*FedOAuthCode, error) {
+	log.Printf("TakeCode(%s)", redact(code))
+
+	var bs []byte
+
+	// look up and delete in the same write transaction s.t.
+	// concurrent requests cannot both get the code
+
+	err := fs.update(func(tx *bbolt.Tx) error {
+		var bucket *bbolt.Bucket
+
+		if bucket = tx.Bucket(_CODES_BUCKET); bucket == nil {
+			return errors.New("could not open codes bucket")
+		}
+
+		value := bucket.Get([]byte(code))
+		if value == nil {
+			return errors.NewWith(http.StatusNotFound, "no such code")
+		}
+
+		// value is only valid during the transaction
+		bs = append([]byte(nil), value...)
+
+		if err := bucket.Delete([]byte(code)); err != nil {
+			return errors.Wrap(err, "delete from bucket failed")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var c FedOAuthCode
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, errors.Wrap(err, "deserializing code failed")
+	}
+
+	return &c, nil
+}
+
 func (fs *fedembeddedtx) RetrieveToken(token string) (*FedOAuthToken, error) {
-	log.Printf("RetrieveToken(%s)", token)
+	log.Printf("RetrieveToken(%s)", redact(token))
 
 	bs, err := fs.retrieve(_TOKENS_BUCKET, token)
 	if err != nil {
-		return nil, err
+		return nil, errors.NewWith(http.StatusNotFound, "no such token")
 	}
 
 	var c FedOAuthToken
@@ -446,14 +770,141 @@ func (fs *fedembeddedtx) RetrieveToken(token string) (*FedOAuthToken, error) {
 }
 
 func (fs *fedembeddedtx) StoreToken(token *FedOAuthToken) error {
-	log.Printf("StoreToken(Token=%v)", token.Token)
+	log.Printf("StoreToken(Token=%v)", redact(token.Token))
+
+	return fs.update(func(tx *bbolt.Tx) error {
+		// an existing token might have had another refresh token
+		// we need to remove from the index
+
+		if _, err := deleteToken(tx, token.Token); err != nil {
+			return err
+		}
+
+		return putToken(tx, token)
+	})
+}
+
+func (fs *fedembeddedtx) DeleteToken(token string) error {
+	log.Printf("DeleteToken(%s)", redact(token))
+
+	return fs.update(func(tx *bbolt.Tx) error {
+		_, err := deleteToken(tx, token)
+		return err
+	})
+}
+
+func (fs *fedembeddedtx) RetrieveTokenByRefresh(refresh string) (*FedOAuthToken, error) {
+	log.Printf("RetrieveTokenByRefresh(%s)", redact(refresh))
 
-	bs, err := json.Marshal(token)
+	token, err := fs.retrieve(_REFRESH_TOKENS_BUCKET, refresh)
 	if err != nil {
-		return errors.Wrap(err, "serializing token failed")
+		return nil, errors.NewWith(http.StatusNotFound, "no such refresh token")
+	}
+
+	return fs.RetrieveToken(string(token))
+}
+
+func (fs *fedembeddedtx) RetrieveUserTokens(username string) (tokens []*FedOAuthToken, err error) {
+	log.Printf("RetrieveUserTokens(%s)", username)
+
+	var keys []string
+
+	err = fs.view(func(tx *bbolt.Tx) error {
+		var b *bbolt.Bucket
+
+		if b = tx.Bucket(_USER_TOKENS_BUCKET); b == nil {
+			return fmt.Errorf("cannot open bucket=%v", string(_USER_TOKENS_BUCKET))
+		}
+
+		prefix := userTokenPrefix(username)
+		c := b.Cursor()
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			keys = append(keys, string(v))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return fs.store(_TOKENS_BUCKET, token.Token, bs)
+	for _, key := range keys {
+		if ot, err := fs.RetrieveToken(key); err != nil {
+			return nil, err
+		} else {
+			tokens = append(tokens, ot)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (fs *fedembeddedtx) RotateToken(old string, token *FedOAuthToken) error {
+	log.Printf("RotateToken(%s, Token=%v)", redact(old), redact(token.Token))
+
+	return fs.update(func(tx *bbolt.Tx) error {
+		if found, err := deleteToken(tx, old); err != nil {
+			return err
+		} else if !found {
+			return errors.NewWith(http.StatusNotFound, "token to replace does not exist")
+		}
+
+		return putToken(tx, token)
+	})
+}
+
+func (fs *fedembeddedtx) RetrieveTokens() (tokens []*FedOAuthToken, err error) {
+	log.Println("RetrieveTokens()")
+
+	err = fs.view(func(tx *bbolt.Tx) error {
+		var b *bbolt.Bucket
+
+		if b = tx.Bucket(_TOKENS_BUCKET); b == nil {
+			return fmt.Errorf("cannot open bucket=%v", string(_TOKENS_BUCKET))
+		}
+
+		return b.ForEach(func(key, value []byte) error {
+			var ot FedOAuthToken
+
+			if err := json.Unmarshal(value, &ot); err != nil {
+				return errors.Wrapf(err, "deserializing token=%v failed", string(key))
+			}
+
+			tokens = append(tokens, &ot)
+			return nil
+		})
+	})
+
+	return tokens, err
+}
+
+func (fs *fedembeddedtx) RetrieveClient(id string) (*FedOAuthClient, error) {
+	log.Printf("RetrieveClient(%s)", id)
+
+	bs, err := fs.retrieve(_CLIENTS_BUCKET, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var c FedOAuthClient
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, errors.Wrap(err, "deserializing client failed")
+	}
+
+	return &c, nil
+}
+
+func (fs *fedembeddedtx) StoreClient(client *FedOAuthClient) error {
+	log.Printf("StoreClient(Id=%v Name=%v)", client.Id, client.Name)
+
+	bs, err := json.Marshal(client)
+	if err != nil {
+		return errors.Wrap(err, "serializing client failed")
+	}
+
+	return fs.store(_CLIENTS_BUCKET, client.Id, bs)
 }
 
 func (fs *fedembeddedtx) RetrieveObject(iri *url.URL) (obj vocab.Type, err error) {
@@ -503,6 +954,146 @@ func (fs *fedembeddedtx) DeleteObject(iri *url.URL) error {
 	})
 }
 
+func (fs *fedembeddedtx) RetrieveRevisions(iri *url.URL) (revisions []vocab.Type, err error) {
+	log.Printf("RetrieveRevisions(%v)", iri)
+
+	raws, err := fs.retrieveRevisions(iri)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, raw := range raws {
+		if obj, err := marshal.BytesToVocab(raw); err != nil {
+			return nil, errors.Wrapf(err, "deserializing revision=%v failed", i)
+		} else {
+			revisions = append(revisions, obj)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (fs *fedembeddedtx) StoreRevision(iri *url.URL, obj vocab.Type) error {
+	log.Printf("StoreRevision(%v)", iri)
+
+	raws, err := fs.retrieveRevisions(iri)
+	if err != nil {
+		return err
+	}
+
+	raw, err := marshal.VocabToBytes(obj)
+	if err != nil {
+		return errors.Wrap(err, "could not serialize revision")
+	}
+
+	bs, err := json.Marshal(append(raws, json.RawMessage(raw)))
+	if err != nil {
+		return errors.Wrap(err, "could not serialize revisions")
+	}
+
+	return fs.store(_REVISIONS_BUCKET, fs.toKey(iri), bs)
+}
+
+// Return the serialized revisions of the object at iri. Returns
+// an empty slice if there are no revisions.
+func (fs *fedembeddedtx) retrieveRevisions(iri *url.URL) (raws []json.RawMessage, err error) {
+	bs, err := fs.retrieve(_REVISIONS_BUCKET, fs.toKey(iri))
+	if status, ok := errors.Status(err); ok && status == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bs, &raws); err != nil {
+		return nil, errors.Wrap(err, "deserializing revisions failed")
+	}
+
+	return raws, nil
+}
+
+func (fs *fedembeddedtx) RetrieveMedia(id string) (*FedMedia, error) {
+	log.Printf("RetrieveMedia(%v)", id)
+
+	bs, err := fs.retrieve(_MEDIA_BUCKET, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var m FedMedia
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, errors.Wrap(err, "deserializing media failed")
+	}
+
+	return &m, nil
+}
+
+func (fs *fedembeddedtx) StoreMedia(media *FedMedia) error {
+	log.Printf("StoreMedia(Id=%v MediaType=%v)", media.Id, media.MediaType)
+
+	bs, err := json.Marshal(media)
+	if err != nil {
+		return errors.Wrap(err, "serializing media failed")
+	}
+
+	return fs.store(_MEDIA_BUCKET, media.Id, bs)
+}
+
+func (fs *fedembeddedtx) RetrieveDomainBlocks() (blocks []*FedDomainBlock, err error) {
+	log.Println("RetrieveDomainBlocks()")
+
+	err = fs.view(func(tx *bbolt.Tx) error {
+		var b *bbolt.Bucket
+
+		if b = tx.Bucket(_DOMAIN_BLOCKS_BUCKET); b == nil {
+			return fmt.Errorf("cannot open bucket=%v", string(_DOMAIN_BLOCKS_BUCKET))
+		}
+
+		return b.ForEach(func(key, value []byte) error {
+			var block FedDomainBlock
+
+			if err := json.Unmarshal(value, &block); err != nil {
+				return errors.Wrapf(err, "deserializing block=%v failed", string(key))
+			}
+
+			blocks = append(blocks, &block)
+			return nil
+		})
+	})
+
+	return blocks, err
+}
+
+func (fs *fedembeddedtx) StoreDomainBlock(block *FedDomainBlock) error {
+	log.Printf("StoreDomainBlock(Domain=%v Severity=%v)", block.Domain, block.Severity)
+
+	bs, err := json.Marshal(block)
+	if err != nil {
+		return errors.Wrap(err, "serializing block failed")
+	}
+
+	return fs.store(_DOMAIN_BLOCKS_BUCKET, NormalizeDomain(block.Domain), bs)
+}
+
+func (fs *fedembeddedtx) DeleteDomainBlock(domain string) error {
+	log.Printf("DeleteDomainBlock(%v)", domain)
+
+	return fs.update(func(tx *bbolt.Tx) error {
+		var bucket *bbolt.Bucket
+
+		if bucket = tx.Bucket(_DOMAIN_BLOCKS_BUCKET); bucket == nil {
+			return errors.New("could not open domain blocks bucket")
+		}
+
+		key := []byte(NormalizeDomain(domain))
+
+		if err := bucket.Delete(key); err != nil {
+			return errors.Wrap(err, "delete from bucket failed")
+		}
+
+		return nil
+	})
+}
+
 // Return a bbolt key that should be associated with iri.
 func (fs *fedembeddedtx) toKey(iri *url.URL) string {
 	var target url.URL
@@ -571,3 +1162,96 @@ func (fs *fedembeddedtx) update(operation func(tx *bbolt.Tx) error) (err error)
 
 	return operation(fs.btx)
 }
+
+// Write token ot into the tokens bucket and add it to the indices.
+func putToken(tx *bbolt.Tx, ot *FedOAuthToken) error {
+	bs, err := json.Marshal(ot)
+	if err != nil {
+		return errors.Wrap(err, "serializing token failed")
+	}
+
+	if err := tx.Bucket(_TOKENS_BUCKET).Put([]byte(ot.Token), bs); err != nil {
+		return errors.Wrap(err, "put token failed")
+	}
+
+	return indexToken(tx, ot)
+}
+
+// Add ot to the indices of refresh tokens and tokens per user.
+func indexToken(tx *bbolt.Tx, ot *FedOAuthToken) error {
+	if ot.RefreshToken != "" {
+		if err := tx.Bucket(_REFRESH_TOKENS_BUCKET).Put([]byte(ot.RefreshToken), []byte(ot.Token)); err != nil {
+			return errors.Wrap(err, "put refresh token failed")
+		}
+	}
+
+	if err := tx.Bucket(_USER_TOKENS_BUCKET).Put(userTokenKey(ot), []byte(ot.Token)); err != nil {
+		return errors.Wrap(err, "put user token failed")
+	}
+
+	return nil
+}
+
+// Delete token from the tokens bucket and from the indices. Returns
+// whether there was such a token.
+func deleteToken(tx *bbolt.Tx, token string) (bool, error) {
+	tokens := tx.Bucket(_TOKENS_BUCKET)
+
+	value := tokens.Get([]byte(token))
+	if value == nil {
+		return false, nil
+	}
+
+	var ot FedOAuthToken
+	if err := json.Unmarshal(value, &ot); err != nil {
+		return false, errors.Wrap(err, "deserializing token failed")
+	}
+
+	if ot.RefreshToken != "" {
+		if err := tx.Bucket(_REFRESH_TOKENS_BUCKET).Delete([]byte(ot.RefreshToken)); err != nil {
+			return false, errors.Wrap(err, "delete refresh token failed")
+		}
+	}
+
+	if err := tx.Bucket(_USER_TOKENS_BUCKET).Delete(userTokenKey(&ot)); err != nil {
+		return false, errors.Wrap(err, "delete user token failed")
+	}
+
+	if err := tokens.Delete([]byte(token)); err != nil {
+		return false, errors.Wrap(err, "delete token failed")
+	}
+
+	return true, nil
+}
+
+// Add all tokens to the indices. Adding a token twice does no harm.
+func indexTokens(tx *bbolt.Tx) error {
+	return tx.Bucket(_TOKENS_BUCKET).ForEach(func(key, value []byte) error {
+		var ot FedOAuthToken
+
+		if err := json.Unmarshal(value, &ot); err != nil {
+			return errors.Wrapf(err, "deserializing token=%v failed", redact(string(key)))
+		}
+
+		return indexToken(tx, &ot)
+	})
+}
+
+// Return the key of ot in the index of tokens per user.
+func userTokenKey(ot *FedOAuthToken) []byte {
+	return append(userTokenPrefix(ot.Username), ot.Token...)
+}
+
+// Return the prefix all keys of tokens of username share in the index
+// of tokens per user. Usernames cannot contain NUL, so no prefix is
+// the prefix of another.
+func userTokenPrefix(username string) []byte {
+	return []byte(username + "\x00")
+}
+
+// Return a short hash of secret that can be written to logs. It is
+// enough to tell secrets apart, but not to use them.
+func redact(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
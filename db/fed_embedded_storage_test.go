@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func dbPath(t *testing.T) string {
@@ -232,3 +233,405 @@ func TestStoreAndRetrieveNote(t *testing.T) {
 		t.Errorf("got bad content expected=%v got=%v", origName, parsedName)
 	}
 }
+
+func TestRetrieveUsers(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	// put users
+
+	for _, name := range []string{"alice", "bob"} {
+		if err := storage.StoreUser(&FedUser{Name: name}); err != nil {
+			t.Fatalf("storing new user failed err=%v", err)
+		}
+	}
+
+	// get all users
+
+	users, err := storage.RetrieveUsers()
+	if err != nil {
+		t.Fatalf("retrieving users failed err=%v", err)
+	}
+
+	if count := len(users); count != 2 {
+		t.Fatalf("bad number of users expected=2 got=%v", count)
+	}
+
+	if users[0].Name != "alice" || users[1].Name != "bob" {
+		t.Errorf("got bad users expected=[alice bob] got=[%v %v]", users[0].Name, users[1].Name)
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
+
+func TestDomainBlocks(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	// put blocks; the second one overwrites the first
+
+	for _, severity := range []Severity{SILENCE, REJECT} {
+		if err := storage.StoreDomainBlock(NewFedDomainBlock("Spam.Example", severity)); err != nil {
+			t.Fatalf("storing block failed err=%v", err)
+		}
+	}
+
+	blocks, err := storage.RetrieveDomainBlocks()
+	if err != nil {
+		t.Fatalf("retrieving blocks failed err=%v", err)
+	}
+
+	if count := len(blocks); count != 1 {
+		t.Fatalf("bad number of blocks expected=1 got=%v", count)
+	}
+
+	if blocks[0].Domain != "spam.example" || blocks[0].Severity != REJECT {
+		t.Errorf("got bad block expected={spam.example reject} got=%v", *blocks[0])
+	}
+
+	// remove block again
+
+	if err := storage.DeleteDomainBlock("spam.example"); err != nil {
+		t.Fatalf("deleting block failed err=%v", err)
+	}
+
+	if blocks, err := storage.RetrieveDomainBlocks(); err != nil {
+		t.Fatalf("retrieving blocks failed err=%v", err)
+	} else if len(blocks) != 0 {
+		t.Errorf("expected no blocks got=%v", blocks)
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	iri := toUrl(t, "https://example.com/poetry/emily/july")
+
+	// without revisions we get an empty slice
+
+	if revisions, err := storage.RetrieveRevisions(iri); err != nil {
+		t.Fatalf("retrieving revisions failed err=%v", err)
+	} else if len(revisions) != 0 {
+		t.Errorf("expected no revisions got=%v", revisions)
+	}
+
+	// put two revisions
+
+	for i := 0; i < 2; i++ {
+		if err := storage.StoreRevision(iri, testNote(t)); err != nil {
+			t.Fatalf("storing revision failed err=%v", err)
+		}
+	}
+
+	revisions, err := storage.RetrieveRevisions(iri)
+	if err != nil {
+		t.Fatalf("retrieving revisions failed err=%v", err)
+	}
+
+	if count := len(revisions); count != 2 {
+		t.Fatalf("bad number of revisions expected=2 got=%v", count)
+	}
+
+	if name := prop.Name(revisions[1]); name != prop.Name(testNote(t)) {
+		t.Errorf("got bad revision name=%v", name)
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
+
+func TestMedia(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	// unknown ids are an error
+
+	if _, err := storage.RetrieveMedia("nope"); err == nil {
+		t.Errorf("expected error for unknown media")
+	}
+
+	// put metadata and read it back
+
+	m := NewFedMedia("emily", "image/png", "a bird")
+	m.Width, m.Height = 640, 480
+
+	if err := storage.StoreMedia(m); err != nil {
+		t.Fatalf("storing media failed err=%v", err)
+	}
+
+	got, err := storage.RetrieveMedia(m.Id)
+	if err != nil {
+		t.Fatalf("retrieving media failed err=%v", err)
+	}
+
+	if got.Owner != "emily" || got.Name != "a bird" || got.Width != 640 || got.Height != 480 {
+		t.Errorf("got bad media expected=%v got=%v", *m, *got)
+	}
+
+	if kind := got.Kind(); kind != "Image" {
+		t.Errorf("bad kind expected=Image got=%v", kind)
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
+
+func TestClientsAndCodes(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	// register a client and read it back
+
+	client := NewFedOAuthClient("Toot", "", "https://example.com/cb  https://example.com/other", DEFAULT_SCOPE)
+
+	if err := storage.StoreClient(client); err != nil {
+		t.Fatalf("storing client failed err=%v", err)
+	}
+
+	got, err := storage.RetrieveClient(client.Id)
+	if err != nil {
+		t.Fatalf("retrieving client failed err=%v", err)
+	}
+
+	if !got.SecretOK(client.Secret) || got.SecretOK("nope") {
+		t.Errorf("bad secret check for client=%v", got.Id)
+	}
+
+	if !got.RedirectAllowed("https://example.com/other") || got.RedirectAllowed("https://evil.example.com/") {
+		t.Errorf("bad redirect uris=%v", got.RedirectURIs)
+	}
+
+	// issue a code with PKCE; the challenge belongs to the verifier
+	// from the example in RFC 7636
+
+	grant := FedOAuthGrant{
+		ClientId:        client.Id,
+		RedirectURI:     "https://example.com/cb",
+		Challenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		ChallengeMethod: PKCE_S256,
+	}
+
+	user := &FedUser{Name: "alice"}
+	user.SetPassword("secret")
+
+	if err := storage.StoreUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := NewFedOAuthCode("alice", grant, &storage)
+	if err != nil {
+		t.Fatalf("issuing code failed err=%v", err)
+	}
+
+	stored, err := storage.RetrieveCode(code.Code)
+	if err != nil {
+		t.Fatalf("retrieving code failed err=%v", err)
+	}
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	if err := stored.Verify(client.Id, grant.RedirectURI, verifier); err != nil {
+		t.Errorf("rejected good verifier err=%v", err)
+	}
+
+	if err := stored.Verify("other", grant.RedirectURI, verifier); err == nil {
+		t.Errorf("accepted code presented by other client")
+	}
+
+	if err := stored.Verify(client.Id, grant.RedirectURI, "wrong"); err == nil {
+		t.Errorf("accepted bad verifier")
+	}
+
+	// codes can be deleted
+
+	if err := storage.DeleteCode(code.Code); err != nil {
+		t.Fatalf("deleting code failed err=%v", err)
+	}
+
+	if _, err := storage.RetrieveCode(code.Code); err == nil {
+		t.Errorf("deleted code still around")
+	}
+
+	// taking a code works exactly once
+
+	code, err = NewFedOAuthCode("alice", grant, &storage)
+	if err != nil {
+		t.Fatalf("issuing code failed err=%v", err)
+	}
+
+	if taken, err := storage.TakeCode(code.Code); err != nil || taken.Code != code.Code {
+		t.Fatalf("taking code failed err=%v", err)
+	}
+
+	if _, err := storage.TakeCode(code.Code); err == nil {
+		t.Errorf("took code twice")
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
+
+func TestTokensAndRefresh(t *testing.T) {
+	storage := FedEmbeddedStorage{
+		Filepath: dbPath(t),
+	}
+
+	// create db
+
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open failed with err=%v", err)
+	}
+
+	defer deleteDbPath(t)
+
+	// issue a token with refresh token
+
+	ot, err := NewFedOAuthTokenFor("alice", "client", USER_SCOPE, &storage)
+	if err != nil {
+		t.Fatalf("issuing token failed err=%v", err)
+	}
+
+	if _, err := NewFedOAuthTokenFor("bob", "client", USER_SCOPE, &storage); err != nil {
+		t.Fatalf("issuing token failed err=%v", err)
+	}
+
+	found, err := RetrieveRefreshToken(ot.RefreshToken, &storage)
+	if err != nil || found.Token != ot.Token {
+		t.Fatalf("looking up refresh token failed err=%v", err)
+	}
+
+	// refreshing rotates both tokens but keeps the session
+
+	if _, err := found.Refresh(ADMIN_SCOPE, &storage); err == nil {
+		t.Errorf("refresh widened scope")
+	}
+
+	refreshed, err := found.Refresh(DEFAULT_SCOPE, &storage)
+	if err != nil {
+		t.Fatalf("refresh failed err=%v", err)
+	}
+
+	if refreshed.Id != ot.Id || refreshed.Token == ot.Token || refreshed.Scope != DEFAULT_SCOPE {
+		t.Errorf("bad refreshed token=%+v", refreshed)
+	}
+
+	if _, err := storage.RetrieveToken(ot.Token); err == nil {
+		t.Errorf("old token still around")
+	}
+
+	if _, err := RetrieveRefreshToken(ot.RefreshToken, &storage); err == nil {
+		t.Errorf("old refresh token still works")
+	}
+
+	if _, err := found.Refresh(DEFAULT_SCOPE, &storage); err == nil {
+		t.Errorf("refreshed same token twice")
+	}
+
+	// sessions are listed per user
+
+	sessions, err := RetrieveSessions("alice", &storage)
+	if err != nil {
+		t.Fatalf("listing sessions failed err=%v", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].Token != refreshed.Token {
+		t.Errorf("bad sessions=%v", sessions)
+	}
+
+	// expired tokens are collected together with their refresh
+	// tokens
+
+	expired := &FedOAuthToken{
+		Token:        "expired",
+		Username:     "alice",
+		IssuedOn:     time.Now().UTC().Add(-2 * _REFRESH_LIFETIME),
+		RefreshToken: "expired-refresh",
+	}
+
+	if err := storage.StoreToken(expired); err != nil {
+		t.Fatalf("storing token failed err=%v", err)
+	}
+
+	if err := storage.gc(); err != nil {
+		t.Fatalf("garbage collection failed err=%v", err)
+	}
+
+	if _, err := storage.RetrieveToken(expired.Token); err == nil {
+		t.Errorf("expired token still around")
+	}
+
+	if _, err := storage.RetrieveTokenByRefresh(expired.RefreshToken); err == nil {
+		t.Errorf("expired refresh token still around")
+	}
+
+	// finish
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close failed with err=%v", err)
+	}
+}
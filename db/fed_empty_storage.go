@@ -41,6 +41,10 @@ func (f FedEmptyStorage) StoreUser(user *FedUser) error {
 	return nil
 }
 
+func (f FedEmptyStorage) RetrieveUsers() ([]*FedUser, error) {
+	return nil, nil
+}
+
 func (f FedEmptyStorage) RetrieveCode(code string) (*FedOAuthCode, error) {
 	return nil, nil
 }
@@ -49,6 +53,14 @@ func (f FedEmptyStorage) StoreCode(code *FedOAuthCode) error {
 	return nil
 }
 
+func (f FedEmptyStorage) DeleteCode(code string) error {
+	return nil
+}
+
+func (f FedEmptyStorage) TakeCode(code string) (*FedOAuthCode, error) {
+	return nil, nil
+}
+
 func (f FedEmptyStorage) RetrieveToken(token string) (*FedOAuthToken, error) {
 	return nil, nil
 }
@@ -57,6 +69,34 @@ func (f FedEmptyStorage) StoreToken(token *FedOAuthToken) error {
 	return nil
 }
 
+func (f FedEmptyStorage) DeleteToken(token string) error {
+	return nil
+}
+
+func (f FedEmptyStorage) RetrieveTokens() ([]*FedOAuthToken, error) {
+	return nil, nil
+}
+
+func (f FedEmptyStorage) RetrieveTokenByRefresh(refresh string) (*FedOAuthToken, error) {
+	return nil, nil
+}
+
+func (f FedEmptyStorage) RetrieveUserTokens(username string) ([]*FedOAuthToken, error) {
+	return nil, nil
+}
+
+func (f FedEmptyStorage) RotateToken(old string, token *FedOAuthToken) error {
+	return nil
+}
+
+func (f FedEmptyStorage) RetrieveClient(id string) (*FedOAuthClient, error) {
+	return nil, errors.New("not found (simulated)")
+}
+
+func (f FedEmptyStorage) StoreClient(client *FedOAuthClient) error {
+	return nil
+}
+
 func (f FedEmptyStorage) RetrieveObject(iri *url.URL) (vocab.Type, error) {
 	return nil, errors.New("not found (simulated)")
 }
@@ -68,3 +108,31 @@ func (f FedEmptyStorage) StoreObject(iri *url.URL, obj vocab.Type) error {
 func (f FedEmptyStorage) DeleteObject(iri *url.URL) error {
 	return nil
 }
+
+func (f FedEmptyStorage) RetrieveRevisions(iri *url.URL) ([]vocab.Type, error) {
+	return nil, nil
+}
+
+func (f FedEmptyStorage) StoreRevision(iri *url.URL, obj vocab.Type) error {
+	return nil
+}
+
+func (f FedEmptyStorage) RetrieveMedia(id string) (*FedMedia, error) {
+	return nil, errors.New("not found (simulated)")
+}
+
+func (f FedEmptyStorage) StoreMedia(media *FedMedia) error {
+	return nil
+}
+
+func (f FedEmptyStorage) RetrieveDomainBlocks() ([]*FedDomainBlock, error) {
+	return nil, nil
+}
+
+func (f FedEmptyStorage) StoreDomainBlock(block *FedDomainBlock) error {
+	return nil
+}
+
+func (f FedEmptyStorage) DeleteDomainBlock(domain string) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Metadata of a file uploaded by a user. The file itself is kept
+// in a blob store, not in the database.
+type FedMedia struct {
+	// Identifies the file in the blob store and in media IRIs.
+	Id string
+
+	// Username of the user that uploaded the file.
+	Owner string
+
+	// MIME type of the file, e.g. "image/png".
+	MediaType string
+
+	// Description of the file for people that cannot see it.
+	Name string
+
+	// Dimensions of images in pixels. Zero if unknown.
+	Width  int
+	Height int
+
+	// Compact representation of a blurred version of images
+	// shown while the real image is loading. Empty if unknown.
+	Blurhash string
+
+	CreatedOn time.Time
+}
+
+// Create metadata for a new file uploaded by owner with a random id.
+func NewFedMedia(owner, mediaType, name string) *FedMedia {
+	return &FedMedia{
+		Id:        random(),
+		Owner:     owner,
+		MediaType: mediaType,
+		Name:      name,
+		CreatedOn: time.Now().UTC(),
+	}
+}
+
+// Return the ActivityStreams type that best describes the file,
+// that is one of "Image", "Video", "Audio" or "Document".
+func (m *FedMedia) Kind() string {
+	switch {
+	case strings.HasPrefix(m.MediaType, "image/"):
+		return "Image"
+	case strings.HasPrefix(m.MediaType, "video/"):
+		return "Video"
+	case strings.HasPrefix(m.MediaType, "audio/"):
+		return "Audio"
+	default:
+		return "Document"
+	}
+}
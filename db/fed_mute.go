@@ -0,0 +1,69 @@
+package db
+
+import (
+	"github.com/kissen/fed/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// What a mute matches on.
+type MuteKind string
+
+const (
+	// Mute everything posted or shared by an actor. The value of
+	// the mute is the IRI of that actor.
+	MUTE_ACTOR MuteKind = "actor"
+
+	// Mute a conversation. The value of the mute is the IRI of an
+	// object in that conversation.
+	MUTE_THREAD MuteKind = "thread"
+
+	// Mute everything that contains a keyword. The value of the
+	// mute is that keyword.
+	MUTE_KEYWORD MuteKind = "keyword"
+)
+
+// Parse s into a MuteKind.
+func ParseMuteKind(s string) (MuteKind, error) {
+	switch kind := MuteKind(strings.ToLower(strings.TrimSpace(s))); kind {
+	case MUTE_ACTOR, MUTE_THREAD, MUTE_KEYWORD:
+		return kind, nil
+	default:
+		return "", errors.NewfWith(http.StatusBadRequest, "unknown mute kind=%v", s)
+	}
+}
+
+// A rule that hides matching objects from the stream of a user.
+type FedMute struct {
+	// Identifies this mute; used when removing it again.
+	Id string
+
+	Kind  MuteKind
+	Value string
+
+	// After this point in time, the mute is not applied anymore.
+	// Might be nil in which case the mute never expires.
+	Expires *time.Time
+}
+
+// Create a new mute. If duration is zero, the mute never expires.
+func NewFedMute(kind MuteKind, value string, duration time.Duration) *FedMute {
+	mute := &FedMute{
+		Id:    random(),
+		Kind:  kind,
+		Value: strings.TrimSpace(value),
+	}
+
+	if duration > 0 {
+		expires := time.Now().UTC().Add(duration)
+		mute.Expires = &expires
+	}
+
+	return mute
+}
+
+// Return whether this mute is expired.
+func (m *FedMute) Expired() bool {
+	return m.Expires != nil && time.Now().UTC().After(*m.Expires)
+}
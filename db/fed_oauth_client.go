@@ -0,0 +1,64 @@
+package db
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+)
+
+// Redirect URI that tells us to show the code to the user instead of
+// redirecting anywhere. Used by clients that cannot receive redirects,
+// e.g. command line tools.
+const OOB_REDIRECT_URI = "urn:ietf:wg:oauth:2.0:oob"
+
+// An application registered to use the OAuth API of this instance.
+type FedOAuthClient struct {
+	Id     string
+	Secret string
+
+	// Human-readable name of the client, shown when authorizing.
+	Name string
+
+	// Homepage of the client. May be empty.
+	Website string
+
+	// The redirect URIs the client may use. Users are only ever
+	// sent back to these URIs after authorization.
+	RedirectURIs []string
+
+	// The most the client may ask for when requesting authorization.
+	Scope FedOAuthScope
+
+	CreatedOn time.Time
+}
+
+// Create a new client with random id and secret. Argument redirectURIs
+// is a list of URIs separated by white space.
+func NewFedOAuthClient(name, website, redirectURIs string, scope FedOAuthScope) *FedOAuthClient {
+	return &FedOAuthClient{
+		Id:           random(),
+		Secret:       random(),
+		Name:         strings.TrimSpace(name),
+		Website:      strings.TrimSpace(website),
+		RedirectURIs: strings.Fields(redirectURIs),
+		Scope:        scope,
+		CreatedOn:    time.Now().UTC(),
+	}
+}
+
+// Return whether uri is one of the redirect URIs registered for
+// this client.
+func (c *FedOAuthClient) RedirectAllowed(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if allowed == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether secret matches the secret of this client.
+func (c *FedOAuthClient) SecretOK(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) == 1
+}
@@ -1,6 +1,9 @@
 package db
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"time"
@@ -8,23 +11,47 @@ import (
 
 const _CODE_LIFETIME = 1 * time.Minute
 
+// The only PKCE method we support. The "plain" method is not
+// supported as it does not protect against anything we care about.
+const PKCE_S256 = "S256"
+
 type FedOAuthCode struct {
 	Code     string
 	Username string
 	IssuedOn time.Time
+
+	// The authorization request this code was issued for.
+	FedOAuthGrant
 }
 
-// If username/password are valid credentials, create a new
-// code, store it into target and return it.
-func NewFedOAuthCode(username, password string, target Storer) (*FedOAuthCode, error) {
-	if err := CheckCredentials(username, password, target); err != nil {
-		return nil, err
-	}
+// The parts of an authorization request a code is bound to. When the
+// code is exchanged for a token, the client has to present the same
+// values again.
+type FedOAuthGrant struct {
+	// Id of the client that requested authorization.
+	ClientId string
 
+	// Redirect URI the code was sent to.
+	RedirectURI string
+
+	// Scope the user agreed to.
+	Scope FedOAuthScope
+
+	// PKCE code challenge and the method it was created with.
+	// Both are empty if the client does not use PKCE.
+	Challenge       string
+	ChallengeMethod string
+}
+
+// Create a new code for username and grant, store it into target
+// and return it. Callers need to have checked the credentials of
+// username.
+func NewFedOAuthCode(username string, grant FedOAuthGrant, target Storer) (*FedOAuthCode, error) {
 	oc := &FedOAuthCode{
-		Code:     random(),
-		Username: username,
-		IssuedOn: time.Now().UTC(),
+		Code:          random(),
+		Username:      username,
+		IssuedOn:      time.Now().UTC(),
+		FedOAuthGrant: grant,
 	}
 
 	if err := target.StoreCode(oc); err != nil {
@@ -40,12 +67,52 @@ func (c *FedOAuthCode) Expired() bool {
 	return time.Now().UTC().After(end)
 }
 
+// Return whether this code may be exchanged by the client with
+// clientId that was redirected to redirectURI and presents PKCE
+// code verifier verifier. If the code was issued without PKCE,
+// verifier is ignored.
+func (c *FedOAuthCode) Verify(clientId, redirectURI, verifier string) error {
+	if c.Expired() {
+		return errors.New("code expired")
+	}
+
+	if c.ClientId != clientId {
+		return errors.New("code was issued to another client")
+	}
+
+	if c.RedirectURI != redirectURI {
+		return errors.New("redirect_uri does not match authorization request")
+	}
+
+	if c.Challenge == "" {
+		return nil
+	}
+
+	if verifier == "" {
+		return errors.New("missing code_verifier")
+	}
+
+	if c.ChallengeMethod != PKCE_S256 {
+		return errors.New("unsupported code_challenge_method")
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(c.Challenge)) != 1 {
+		return errors.New("code_verifier does not match code_challenge")
+	}
+
+	return nil
+}
+
 // Unmarshal override to avoid confusion with FedOAuthToken.
 func (c *FedOAuthCode) UnmarshalJSON(data []byte) error {
 	type Code struct {
 		Code     string
 		Username string
 		IssuedOn time.Time
+		FedOAuthGrant
 	}
 
 	var buf Code
@@ -61,6 +128,7 @@ func (c *FedOAuthCode) UnmarshalJSON(data []byte) error {
 	c.Code = buf.Code
 	c.Username = buf.Username
 	c.IssuedOn = buf.IssuedOn
+	c.FedOAuthGrant = buf.FedOAuthGrant
 
 	return nil
 }
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"github.com/kissen/fed/errors"
+	"net/http"
+	"strings"
+)
+
+// The scope clients get if they do not ask for anything else.
+const DEFAULT_SCOPE FedOAuthScope = "read"
+
+// The scope of sessions users start by logging in with their password,
+// that is everything except for administration.
+const USER_SCOPE FedOAuthScope = "read write follow push"
+
+// The scope of sessions administrators start by logging in with their
+// password.
+const ADMIN_SCOPE FedOAuthScope = USER_SCOPE + " admin:read admin:write"
+
+// Scopes that may be granted. Each of them may also be narrowed down
+// with a sub-scope, e.g. "write:statuses" only allows for posting.
+var _TOP_LEVEL_SCOPES = []string{
+	"read", "write", "follow", "push", "admin:read", "admin:write",
+}
+
+// The sub-scopes covered by the legacy follow scope.
+var _FOLLOW_SCOPES = []string{
+	"read:blocks", "write:blocks", "read:follows", "write:follows",
+	"read:mutes", "write:mutes",
+}
+
+// What a client may do with a token, written as space separated list
+// of scopes, e.g. "read write:statuses". Compatible with the scopes
+// of the Mastodon API.
+type FedOAuthScope string
+
+// Parse s into a scope. Duplicates are removed. If s is empty, the
+// default scope is returned.
+func ParseOAuthScope(s string) (FedOAuthScope, error) {
+	var scopes []string
+
+	for _, scope := range strings.Fields(s) {
+		if !validScope(scope) {
+			return "", errors.NewfWith(http.StatusBadRequest, "unknown scope=%v", scope)
+		}
+
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return DEFAULT_SCOPE, nil
+	}
+
+	return FedOAuthScope(strings.Join(scopes, " ")), nil
+}
+
+// Return the individual scopes that make up s.
+func (s FedOAuthScope) Scopes() []string {
+	return strings.Fields(string(s))
+}
+
+// Return whether s grants required, e.g. "write" grants
+// "write:statuses", but not the other way around.
+func (s FedOAuthScope) Allows(required string) bool {
+	for _, granted := range s.Scopes() {
+		if granted == required || strings.HasPrefix(required, granted+":") {
+			return true
+		}
+
+		if granted == "follow" && contains(_FOLLOW_SCOPES, required) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether s grants everything other grants.
+func (s FedOAuthScope) Covers(other FedOAuthScope) bool {
+	for _, scope := range other.Scopes() {
+		if !s.Allows(scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Return whether s contains any administrative scopes.
+func (s FedOAuthScope) IsAdmin() bool {
+	for _, scope := range s.Scopes() {
+		if strings.HasPrefix(scope, "admin:") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s FedOAuthScope) String() string {
+	return string(s)
+}
+
+// Return whether scope is one of the top level scopes or a sub-scope
+// of one of them.
+func validScope(scope string) bool {
+	for _, top := range _TOP_LEVEL_SCOPES {
+		if scope == top {
+			return true
+		}
+
+		if sub := strings.TrimPrefix(scope, top+":"); sub != scope && isScopeName(sub) {
+			return top != "follow" && top != "push"
+		}
+	}
+
+	return false
+}
+
+// Return whether s is a valid name for a sub-scope, e.g. "statuses".
+func isScopeName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Return whether ss contains s.
+func contains(ss []string, s string) bool {
+	for _, candidate := range ss {
+		if candidate == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestParseOAuthScope(t *testing.T) {
+	if scope, err := ParseOAuthScope(""); err != nil || scope != DEFAULT_SCOPE {
+		t.Errorf("empty scope parsed to scope=%v err=%v", scope, err)
+	}
+
+	if scope, err := ParseOAuthScope("read  write:statuses read"); err != nil || scope != "read write:statuses" {
+		t.Errorf("bad scope=%v err=%v", scope, err)
+	}
+
+	for _, bad := range []string{"all", "write:", "follow:blocks", "read:STATUSES"} {
+		if _, err := ParseOAuthScope(bad); err == nil {
+			t.Errorf("accepted bad scope=%v", bad)
+		}
+	}
+}
+
+func TestOAuthScopeAllows(t *testing.T) {
+	scope := FedOAuthScope("read write:statuses follow")
+
+	for _, ok := range []string{"read", "read:accounts", "write:statuses", "write:follows", "read:blocks"} {
+		if !scope.Allows(ok) {
+			t.Errorf("scope=%v does not allow %v", scope, ok)
+		}
+	}
+
+	for _, no := range []string{"write", "write:media", "write:favourites", "admin:read", "readx"} {
+		if scope.Allows(no) {
+			t.Errorf("scope=%v allows %v", scope, no)
+		}
+	}
+
+	if !USER_SCOPE.Covers(scope) {
+		t.Errorf("scope=%v not covered by user scope", scope)
+	}
+
+	if scope.Covers(USER_SCOPE) || USER_SCOPE.IsAdmin() || !ADMIN_SCOPE.IsAdmin() {
+		t.Error("bad admin scopes")
+	}
+}
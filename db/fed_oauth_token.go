@@ -3,29 +3,63 @@ package db
 import (
 	"encoding/json"
 	"errors"
+	"sort"
 	"time"
 )
 
 const _TOKEN_LIFETIME = 24 * time.Hour
 
+// How long a refresh token may be used after it was issued. Each
+// refresh issues a new refresh token, so sessions that are in use
+// do not expire.
+const _REFRESH_LIFETIME = 30 * 24 * time.Hour
+
 type FedOAuthToken struct {
 	Token    string
 	Username string
 	IssuedOn time.Time
+
+	// What the holder of this token may do.
+	Scope FedOAuthScope
+
+	// Identifies the session this token belongs to. Unlike the
+	// token itself, the id may be shown to users. It stays the
+	// same when the token is refreshed.
+	Id string
+
+	// When the session started, that is when the first token of
+	// the session was issued.
+	CreatedOn time.Time
+
+	// Id of the client the token was issued to. Empty for sessions
+	// of the web interface.
+	ClientId string
+
+	// Token that can be exchanged for a new token once this token
+	// has expired. Empty if the token cannot be refreshed.
+	RefreshToken string
 }
 
-// If username/password are valid credentials, create a new
-// token, store it into target and return it.
-func NewFedOAuthToken(username, password string, target Storer) (*FedOAuthToken, error) {
-	if err := CheckCredentials(username, password, target); err != nil {
+// Create a new token for a session of username in the web interface,
+// store it into target and return it. Callers need to have checked
+// the credentials of username.
+func NewFedOAuthSession(username string, scope FedOAuthScope, target Storer) (*FedOAuthToken, error) {
+	ot := newToken(username, scope)
+
+	if err := target.StoreToken(ot); err != nil {
 		return nil, err
 	}
 
-	ot := &FedOAuthToken{
-		Token:    random(),
-		Username: username,
-		IssuedOn: time.Now().UTC(),
-	}
+	return ot, nil
+}
+
+// Create a new token for username with given scope issued to the
+// client with given clientId, store it into target and return it.
+// The token comes with a refresh token.
+func NewFedOAuthTokenFor(username, clientId string, scope FedOAuthScope, target Storer) (*FedOAuthToken, error) {
+	ot := newToken(username, scope)
+	ot.ClientId = clientId
+	ot.RefreshToken = random()
 
 	if err := target.StoreToken(ot); err != nil {
 		return nil, err
@@ -34,33 +68,109 @@ func NewFedOAuthToken(username, password string, target Storer) (*FedOAuthToken,
 	return ot, nil
 }
 
-// Create a new token for username, store it into target and return it.
-func NewFedOAuthTokenFor(username string, target Storer) (*FedOAuthToken, error) {
-	ot := &FedOAuthToken{
-		Token:    random(),
-		Username: username,
-		IssuedOn: time.Now().UTC(),
+// Return the token with given refresh token. Returns an error if
+// there is no such token or if the refresh token is expired.
+func RetrieveRefreshToken(refresh string, source Storer) (*FedOAuthToken, error) {
+	if refresh == "" {
+		return nil, errors.New("unknown refresh token")
 	}
 
-	if err := target.StoreToken(ot); err != nil {
+	ot, err := source.RetrieveTokenByRefresh(refresh)
+	if err != nil {
+		return nil, errors.New("unknown refresh token")
+	}
+
+	if ot.Expired() {
+		return nil, errors.New("refresh token expired")
+	}
+
+	return ot, nil
+}
+
+// Return the sessions of username that are still active, oldest
+// session first.
+func RetrieveSessions(username string, source Storer) (sessions []*FedOAuthToken, err error) {
+	tokens, err := source.RetrieveUserTokens(username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ot := range tokens {
+		if !ot.Expired() {
+			sessions = append(sessions, ot)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedOn.Before(sessions[j].CreatedOn)
+	})
+
+	return sessions, nil
+}
+
+// Replace this token with a new token and refresh token for the
+// same session. The old token and refresh token can no longer be
+// used. If scope is not empty, the new token only gets scope which
+// needs to be covered by the scope of this token.
+func (c *FedOAuthToken) Refresh(scope FedOAuthScope, target Storer) (*FedOAuthToken, error) {
+	if scope == "" {
+		scope = c.Scope
+	}
+
+	if !c.Scope.Covers(scope) {
+		return nil, errors.New("scope exceeds scope of refresh token")
+	}
+
+	ot := newToken(c.Username, scope)
+	ot.Id = c.Id
+	ot.CreatedOn = c.CreatedOn
+	ot.ClientId = c.ClientId
+	ot.RefreshToken = random()
+
+	// rotating happens at once s.t. a refresh token cannot be
+	// used twice by concurrent requests
+
+	if err := target.RotateToken(c.Token, ot); err != nil {
 		return nil, err
 	}
 
 	return ot, nil
 }
 
-// Return whether this token is expired.
-func (c *FedOAuthToken) Expired() bool {
+// Return the number of seconds the token may be used for, counting
+// from when it was issued.
+func (c *FedOAuthToken) ExpiresIn() int64 {
+	return int64(_TOKEN_LIFETIME / time.Second)
+}
+
+// Return whether this token may no longer be used for authentication.
+func (c *FedOAuthToken) AccessExpired() bool {
 	end := c.IssuedOn.Add(_TOKEN_LIFETIME)
 	return time.Now().UTC().After(end)
 }
 
+// Return whether this token is expired, that is it may be used
+// neither for authentication nor for getting a new token.
+func (c *FedOAuthToken) Expired() bool {
+	if c.RefreshToken == "" {
+		return c.AccessExpired()
+	}
+
+	end := c.IssuedOn.Add(_REFRESH_LIFETIME)
+	return time.Now().UTC().After(end)
+}
+
 // Unmarshal override to avoid confusion with FedOAuthCode.
 func (c *FedOAuthToken) UnmarshalJSON(data []byte) error {
 	type Token struct {
-		Token    string
-		Username string
-		IssuedOn time.Time
+		Token        string
+		Username     string
+		IssuedOn     time.Time
+		Scope        FedOAuthScope
+		Id           string
+		CreatedOn    time.Time
+		ClientId     string
+		RefreshToken string
 	}
 
 	var buf Token
@@ -76,6 +186,25 @@ func (c *FedOAuthToken) UnmarshalJSON(data []byte) error {
 	c.Token = buf.Token
 	c.Username = buf.Username
 	c.IssuedOn = buf.IssuedOn
+	c.Scope = buf.Scope
+	c.Id = buf.Id
+	c.CreatedOn = buf.CreatedOn
+	c.ClientId = buf.ClientId
+	c.RefreshToken = buf.RefreshToken
 
 	return nil
 }
+
+// Return a new token for a new session of username.
+func newToken(username string, scope FedOAuthScope) *FedOAuthToken {
+	now := time.Now().UTC()
+
+	return &FedOAuthToken{
+		Token:     random(),
+		Username:  username,
+		IssuedOn:  now,
+		Scope:     scope,
+		Id:        random(),
+		CreatedOn: now,
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The maximum number of profile fields a user can set up.
+const MAX_PROFILE_FIELDS = 4
+
+// The parts of the actor of a user that the user can edit themselves.
+type FedProfile struct {
+	// Name shown instead of the username. May be empty in which
+	// case the username is shown.
+	DisplayName string
+
+	// Short biography of the user as sanitized HTML.
+	Summary string
+
+	// Avatar of the user. Nil if there is none.
+	Icon *url.URL
+
+	// Header image of the user. Nil if there is none.
+	Image *url.URL
+
+	// Name/value pairs shown on the profile page, e.g. links to
+	// the website of the user.
+	Fields []*FedProfileField
+}
+
+// One entry in the table of name/value pairs on a profile.
+type FedProfileField struct {
+	// Label of the field, e.g. "Website".
+	Name string
+
+	// Value of the field as plain text.
+	Value string
+
+	// When we last confirmed that the page Value links to links
+	// back to the profile. Nil if the field was not verified.
+	VerifiedAt *time.Time
+}
+
+// Keep the verification of fields in old for fields in p that have
+// the same value. This way fields do not lose their verification
+// whenever the profile is updated.
+func (p *FedProfile) KeepVerified(old *FedProfile) {
+	for _, field := range p.Fields {
+		for _, o := range old.Fields {
+			if o.Value == field.Value {
+				field.VerifiedAt = o.VerifiedAt
+			}
+		}
+	}
+}
+
+// Return a new profile field with surrounding white space of name
+// and value removed. Returns nil if either is empty after trimming.
+func NewFedProfileField(name, value string) *FedProfileField {
+	name = strings.TrimSpace(name)
+	value = strings.TrimSpace(value)
+
+	if name == "" || value == "" {
+		return nil
+	}
+
+	return &FedProfileField{
+		Name:  name,
+		Value: value,
+	}
+}
+
+// Return the value of this field as URL if it is a link to a web
+// page. Returns nil otherwise.
+func (f *FedProfileField) Link() *url.URL {
+	target, err := url.Parse(f.Value)
+	if err != nil || target.Host == "" {
+		return nil
+	}
+
+	if target.Scheme != "https" && target.Scheme != "http" {
+		return nil
+	}
+
+	return target
+}
@@ -15,6 +15,10 @@ type Storer interface {
 	// already exists, it is overwritten.
 	StoreUser(user *FedUser) error
 
+	// Retrieve the metadata of all users registered with this
+	// instance.
+	RetrieveUsers() ([]*FedUser, error)
+
 	// Retreive metadta for given code. If no such code is recorded
 	// or if it is expired, an error is returned.
 	RetrieveCode(code string) (*FedOAuthCode, error)
@@ -23,6 +27,16 @@ type Storer interface {
 	// already exists, it is overwritten.
 	StoreCode(code *FedOAuthCode) error
 
+	// Delete the given code. Codes may only be exchanged for a
+	// token once.
+	DeleteCode(code string) error
+
+	// Retrieve metadata for given code and delete it at once. Codes
+	// may only be exchanged for a token once, so the code is gone
+	// even if the exchange fails later on. If no such code is
+	// recorded, an error is returned.
+	TakeCode(code string) (*FedOAuthCode, error)
+
 	// Retreive metadta for given token. If no such token is recorded
 	// or if it is expired, an error is returned.
 	RetrieveToken(token string) (*FedOAuthToken, error)
@@ -31,6 +45,35 @@ type Storer interface {
 	// already exists, it is overwritten.
 	StoreToken(token *FedOAuthToken) error
 
+	// Delete the given token. Deleting a token that does not exist
+	// is not an error.
+	DeleteToken(token string) error
+
+	// Retrieve the metadata of all tokens, including expired
+	// tokens that were not collected yet.
+	RetrieveTokens() ([]*FedOAuthToken, error)
+
+	// Retrieve the token with given refresh token. If no token
+	// has that refresh token, an error is returned.
+	RetrieveTokenByRefresh(refresh string) (*FedOAuthToken, error)
+
+	// Retrieve all tokens of the user with given username,
+	// including expired tokens that were not collected yet.
+	RetrieveUserTokens(username string) ([]*FedOAuthToken, error)
+
+	// Delete token old and store token in its place at once. If old
+	// does not exist, nothing is stored and an error is returned;
+	// that way each token can only be replaced once.
+	RotateToken(old string, token *FedOAuthToken) error
+
+	// Retrieve the OAuth client with given id. If no such client
+	// is registered, an error is returned.
+	RetrieveClient(id string) (*FedOAuthClient, error)
+
+	// Write metadata for client. If a client with matching client.Id
+	// already exists, it is overwritten.
+	StoreClient(client *FedOAuthClient) error
+
 	// Retrieve the object at iri.
 	RetrieveObject(iri *url.URL) (vocab.Type, error)
 
@@ -40,6 +83,32 @@ type Storer interface {
 
 	// Delete the object at iri.
 	DeleteObject(iri *url.URL) error
+
+	// Retrieve the earlier versions of the object at iri, oldest
+	// first. If there are none, an empty slice is returned.
+	RetrieveRevisions(iri *url.URL) ([]vocab.Type, error)
+
+	// Remember obj as the most recent earlier version of the object
+	// at iri.
+	StoreRevision(iri *url.URL, obj vocab.Type) error
+
+	// Retrieve the metadata of the uploaded file with given id.
+	// If no such file exists, an error is returned.
+	RetrieveMedia(id string) (*FedMedia, error)
+
+	// Write metadata for media. If metadata with matching media.Id
+	// already exists, it is overwritten.
+	StoreMedia(media *FedMedia) error
+
+	// Retrieve all instance-wide domain blocks.
+	RetrieveDomainBlocks() ([]*FedDomainBlock, error)
+
+	// Write block. If a block for block.Domain already exists,
+	// it is overwritten.
+	StoreDomainBlock(block *FedDomainBlock) error
+
+	// Delete the block for domain.
+	DeleteDomainBlock(domain string) error
 }
 
 // Represents a connection to some database that takes care of storing
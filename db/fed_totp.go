@@ -0,0 +1,167 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Length of the time steps of TOTP codes as recommended by RFC 6238.
+const _TOTP_STEP = 30 * time.Second
+
+// Number of digits in TOTP codes. Six digits is what authenticator
+// apps expect.
+const _TOTP_DIGITS = 6
+
+// Number of recovery codes handed out at once.
+const RECOVERY_CODES = 10
+
+// Encoding of TOTP secrets. Authenticator apps expect base32
+// without padding.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Second factor of a user based on time-based one-time passwords
+// as described in RFC 6238, i.e. authenticator apps.
+type FedTOTP struct {
+	// The shared secret, base32 encoded.
+	Secret string
+
+	// Whether the user confirmed enrollment by entering a valid
+	// code. Until then, the second factor is not required to log in.
+	Confirmed bool
+
+	// The most recent time step a code was accepted for. Codes of
+	// earlier steps are rejected s.t. codes cannot be replayed.
+	LastStep int64
+
+	// SHA256 hashes of the recovery codes that were not used yet.
+	RecoveryCodes [][]byte
+}
+
+// Create a new unconfirmed second factor with random secret.
+func NewFedTOTP() *FedTOTP {
+	secret := make([]byte, 20)
+
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("could not generate random secret:", err)
+	}
+
+	return &FedTOTP{
+		Secret: totpEncoding.EncodeToString(secret),
+	}
+}
+
+// Return the otpauth:// URI that authenticator apps use to set up
+// this second factor for account on issuer. We do not render QR
+// codes; users enter the URI or the secret in their app by hand.
+func (t *FedTOTP) URI(issuer, account string) string {
+	params := url.Values{}
+	params.Set("secret", t.Secret)
+	params.Set("issuer", issuer)
+	params.Set("digits", fmt.Sprint(_TOTP_DIGITS))
+	params.Set("period", fmt.Sprint(int(_TOTP_STEP/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+
+	return u.String()
+}
+
+// Return whether code is valid at time now. To allow for clock drift,
+// codes of the previous and next time step are accepted as well. On
+// success, the time step is recorded; store the user afterwards.
+func (t *FedTOTP) Verify(code string, now time.Time) bool {
+	secret, err := totpEncoding.DecodeString(t.Secret)
+	if err != nil {
+		log.Printf("bad totp secret: %v", err)
+		return false
+	}
+
+	code = strings.Join(strings.Fields(code), "")
+	step := now.Unix() / int64(_TOTP_STEP/time.Second)
+
+	for _, candidate := range []int64{step - 1, step, step + 1} {
+		if candidate <= t.LastStep {
+			continue
+		}
+
+		expected := totpCode(secret, uint64(candidate), _TOTP_DIGITS)
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			t.LastStep = candidate
+			return true
+		}
+	}
+
+	return false
+}
+
+// Replace the recovery codes with new ones and return them in
+// plaintext. Only the hashes are kept around, so this is the only
+// time the codes can be shown.
+func (t *FedTOTP) NewRecoveryCodes() (codes []string) {
+	t.RecoveryCodes = nil
+
+	for i := 0; i < RECOVERY_CODES; i++ {
+		code := random()[:16]
+		codes = append(codes, code)
+		t.RecoveryCodes = append(t.RecoveryCodes, recoveryHash(code))
+	}
+
+	return codes
+}
+
+// If code is one of the recovery codes that were not used yet,
+// remove it and return true. Store the user afterwards.
+func (t *FedTOTP) UseRecoveryCode(code string) bool {
+	hash := recoveryHash(strings.ToLower(strings.TrimSpace(code)))
+
+	for i, candidate := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare(candidate, hash) == 1 {
+			t.RecoveryCodes = append(t.RecoveryCodes[:i], t.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the hash of recovery code that we store.
+func recoveryHash(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+// Return the HOTP value for secret and counter as described
+// in RFC 4226 with given number of digits.
+func totpCode(secret []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
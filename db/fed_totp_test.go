@@ -0,0 +1,72 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// test vectors for SHA1 from RFC 6238, Appendix B
+
+	secret := []byte("12345678901234567890")
+
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, expected := range vectors {
+		if code := totpCode(secret, uint64(unix/30), 8); code != expected {
+			t.Errorf("time=%v got code=%v expected=%v", unix, code, expected)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	totp := NewFedTOTP()
+	secret, err := totpEncoding.DecodeString(totp.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1600000000, 0)
+	code := totpCode(secret, uint64(now.Unix()/30), _TOTP_DIGITS)
+
+	if !totp.Verify(code, now) {
+		t.Errorf("rejected valid code")
+	}
+
+	if totp.Verify(code, now) {
+		t.Errorf("accepted code twice")
+	}
+
+	later := now.Add(5 * time.Minute)
+	if totp.Verify(totpCode(secret, uint64(now.Unix()/30)+1, _TOTP_DIGITS), later) {
+		t.Errorf("accepted stale code")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	totp := NewFedTOTP()
+	codes := totp.NewRecoveryCodes()
+
+	if len(codes) != RECOVERY_CODES || len(totp.RecoveryCodes) != RECOVERY_CODES {
+		t.Fatalf("got %v codes", len(codes))
+	}
+
+	if !totp.UseRecoveryCode(codes[3]) {
+		t.Errorf("rejected recovery code")
+	}
+
+	if totp.UseRecoveryCode(codes[3]) {
+		t.Errorf("accepted recovery code twice")
+	}
+
+	if totp.UseRecoveryCode("nope") {
+		t.Errorf("accepted bad recovery code")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/util"
 	"net/url"
+	"time"
 )
 
 // Represents a user registered with the service.
@@ -20,6 +21,33 @@ type FedUser struct {
 	Following []*url.URL
 	Followers []*url.URL
 	Liked     []*url.URL
+
+	// Actors this user sent a Follow request to that was neither
+	// accepted nor rejected yet.
+	PendingFollowing []*url.URL
+
+	// Objects this user repeated (i.e. announced). We keep track
+	// of them to show the right state in the web interface.
+	Repeated []*url.URL
+
+	// Actors this user blocked. We neither accept activities from
+	// them nor show their posts.
+	BlockedActors []*url.URL
+
+	// Domains this user blocked. Works like BlockedActors, but for
+	// all actors on that domain.
+	BlockedDomains []string
+
+	// Rules for hiding objects from the stream of this user.
+	Mutes []*FedMute
+
+	// Display name, biography and so on as shown on the actor
+	// of this user.
+	Profile FedProfile
+
+	// Second factor for logging in. Nil if the user did not set
+	// up two-factor authentication.
+	TOTP *FedTOTP
 }
 
 // Return a slice that contains all collections (i.e. Inbox, Outbox,
@@ -43,11 +71,34 @@ func (u *FedUser) PasswordOK(password string) bool {
 	return bytes.Compare(hash, u.PasswordSHA256) == 0
 }
 
+// Return whether this user has to enter a second factor after the
+// password when logging in.
+func (u *FedUser) SecondFactorRequired() bool {
+	return u.TOTP != nil && u.TOTP.Confirmed
+}
+
+// Return whether code is a valid TOTP code or an unused recovery
+// code of this user. Both change the state of the second factor;
+// store the user afterwards.
+func (u *FedUser) CheckSecondFactor(code string) bool {
+	if u.TOTP == nil {
+		return false
+	}
+
+	return u.TOTP.Verify(code, time.Now()) || u.TOTP.UseRecoveryCode(code)
+}
+
 // Returns whether this user is following whatever is at id.
 func (u *FedUser) IsFollowing(id *url.URL) bool {
 	return util.UrlIn(id, u.Following)
 }
 
+// Returns whether this user sent a follow request to id that was
+// not answered yet.
+func (u *FedUser) IsPendingFollowing(id *url.URL) bool {
+	return util.UrlIn(id, u.PendingFollowing)
+}
+
 // Returns whether id is following this user.
 func (u *FedUser) IsFollowedBy(id *url.URL) bool {
 	return util.UrlIn(id, u.Followers)
@@ -58,10 +109,59 @@ func (u *FedUser) HasLiked(id *url.URL) bool {
 	return util.UrlIn(id, u.Liked)
 }
 
+// Returns whether this user repeated whatever is at id.
+func (u *FedUser) HasRepeated(id *url.URL) bool {
+	return util.UrlIn(id, u.Repeated)
+}
+
+// Returns whether this user blocked the actor at id, either directly
+// or by blocking the domain id is hosted on.
+func (u *FedUser) HasBlocked(id *url.URL) bool {
+	return util.UrlIn(id, u.BlockedActors) || u.HasBlockedDomain(id.Hostname())
+}
+
+// Returns whether this user blocked domain.
+func (u *FedUser) HasBlockedDomain(domain string) bool {
+	domain = NormalizeDomain(domain)
+
+	for _, blocked := range u.BlockedDomains {
+		if NormalizeDomain(blocked) == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the mutes of this user that are not expired.
+func (u *FedUser) ActiveMutes() (active []*FedMute) {
+	for _, mute := range u.Mutes {
+		if !mute.Expired() {
+			active = append(active, mute)
+		}
+	}
+
+	return active
+}
+
+// Remove the mute with given id. Expired mutes are removed as
+// well.
+func (u *FedUser) RemoveMute(id string) {
+	var kept []*FedMute
+
+	for _, mute := range u.ActiveMutes() {
+		if mute.Id != id {
+			kept = append(kept, mute)
+		}
+	}
+
+	u.Mutes = kept
+}
+
 func (u *FedUser) String() string {
 	return fmt.Sprintf(
-		"{Name=%v Inbox=%v Outbox=%v Following=%v Followers=%v Liked=%v}",
-		u.Name, u.Inbox, u.Outbox, u.Following, u.Followers, u.Liked,
+		"{Name=%v Inbox=%v Outbox=%v Following=%v Followers=%v Liked=%v Repeated=%v}",
+		u.Name, u.Inbox, u.Outbox, u.Following, u.Followers, u.Liked, u.Repeated,
 	)
 }
 
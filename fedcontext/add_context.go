@@ -3,11 +3,15 @@ package fedcontext
 import (
 	"context"
 	"github.com/go-fed/activity/pub"
+	"github.com/kissen/fed/config"
 	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/throttle"
 	"github.com/kissen/fed/util"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // Return a middleware function that installs a FedContext on the
@@ -50,9 +54,19 @@ func AddContext(s db.FedStorage, pa pub.FederatingActor, hf pub.HandlerFunc) fun
 					log.Println(err)
 				}
 
+				// forms of the web interface need a CSRF token;
+				// it is persisted with the cookie
+				if fc.CSRF == "" {
+					fc.CSRF = newCSRFToken()
+				}
+
 				// try to find out the permissions of the request;
 				// fills out the Client field
 				setClientOn(fc, r)
+
+				// find out who is asking; fills out the Requester
+				// field
+				setRequesterOn(fc, r)
 			}
 
 			// handle the request; this is the core of the application
@@ -65,7 +79,11 @@ func AddContext(s db.FedStorage, pa pub.FederatingActor, hf pub.HandlerFunc) fun
 // Set the Client field on fc. This is done by trying out all
 // available authentication schemes one by one.
 func setClientOn(fc *FedContext, from *http.Request) {
-	if setClientFromBasiAuth(fc, from) {
+	if setClientFromBasicAuth(fc, from) {
+		return
+	}
+
+	if setClientFromBearer(fc, from) {
 		return
 	}
 
@@ -79,11 +97,16 @@ func setClientOn(fc *FedContext, from *http.Request) {
 }
 
 // Try to set fc.Client by looking at basic authentication headers
-// on the HTTP request.
+// on the HTTP request. The credentials are checked against the user
+// record on each request; no token is created. Failed attempts count
+// towards the login throttle like failed logins in the web interface,
+// successful ones are not recorded.
+// Users with a second factor cannot use basic authentication.
 //
 // Basic authentication doesn't seem common on the fediverse, but
-// it is very convenient for debugging.
-func setClientFromBasiAuth(fc *FedContext, from *http.Request) (authed bool) {
+// it is very convenient for debugging. It can be turned off in
+// the configuration.
+func setClientFromBasicAuth(fc *FedContext, from *http.Request) (authed bool) {
 	// get credentials; if none were supplied give up right away
 
 	username, password, ok := from.BasicAuth()
@@ -91,24 +114,71 @@ func setClientFromBasiAuth(fc *FedContext, from *http.Request) (authed bool) {
 		return false
 	}
 
-	// create token for each basic auth; this is honestly kind of
-	// dumb but it will have to do for now
+	if config.Get().DisableBasicAuth {
+		log.Println("ignoring basic auth as it is disabled")
+		return false
+	}
+
+	err := throttle.Verify(from, username, func() error {
+		return db.CheckCredentials(username, password, fc.Storage)
+	})
 
-	tm, err := db.NewFedOAuthToken(username, password, fc.Storage)
 	if err != nil {
 		log.Println(err)
 		return false
 	}
 
-	if authed := setClientFromToken(fc, tm.Token); !authed {
-		log.Println("NOT")
+	if err := checkBasicAuthAllowed(username, fc.Storage); err != nil {
+		log.Println(err)
 		return false
 	}
 
+	// the client passes on the same credentials when it talks to us
+
+	addr := fediri.ActorIRI(username).String()
+	client, err := NewRemoteClient(fc.Storage, addr, from.Header.Get("Authorization"))
+	if err != nil {
+		return false
+	}
+
+	fc.Client = client
+	fc.Scope = PasswordScope(username)
 	log.Printf("authenticated user=%v with basic auth", username)
 	return true
 }
 
+// Return an error if the user with given username may not use basic
+// authentication. Basic authentication only carries the password, so
+// users with a second factor have to get a token instead; otherwise
+// the password alone would be enough to act as them.
+func checkBasicAuthAllowed(username string, s db.Storer) error {
+	user, err := s.RetrieveUser(username)
+	if err != nil {
+		return errors.Wrap(err, "cannot look up user for basic auth")
+	}
+
+	if user.SecondFactorRequired() {
+		return errors.Newf("rejecting basic auth for user=%v as a second factor is required", username)
+	}
+
+	return nil
+}
+
+// Try to set fc.Client by looking at the "Authorization: Bearer"
+// header on the HTTP request. This is how OAuth clients should send
+// their tokens.
+func setClientFromBearer(fc *FedContext, from *http.Request) (authed bool) {
+	const prefix = "bearer "
+
+	header := from.Header.Get("Authorization")
+
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+
+	return setClientFromToken(fc, header[len(prefix):])
+}
+
 // Try to set fc.Client by looking at the fc.Token property. fc.Token
 // is part of CookieContext and as such persisted by web browsers.
 // This is the authentication most users will use when interating
@@ -122,7 +192,9 @@ func setClientFromTokenCookie(fc *FedContext, from *http.Request) (authed bool)
 }
 
 // Try to set fc.Client by looking at the ?token= parameter in the
-// request URI. This is mostly for API calls on the fediverse.
+// request URI. This is mostly for API calls on the fediverse. Prefer
+// the Authorization header; query parameters end up in logs and
+// Referer headers.
 func setClientFromTokenParam(fc *FedContext, from *http.Request) (authed bool) {
 	token := from.URL.Query().Get("token")
 	return setClientFromToken(fc, token)
@@ -143,15 +215,29 @@ func setClientFromToken(fc *FedContext, token string) (authed bool) {
 		return false
 	}
 
+	// expired tokens have to be refreshed first
+	if cm.AccessExpired() {
+		log.Printf("rejecting expired token for user=%v", cm.Username)
+		return false
+	}
+
+	// tokens from before we had scopes could do anything; make
+	// their owners log in again instead
+	if cm.Scope == "" {
+		log.Printf("rejecting token without scope for user=%v", cm.Username)
+		return false
+	}
+
 	// build up client
 	addr := fediri.ActorIRI(cm.Username).String()
-	client, err := NewRemoteClient(addr, tt)
+	client, err := NewRemoteClient(fc.Storage, addr, "Bearer "+tt)
 	if err != nil {
 		return false
 	}
 
 	// set and return
 	fc.Client = client
+	fc.Scope = cm.Scope
 	log.Printf("authenticated user=%v with token auth", cm.Username)
 	return true
 }
@@ -0,0 +1,49 @@
+package fedcontext
+
+import (
+	"github.com/kissen/fed/db"
+	"testing"
+)
+
+// Storage that only knows about a single user.
+type userStorage struct {
+	db.FedEmptyStorage
+	user *db.FedUser
+}
+
+func (s userStorage) RetrieveUser(username string) (*db.FedUser, error) {
+	if username != s.user.Name {
+		return s.FedEmptyStorage.RetrieveUser(username)
+	}
+
+	return s.user, nil
+}
+
+func TestBasicAuthSecondFactor(t *testing.T) {
+	user := &db.FedUser{Name: "alice"}
+	user.SetPassword("secret")
+
+	storage := userStorage{user: user}
+
+	if err := checkBasicAuthAllowed("alice", storage); err != nil {
+		t.Fatalf("rejected user without second factor err=%v", err)
+	}
+
+	// an unconfirmed second factor is not required yet
+
+	user.TOTP = db.NewFedTOTP()
+
+	if err := checkBasicAuthAllowed("alice", storage); err != nil {
+		t.Fatalf("rejected user with unconfirmed second factor err=%v", err)
+	}
+
+	user.TOTP.Confirmed = true
+
+	if err := db.CheckCredentials("alice", "secret", storage); err != nil {
+		t.Fatalf("password rejected err=%v", err)
+	}
+
+	if err := checkBasicAuthAllowed("alice", storage); err == nil {
+		t.Fatalf("accepted basic auth for user with second factor")
+	}
+}
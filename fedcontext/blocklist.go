@@ -0,0 +1,107 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/prop"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// The instance-wide domain blocks, mapping from domain to
+// severity.
+type Blocklist map[string]db.Severity
+
+// Load the instance-wide domain blocks. Blocks are read both from the
+// configuration file and from storage s. If a domain shows up in both,
+// the block in storage wins.
+func LoadBlocklist(s db.Storer) Blocklist {
+	bl := make(Blocklist)
+
+	for _, block := range config.Get().DomainBlocks {
+		if severity, err := db.ParseSeverity(block.Severity); err != nil {
+			log.Printf("ignoring block of domain=%v: %v", block.Domain, err)
+		} else {
+			bl[db.NormalizeDomain(block.Domain)] = severity
+		}
+	}
+
+	blocks, err := s.RetrieveDomainBlocks()
+	if err != nil {
+		log.Printf("cannot load domain blocks: %v", err)
+	}
+
+	for _, block := range blocks {
+		bl[db.NormalizeDomain(block.Domain)] = block.Severity
+	}
+
+	return bl
+}
+
+// Return the severity with which the host of iri is blocked. If
+// the host is not blocked, ok is false. Blocking a domain also
+// blocks all its subdomains.
+func (bl Blocklist) Severity(iri *url.URL) (severity db.Severity, ok bool) {
+	if iri == nil {
+		return "", false
+	}
+
+	host := db.NormalizeDomain(iri.Hostname())
+
+	for len(host) > 0 {
+		if severity, ok := bl[host]; ok {
+			return severity, true
+		}
+
+		// strip the leftmost label and try again
+
+		if idx := strings.Index(host, "."); idx < 0 {
+			break
+		} else {
+			host = host[idx+1:]
+		}
+	}
+
+	return "", false
+}
+
+// Return whether we do not want to have anything to do with the
+// host of iri.
+func (bl Blocklist) Rejects(iri *url.URL) bool {
+	severity, ok := bl.Severity(iri)
+	return ok && severity == db.REJECT
+}
+
+// Return whether posts from the host of iri should be kept out of
+// public timelines.
+func (bl Blocklist) Silences(iri *url.URL) bool {
+	severity, ok := bl.Severity(iri)
+	return ok && (severity == db.REJECT || severity == db.SILENCE)
+}
+
+// Return whether we should drop media attached to objects from
+// the host of iri.
+func (bl Blocklist) RejectsMedia(iri *url.URL) bool {
+	severity, ok := bl.Severity(iri)
+	return ok && (severity == db.REJECT || severity == db.REJECT_MEDIA)
+}
+
+// Return whether obj should be hidden from user. This is the case
+// if any of its authors is blocked, either by user or on the whole
+// instance. Posts from silenced domains are only shown to followers
+// of the author.
+func (bl Blocklist) Hides(user *db.FedUser, obj vocab.Type) bool {
+	for _, author := range prop.IRIs(obj, "attributedTo", "actor") {
+		if bl.Rejects(author) || user.HasBlocked(author) {
+			return true
+		}
+
+		if severity, ok := bl.Severity(author); ok && severity == db.SILENCE && !user.IsFollowing(author) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package fedcontext
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/errors"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// The name of the form value that carries the CSRF token.
+const CSRF_FORM_KEY = "csrf"
+
+// The key cookies are encrypted with. Derived from the cookie secret
+// in the configuration.
+var cookieKey struct {
+	sync.Once
+	aead cipher.AEAD
+}
+
+// Return an error if the form of r does not carry the CSRF token
+// of the session of r. Call this for all requests that change state
+// from the web interface.
+func CheckCSRF(r *http.Request) error {
+	expected := Context(r).CSRF
+	got := r.FormValue(CSRF_FORM_KEY)
+
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(got)) != 1 {
+		return errors.NewWith(http.StatusForbidden, "bad or missing csrf token")
+	}
+
+	return nil
+}
+
+// Encrypt and authenticate plaintext with the cookie key. Returns the
+// result encoded for use as a cookie value.
+func sealCookie(plaintext []byte) (string, error) {
+	aead := cookieAEAD()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "cannot create nonce")
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(_COOKIE_CONTEXT_KEY))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt the cookie value in value which was created by sealCookie.
+// Returns an error if value was not created with the cookie key or
+// if it was tampered with.
+func openCookie(value string) ([]byte, error) {
+	aead := cookieAEAD()
+
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie value malformed base64")
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("cookie value too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(_COOKIE_CONTEXT_KEY))
+	if err != nil {
+		return nil, errors.Wrap(err, "cookie authentication failed")
+	}
+
+	return plaintext, nil
+}
+
+// Return the AES-GCM cipher cookies are encrypted with. If no cookie
+// secret is configured, a random key is used; sessions then end when
+// the process exits.
+func cookieAEAD() cipher.AEAD {
+	cookieKey.Do(func() {
+		var key []byte
+
+		if secret := config.Get().CookieSecret; secret != "" {
+			sum := sha256.Sum256([]byte(secret))
+			key = sum[:]
+		} else {
+			log.Println("no CookieSecret configured, sessions will not survive a restart")
+			key = make([]byte, 32)
+
+			if _, err := rand.Read(key); err != nil {
+				log.Panicf("cannot create cookie key: %v", err)
+			}
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			log.Panicf("cannot create cookie cipher: %v", err)
+		}
+
+		if cookieKey.aead, err = cipher.NewGCM(block); err != nil {
+			log.Panicf("cannot create cookie cipher: %v", err)
+		}
+	})
+
+	return cookieKey.aead
+}
+
+// Return a new random token suitable for CSRF protection.
+func newCSRFToken() string {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		log.Panicf("cannot create csrf token: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -1,18 +1,32 @@
 package fedcontext
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
 	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fediri"
 	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/marshal"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"io"
+	"log"
+	"net/http"
 	"net/url"
+	"time"
 )
 
 // Implements FedClient.
 type fedbaseclient struct {
 	username string
 
+	// Storage we look up the settings of the owner in.
+	storage db.Storer
+
 	// IRI pointing to the actor that "owns" this client.
 	iri *url.URL
 
@@ -28,11 +42,42 @@ type fedbaseclient struct {
 	// IRI pointing to the followers collection of the owner.
 	followersIRI *url.URL
 
-	// Function that gets invoked on Create calls.
-	create func(vocab.Type) error
+	// IRI pointing to the endpoint the owner uploads files to.
+	uploadMediaIRI *url.URL
+
+	// Function that gets invoked on Upload calls.
+	upload func(io.Reader, string, string) (vocab.Type, error)
+
+	// Function that gets invoked on Create calls. Returns the IRI
+	// of the submitted Create.
+	create func(vocab.Type) (*url.URL, error)
+
+	// Function that wraps the given object into an Update and
+	// submits it.
+	update func(vocab.Type) error
+
+	// Function that submits a Delete for the given object.
+	remove func(vocab.Type) error
 
 	// Function that gets invoked on Like calls.
 	like func(*url.URL) error
+
+	// Function that gets invoked on Repeat calls.
+	repeat func(*url.URL) error
+
+	// Function that gets invoked on Follow calls.
+	follow func(*url.URL) error
+
+	// Function that gets invoked on Block calls.
+	block func(*url.URL) error
+
+	// Function that wraps the given activity into an Undo and
+	// submits it.
+	undo func(vocab.Type) error
+
+	// Function that fetches the object at the given IRI with the
+	// permissions of this client.
+	get func(*url.URL) (vocab.Type, error)
 }
 
 func (fc *fedbaseclient) fill(actorAddr string) error {
@@ -78,6 +123,13 @@ func (fc *fedbaseclient) fill(actorAddr string) error {
 		return err
 	}
 
+	// uploads are optional; without them we can still do
+	// everything else
+
+	if fc.uploadMediaIRI, err = getEndpoint(p, "uploadMedia"); err != nil {
+		log.Printf("no uploads for actor=%v: %v", fc.iri, err)
+	}
+
 	return nil
 }
 
@@ -100,7 +152,23 @@ func (fc *fedbaseclient) Stream() (fetch.Iter, error) {
 		return nil, err
 	}
 
-	return fetch.Begins(in, out)
+	it, err := fetch.Begins(in, out)
+	if err != nil {
+		return nil, err
+	}
+
+	// drop everything the owner blocked or muted
+
+	user, err := fc.storage.RetrieveUser(fc.username)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot look up owner of stream")
+	}
+
+	bl := LoadBlocklist(fc.storage)
+
+	return fetch.Filter(it, func(obj vocab.Type) bool {
+		return !bl.Hides(user, obj) && !Muted(fc.storage, user, obj)
+	})
 }
 
 func (fc *fedbaseclient) Inbox() (fetch.Iter, error) {
@@ -135,21 +203,387 @@ func (fc *fedbaseclient) FollowersIRI() *url.URL {
 	return fc.followersIRI
 }
 
-func (fc *fedbaseclient) Create(event vocab.Type) error {
+func (fc *fedbaseclient) Get(iri *url.URL) (vocab.Type, error) {
+	if (fediri.IRI{iri}).IsLocal() {
+		return fc.get(iri)
+	} else {
+		return fetch.FetchPublic(iri)
+	}
+}
+
+func (fc *fedbaseclient) UploadMediaIRI() *url.URL {
+	return fc.uploadMediaIRI
+}
+
+func (fc *fedbaseclient) Upload(file io.Reader, filename, name string) (vocab.Type, error) {
+	if fc.uploadMediaIRI == nil {
+		return nil, errors.New("actor does not support uploads")
+	}
+
+	return fc.upload(file, filename, name)
+}
+
+func (fc *fedbaseclient) Create(event vocab.Type, visibility Visibility) (*url.URL, error) {
+	if err := Address(event, visibility, fc.followersIRI); err != nil {
+		return nil, err
+	}
+
 	return fc.create(event)
 }
 
+func (fc *fedbaseclient) Reply(parent *url.URL, note vocab.ActivityStreamsNote, visibility Visibility) (*url.URL, error) {
+	// we need to look at the original to find out who we
+	// should address
+
+	original, err := fc.Get(parent)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch object replied to")
+	}
+
+	inReplyTo := streams.NewActivityStreamsInReplyToProperty()
+	inReplyTo.AppendIRI(parent)
+	note.SetActivityStreamsInReplyTo(inReplyTo)
+
+	// address the author directly and put everyone else in the
+	// conversation in cc; addressing already present on note is
+	// kept
+
+	authors := prop.IRIs(note, "to")
+	mentioned := prop.IRIs(note, "cc")
+
+	for _, iri := range prop.IRIs(original, "attributedTo", "actor") {
+		if !util.UrlEq(iri, fc.iri) && !util.UrlIn(iri, authors) {
+			authors = append(authors, iri)
+		}
+	}
+
+	for _, iri := range prop.Mentions(original) {
+		if !util.UrlEq(iri, fc.iri) && !util.UrlInAny(iri, [][]*url.URL{authors, mentioned}) {
+			mentioned = append(mentioned, iri)
+		}
+	}
+
+	to := streams.NewActivityStreamsToProperty()
+	prop.AppendIRIs(to, authors)
+	note.SetActivityStreamsTo(to)
+
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, util.UrlsRemove(authors, mentioned))
+	note.SetActivityStreamsCc(cc)
+
+	return fc.Create(note, visibility)
+}
+
+func (fc *fedbaseclient) Edit(iri *url.URL, note vocab.ActivityStreamsNote) error {
+	obj, err := fc.own(iri)
+	if err != nil {
+		return err
+	}
+
+	original, ok := obj.(vocab.ActivityStreamsNote)
+	if !ok {
+		return fmt.Errorf("cannot edit object of type=%T", obj)
+	}
+
+	// keep everything that identifies the note; mentions added
+	// with the edit are addressed in addition to the original
+	// recipients
+
+	prop.SetIdOn(note, iri)
+	note.SetActivityStreamsAttributedTo(original.GetActivityStreamsAttributedTo())
+	note.SetActivityStreamsPublished(original.GetActivityStreamsPublished())
+	note.SetActivityStreamsInReplyTo(original.GetActivityStreamsInReplyTo())
+	note.SetActivityStreamsTo(original.GetActivityStreamsTo())
+
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, prop.IRIs(original, "cc"))
+
+	for _, recipient := range prop.IRIs(note, "cc") {
+		if !util.UrlIn(recipient, prop.IRIs(original, "to", "cc")) {
+			cc.AppendIRI(recipient)
+		}
+	}
+
+	note.SetActivityStreamsCc(cc)
+
+	updated := streams.NewActivityStreamsUpdatedProperty()
+	updated.Set(time.Now())
+	note.SetActivityStreamsUpdated(updated)
+
+	// the edit only replaces the content; attachments, hashtags
+	// and whatever else the original had stay
+
+	edited, err := carryOver(original, note)
+	if err != nil {
+		return err
+	}
+
+	return fc.update(edited)
+}
+
+func (fc *fedbaseclient) Delete(iri *url.URL) error {
+	if obj, err := fc.own(iri); err != nil {
+		return err
+	} else {
+		return fc.remove(obj)
+	}
+}
+
+func (fc *fedbaseclient) UpdateProfile(profile *db.FedProfile) error {
+	mappings := ProfileMappings(profile)
+
+	mappings["@context"] = "https://www.w3.org/ns/activitystreams"
+	mappings["type"] = "Person"
+	mappings["id"] = fc.iri.String()
+
+	// an empty display name means that the username is shown
+	// instead; remove fields that were cleared
+
+	if _, ok := mappings["name"]; !ok {
+		mappings["name"] = fc.username
+	}
+
+	if _, ok := mappings["summary"]; !ok {
+		mappings["summary"] = ""
+	}
+
+	if _, ok := mappings["attachment"]; !ok {
+		mappings["attachment"] = []interface{}{}
+	}
+
+	obj, err := streams.ToType(context.Background(), mappings)
+	if err != nil {
+		return errors.Wrap(err, "cannot build actor")
+	}
+
+	return fc.update(obj)
+}
+
 func (fc *fedbaseclient) Like(iri *url.URL) error {
 	return fc.like(iri)
 }
 
+func (fc *fedbaseclient) Repeat(iri *url.URL) error {
+	return fc.repeat(iri)
+}
+
+func (fc *fedbaseclient) Unrepeat(iri *url.URL) error {
+	announce, err := fc.FindInOutbox(func(activity vocab.Type) bool {
+		_, ok := activity.(vocab.ActivityStreamsAnnounce)
+		return ok && util.UrlIn(iri, prop.IRIs(activity, "object"))
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, "iri=%v was not repeated", iri)
+	}
+
+	return fc.undo(announce)
+}
+
+func (fc *fedbaseclient) Follow(iri *url.URL) error {
+	return fc.follow(iri)
+}
+
+func (fc *fedbaseclient) Unfollow(iri *url.URL) error {
+	follow, err := fc.FindInOutbox(func(activity vocab.Type) bool {
+		_, ok := activity.(vocab.ActivityStreamsFollow)
+		return ok && util.UrlIn(iri, prop.IRIs(activity, "object"))
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, "iri=%v was not followed", iri)
+	}
+
+	return fc.undo(follow)
+}
+
+func (fc *fedbaseclient) Block(iri *url.URL) error {
+	return fc.block(iri)
+}
+
+func (fc *fedbaseclient) Unblock(iri *url.URL) error {
+	block, err := fc.FindInOutbox(func(activity vocab.Type) bool {
+		_, ok := activity.(vocab.ActivityStreamsBlock)
+		return ok && util.UrlIn(iri, prop.IRIs(activity, "object"))
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, "iri=%v was not blocked", iri)
+	}
+
+	return fc.undo(block)
+}
+
+// Return the object at iri if it was authored by the owner of this
+// client. Otherwise an error is returned.
+func (fc *fedbaseclient) own(iri *url.URL) (vocab.Type, error) {
+	// our credentials must never leave this instance; objects of our
+	// users are always local anyways
+
+	if !(fediri.IRI{iri}).IsLocal() {
+		return nil, errors.NewfWith(http.StatusForbidden, "iri=%v is not local", iri)
+	}
+
+	obj, err := fc.get(iri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot fetch iri=%v", iri)
+	}
+
+	if !util.UrlIn(fc.iri, prop.IRIs(obj, "attributedTo")) {
+		return nil, errors.NewfWith(http.StatusForbidden, "iri=%v not authored by user=%v", iri, fc.username)
+	}
+
+	return obj, nil
+}
+
+// Properties of the original that carryOver does not copy as they
+// are replaced by an edit.
+var _EDITED_PROPERTIES = map[string]bool{
+	"content": true, "contentMap": true, "source": true, "updated": true,
+}
+
+// Return edited with all properties of original added that edited
+// does not set itself. Tags of both are merged.
+func carryOver(original, edited vocab.Type) (vocab.Type, error) {
+	om, err := marshal.VocabToMap(original)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize original")
+	}
+
+	em, err := marshal.VocabToMap(edited)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize edit")
+	}
+
+	for key, value := range om {
+		if _, ok := em[key]; !ok && !_EDITED_PROPERTIES[key] {
+			em[key] = value
+		}
+	}
+
+	if tags := mergeTags(om["tag"], em["tag"]); len(tags) > 0 {
+		em["tag"] = tags
+	}
+
+	bs, err := json.Marshal(em)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize edit")
+	}
+
+	return marshal.BytesToVocab(bs)
+}
+
+// Return the tags in serialized tag properties a and b without
+// duplicates.
+func mergeTags(a, b interface{}) []interface{} {
+	var merged []interface{}
+	seen := make(map[string]bool)
+
+	for _, value := range []interface{}{a, b} {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+
+			key := fmt.Sprint(v)
+
+			if m, ok := v.(map[string]interface{}); ok {
+				key = fmt.Sprint(m["type"], " ", m["name"], " ", m["href"])
+			}
+
+			if !seen[key] {
+				seen[key] = true
+				merged = append(merged, v)
+			}
+		}
+	}
+
+	return merged
+}
+
+// Return the most recent activity in the outbox for which match
+// returns true. We need the original activity when undoing it.
+func (fc *fedbaseclient) FindInOutbox(match func(vocab.Type) bool) (vocab.Type, error) {
+	outbox, err := fc.Outbox()
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := fetch.FetchIters(outbox)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot look up outbox")
+	}
+
+	for _, activity := range activities {
+		if match(activity) {
+			return activity, nil
+		}
+	}
+
+	return nil, errors.New("no matching activity in outbox")
+}
+
+// Fetch the collection at target and all objects it contains.
+//
+// Collections like the inbox and the objects in them might not be
+// public, which is why we use fc.Get for the items. Items that
+// cannot be fetched are skipped.
 func (fc *fedbaseclient) fetchCollection(target *url.URL) (fetch.Iter, error) {
-	collection, err := fetch.Fetch(target)
+	collection, err := fc.get(target)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not fetch collection")
 	}
 
-	return fetch.Begin(collection)
+	it, err := fetch.Begin(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var vs []vocab.Type
+
+	for ; it != it.End(); it = it.Next() {
+		if !it.HasAny() {
+			continue
+		}
+
+		if !it.IsIRI() {
+			vs = append(vs, it.GetType())
+			continue
+		}
+
+		if obj, err := fc.Get(it.GetIRI()); err != nil {
+			log.Printf("skipping item=%v: %v", it.GetIRI(), err)
+		} else {
+			vs = append(vs, obj)
+		}
+	}
+
+	return fetch.Slice(vs), nil
+}
+
+// Return the endpoint with given name (e.g. "uploadMedia") from the
+// endpoints property of actor.
+func getEndpoint(actor vocab.Type, name string) (*url.URL, error) {
+	mappings, err := actor.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize actor")
+	}
+
+	endpoints, ok := mappings["endpoints"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("actor has no endpoints")
+	}
+
+	if addrs := prop.Strings(endpoints[name]); len(addrs) == 0 {
+		return nil, fmt.Errorf("actor has no endpoint=%v", name)
+	} else {
+		return url.Parse(addrs[0])
+	}
 }
 
 func getIRI(ie fetch.IterEntry) (*url.URL, error) {
@@ -0,0 +1,29 @@
+package fedcontext
+
+import (
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	hashtag := map[string]interface{}{
+		"type": "Hashtag",
+		"name": "#fed",
+		"href": "https://example.com/tags/fed",
+	}
+
+	mention := map[string]interface{}{
+		"type": "Mention",
+		"name": "@bob@example.com",
+		"href": "https://example.com/bob",
+	}
+
+	merged := mergeTags(hashtag, []interface{}{mention, hashtag})
+
+	if len(merged) != 2 {
+		t.Errorf("got merged=%v", merged)
+	}
+
+	if merged := mergeTags(nil, nil); len(merged) != 0 {
+		t.Errorf("got merged=%v", merged)
+	}
+}
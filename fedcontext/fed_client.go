@@ -2,7 +2,9 @@ package fedcontext
 
 import (
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
 	"github.com/kissen/fed/fetch"
+	"io"
 	"net/url"
 )
 
@@ -43,10 +45,70 @@ type FedClient interface {
 	// Return the IRI to the collection of actors that follow this user.
 	FollowersIRI() *url.URL
 
+	// Return the object at iri. Objects on this instance are fetched
+	// with the permissions of this user; for remote objects we do
+	// not hand out our credentials.
+	Get(iri *url.URL) (vocab.Type, error)
+
+	// Return the most recent activity in the outbox of this user
+	// for which match returns true.
+	FindInOutbox(match func(vocab.Type) bool) (vocab.Type, error)
+
+	// Return the IRI of the endpoint this user uploads files to.
+	UploadMediaIRI() *url.URL
+
+	// Upload the contents of file. Filename is the name of the
+	// file on the client, name the description of the file for
+	// people that cannot see it. Returns the object that can be
+	// attached to notes.
+	Upload(file io.Reader, filename, name string) (vocab.Type, error)
+
 	// Wrap event into an Create activity and submit
-	// it to the users outbox.
-	Create(event vocab.Type) error
+	// it to the users outbox. Event and Create are addressed
+	// according to visibility. Returns the IRI the outbox assigned
+	// to the Create; nil if the outbox did not tell.
+	Create(event vocab.Type, visibility Visibility) (*url.URL, error)
+
+	// Submit note as a reply to the object at parent. This sets the
+	// inReplyTo property and addresses note to the author of parent
+	// and everyone they mentioned. Returns the IRI of the Create
+	// like Create does.
+	Reply(parent *url.URL, note vocab.ActivityStreamsNote, visibility Visibility) (*url.URL, error)
+
+	// Replace the object at iri authored by this user with note.
+	// Identity, authorship and addressing are kept from the original.
+	// The edited note is submitted as an Update activity.
+	Edit(iri *url.URL, note vocab.ActivityStreamsNote) error
+
+	// Delete the object at iri authored by this user.
+	Delete(iri *url.URL) error
+
+	// Replace the profile of this user with profile. The new
+	// profile is submitted as an Update of the actor of this
+	// user and as such reaches the followers of this user.
+	UpdateProfile(profile *db.FedProfile) error
 
 	// Like the object at iri.
 	Like(iri *url.URL) error
+
+	// Repeat (announce) the object at iri to the followers of
+	// this user.
+	Repeat(iri *url.URL) error
+
+	// Undo an earlier repeat of the object at iri.
+	Unrepeat(iri *url.URL) error
+
+	// Send a follow request to the actor at iri.
+	Follow(iri *url.URL) error
+
+	// Stop following the actor at iri. This also withdraws
+	// follow requests that were not answered yet.
+	Unfollow(iri *url.URL) error
+
+	// Block the actor at iri. Blocking also ends following
+	// in both directions.
+	Block(iri *url.URL) error
+
+	// Undo an earlier block of the actor at iri.
+	Unblock(iri *url.URL) error
 }
@@ -2,13 +2,14 @@ package fedcontext
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"github.com/go-fed/activity/pub"
 	"github.com/kissen/fed/db"
 	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/util"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 // The key used in the HTTP request under which we store our
@@ -56,6 +57,21 @@ type RequestContext struct {
 	// Currently logged in user for this session. Might be nil in
 	// which case nobody is logged in.
 	Client FedClient
+
+	// What Client may do as granted to the token it authenticated
+	// with. Empty if there is no Client.
+	Scope db.FedOAuthScope
+
+	// The actor that issued this request. This is either the actor
+	// of the logged in Client or a remote actor that signed the
+	// request with an HTTP signature. Might be nil for anonymous
+	// requests.
+	Requester *url.URL
+
+	// The remote actor that signed this request with an HTTP
+	// signature we verified. Nil if the request was not signed or
+	// the signature did not check out.
+	Signer *url.URL
 }
 
 // Volatile context of the web interface. This information is only valid
@@ -76,6 +92,14 @@ type CookieContext struct {
 	// to OAuth tokens. Might be nil.
 	Token *string
 
+	// Token that has to be submitted with every form of the web
+	// interface that changes state. Protects against cross-site
+	// request forgery.
+	CSRF string
+
+	// Login that still waits for the second factor. Might be nil.
+	PendingLogin *PendingLogin
+
 	// Flashes to display on top of the page. Might be nil.
 	Flashs []string
 
@@ -88,6 +112,21 @@ type CookieContext struct {
 	Errors []string
 }
 
+// A login that passed the password check but still waits for the
+// second factor.
+type PendingLogin struct {
+	// The user logging in.
+	Username string
+
+	// Until when the second factor may be entered.
+	Until time.Time
+}
+
+// Return whether the login may still be completed.
+func (pl *PendingLogin) Valid() bool {
+	return pl != nil && time.Now().Before(pl.Until)
+}
+
 // Return whether a user is currently logged in.
 func (fwc *FedContext) LoggedIn() bool {
 	return fwc.Client != nil
@@ -106,11 +145,12 @@ func (cc *CookieContext) LoadFromCookie(r *http.Request) error {
 		return errors.Wrap(err, "error retrieving cookie")
 	}
 
-	// convert the base64 value of the cookie to json binary data
+	// decrypt the cookie value to json binary data; cookies we
+	// did not write ourselves are rejected here
 
-	text, err := base64.StdEncoding.DecodeString(cookie.Value)
+	text, err := openCookie(cookie.Value)
 	if err != nil {
-		return errors.Wrap(err, "cookie value malformed base64")
+		return err
 	}
 
 	// try to interpret the contents of the cookie
@@ -127,6 +167,8 @@ func (cc *CookieContext) LoadFromCookie(r *http.Request) error {
 	cc.Flashs = buf.Flashs
 	cc.Warnings = buf.Warnings
 	cc.Errors = buf.Errors
+	cc.CSRF = buf.CSRF
+	cc.PendingLogin = buf.PendingLogin
 
 	cc.Token = nil
 
@@ -147,15 +189,23 @@ func (cc *CookieContext) WriteToCookie(w http.ResponseWriter) error {
 		return errors.Wrap(err, "cookie marshal failed")
 	}
 
-	// convert json to base64; cookies are picky about what
-	// they contain after all
-	encoded := base64.StdEncoding.EncodeToString(text)
+	// encrypt json; the cookie contains the session token
+	// which nobody but the browser should learn about
+	encoded, err := sealCookie(text)
+	if err != nil {
+		return err
+	}
 
-	// build up cookie struct
+	// build up cookie struct; scripts have no business reading
+	// it and it should not be sent along with requests started
+	// by other sites
 	cookie := http.Cookie{
-		Name:  _COOKIE_CONTEXT_KEY,
-		Value: encoded,
-		Path:  "/",
+		Name:     _COOKIE_CONTEXT_KEY,
+		Value:    encoded,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
 	}
 
 	// send out cookie wit the response
@@ -164,6 +214,14 @@ func (cc *CookieContext) WriteToCookie(w http.ResponseWriter) error {
 	return nil
 }
 
+// Start a new session, that is forget the token and create a new
+// CSRF token. Call this when users log in or out.
+func (cc *CookieContext) NewSession(token *string) {
+	cc.Token = token
+	cc.CSRF = newCSRFToken()
+	cc.PendingLogin = nil
+}
+
 // Set all flash slices to nil. It makes sense to call this method after we ensured
 // that all flashes were shown to the user.
 func (cc *CookieContext) ClearFlashes() {
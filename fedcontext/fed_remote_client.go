@@ -4,43 +4,97 @@ import (
 	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fetch"
 	"github.com/kissen/fed/prop"
-	"github.com/kissen/fed/util"
+	"io"
 	"net/url"
 	"time"
 )
 
-func NewRemoteClient(actoraddr, token string) (FedClient, error) {
-	bc := &fedbaseclient{}
+// Return a client for the actor at actoraddr that talks to the
+// instance over HTTP. Requests carry authorization as Authorization
+// header, e.g. "Bearer" followed by an OAuth token.
+func NewRemoteClient(storage db.Storer, actoraddr, authorization string) (FedClient, error) {
+	bc := &fedbaseclient{
+		storage: storage,
+	}
 
 	if err := bc.fill(actoraddr); err != nil {
 		return nil, err
 	}
 
-	bc.create = func(event vocab.Type) error {
+	bc.upload = func(file io.Reader, filename, name string) (vocab.Type, error) {
+		return fetch.Upload(file, filename, name, bc.UploadMediaIRI(), authorization)
+	}
+
+	bc.create = func(event vocab.Type) (*url.URL, error) {
 		if create, err := createCreate(bc, event); err != nil {
+			return nil, err
+		} else {
+			target := bc.OutboxIRI()
+			return fetch.SubmitAuthorizedLocated(create, target, authorization)
+		}
+
+	}
+
+	bc.update = func(obj vocab.Type) error {
+		if update, err := createUpdate(bc, obj); err != nil {
 			return err
 		} else {
 			target := bc.OutboxIRI()
-			return submitWithToken(create, target, token)
+			return fetch.SubmitAuthorized(update, target, authorization)
 		}
+	}
 
+	bc.remove = func(obj vocab.Type) error {
+		del := createDelete(bc, obj)
+		target := bc.OutboxIRI()
+		return fetch.SubmitAuthorized(del, target, authorization)
 	}
 
 	bc.like = func(iri *url.URL) error {
 		like := createLike(bc, iri)
 		target := bc.OutboxIRI()
-		return submitWithToken(like, target, token)
+		return fetch.SubmitAuthorized(like, target, authorization)
 	}
 
-	return bc, nil
-}
+	bc.repeat = func(iri *url.URL) error {
+		if announce, err := createAnnounce(bc, iri); err != nil {
+			return err
+		} else {
+			target := bc.OutboxIRI()
+			return fetch.SubmitAuthorized(announce, target, authorization)
+		}
+	}
 
-// Submit obj to target with OAuth token authorization.
-func submitWithToken(obj vocab.Type, target *url.URL, token string) error {
-	target = util.WithParam(target, "token", token)
-	return fetch.Submit(obj, target)
+	bc.follow = func(iri *url.URL) error {
+		follow := createFollow(bc, iri)
+		target := bc.OutboxIRI()
+		return fetch.SubmitAuthorized(follow, target, authorization)
+	}
+
+	bc.block = func(iri *url.URL) error {
+		block := createBlock(bc, iri)
+		target := bc.OutboxIRI()
+		return fetch.SubmitAuthorized(block, target, authorization)
+	}
+
+	bc.undo = func(activity vocab.Type) error {
+		if undo, err := createUndo(bc, activity); err != nil {
+			return err
+		} else {
+			target := bc.OutboxIRI()
+			return fetch.SubmitAuthorized(undo, target, authorization)
+		}
+	}
+
+	bc.get = func(iri *url.URL) (vocab.Type, error) {
+		return fetch.FetchAuthorized(iri, authorization)
+	}
+
+	return bc, nil
 }
 
 // Wrap event into a Create activity.
@@ -66,13 +120,64 @@ func createCreate(fc FedClient, event vocab.Type) (vocab.ActivityStreamsCreate,
 	published := streams.NewActivityStreamsPublishedProperty()
 	published.Set(publishedDate)
 	create.SetActivityStreamsPublished(published)
-	audience := streams.NewActivityStreamsAudienceProperty()
-	audience.AppendIRI(fc.FollowersIRI())
-	create.SetActivityStreamsAudience(audience)
+	to := streams.NewActivityStreamsToProperty()
+	prop.AppendIRIs(to, prop.IRIs(note, "to"))
+	create.SetActivityStreamsTo(to)
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, prop.IRIs(note, "cc"))
+	create.SetActivityStreamsCc(cc)
 
 	return create, nil
 }
 
+// Wrap obj into an Update activity. The Update is addressed to the
+// same recipients as obj. Actors are not addressed to anyone, so
+// updates of actors go to the public and the followers of fc.
+func createUpdate(fc FedClient, obj vocab.Type) (vocab.ActivityStreamsUpdate, error) {
+	update := streams.NewActivityStreamsUpdate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	update.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	if err := object.AppendType(obj); err != nil {
+		return nil, errors.Wrap(err, "cannot update object")
+	}
+	update.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	cc := streams.NewActivityStreamsCcProperty()
+	if _, ok := obj.(vocab.ActivityStreamsPerson); ok {
+		to.AppendIRI(publicIRI())
+		cc.AppendIRI(fc.FollowersIRI())
+	} else {
+		prop.AppendIRIs(to, prop.IRIs(obj, "to"))
+		prop.AppendIRIs(cc, prop.IRIs(obj, "cc"))
+	}
+	update.SetActivityStreamsTo(to)
+	update.SetActivityStreamsCc(cc)
+
+	return update, nil
+}
+
+// Create a Delete activity for obj. The Delete is addressed to the
+// same recipients as obj so everyone who got it learns that it is
+// gone.
+func createDelete(fc FedClient, obj vocab.Type) vocab.ActivityStreamsDelete {
+	del := streams.NewActivityStreamsDelete()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	del.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(prop.Id(obj))
+	del.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	prop.AppendIRIs(to, prop.IRIs(obj, "to"))
+	del.SetActivityStreamsTo(to)
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, prop.IRIs(obj, "cc"))
+	del.SetActivityStreamsCc(cc)
+	return del
+}
+
 // Create a Like activity for the object at iri.
 func createLike(fc FedClient, iri *url.URL) vocab.ActivityStreamsLike {
 	like := streams.NewActivityStreamsLike()
@@ -81,3 +186,93 @@ func createLike(fc FedClient, iri *url.URL) vocab.ActivityStreamsLike {
 	like.SetActivityStreamsObject(object)
 	return like
 }
+
+// Create an Announce activity for the object at iri. It is addressed
+// to the public and the followers of fc; the author of the original
+// object is put in cc.
+func createAnnounce(fc FedClient, iri *url.URL) (vocab.ActivityStreamsAnnounce, error) {
+	original, err := fc.Get(iri)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch object to repeat")
+	}
+
+	announce := streams.NewActivityStreamsAnnounce()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	announce.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(iri)
+	announce.SetActivityStreamsObject(object)
+	published := streams.NewActivityStreamsPublishedProperty()
+	published.Set(time.Now())
+	announce.SetActivityStreamsPublished(published)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(publicIRI())
+	to.AppendIRI(fc.FollowersIRI())
+	announce.SetActivityStreamsTo(to)
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, prop.IRIs(original, "attributedTo"))
+	announce.SetActivityStreamsCc(cc)
+
+	return announce, nil
+}
+
+// Create a Follow activity for the actor at iri.
+func createFollow(fc FedClient, iri *url.URL) vocab.ActivityStreamsFollow {
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	follow.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(iri)
+	follow.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(iri)
+	follow.SetActivityStreamsTo(to)
+	return follow
+}
+
+// Create a Block activity for the actor at iri. Blocks are not
+// addressed to anyone; the blocked actor should not learn about it.
+func createBlock(fc FedClient, iri *url.URL) vocab.ActivityStreamsBlock {
+	block := streams.NewActivityStreamsBlock()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	block.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(iri)
+	block.SetActivityStreamsObject(object)
+	return block
+}
+
+// Create an Undo activity that undoes activity. The addressing is
+// copied from activity so the Undo reaches everyone who got the
+// original activity.
+func createUndo(fc FedClient, activity vocab.Type) (vocab.ActivityStreamsUndo, error) {
+	undo := streams.NewActivityStreamsUndo()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(fc.IRI())
+	undo.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	if err := object.AppendType(activity); err != nil {
+		return nil, errors.Wrap(err, "cannot undo activity")
+	}
+	undo.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	prop.AppendIRIs(to, prop.IRIs(activity, "to"))
+	undo.SetActivityStreamsTo(to)
+	cc := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(cc, prop.IRIs(activity, "cc"))
+	undo.SetActivityStreamsCc(cc)
+
+	return undo, nil
+}
+
+// Return the IRI of the public collection.
+func publicIRI() *url.URL {
+	if iri, err := url.Parse(prop.PUBLIC); err != nil {
+		panic(err)
+	} else {
+		return iri
+	}
+}
@@ -0,0 +1,168 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
+	"github.com/microcosm-cc/bluemonday"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// How many ancestors of an object we look at at most when checking
+// whether it is part of a muted thread.
+const _MAX_THREAD_DEPTH = 16
+
+// Return whether obj is hidden from user by any of the mutes user
+// set up. Expired mutes are ignored. Ancestors of obj are looked up
+// in s or, if we do not have them, fetched.
+func Muted(s db.Storer, user *db.FedUser, obj vocab.Type) bool {
+	mutes := user.ActiveMutes()
+	if len(mutes) == 0 {
+		return false
+	}
+
+	mappings, err := obj.Serialize()
+	if err != nil {
+		log.Println("cannot serialize:", err)
+		return false
+	}
+
+	var threads []*db.FedMute
+
+	for _, mute := range mutes {
+		if matches(mute, mappings) {
+			return true
+		}
+
+		if mute.Kind == db.MUTE_THREAD {
+			threads = append(threads, mute)
+		}
+	}
+
+	if len(threads) == 0 {
+		return false
+	}
+
+	// replies deep down a thread only name their direct parent, so
+	// we have to walk up the inReplyTo chain to find out whether
+	// they belong to a muted thread
+
+	seen := make(map[string]bool)
+	pending := parents(mappings)
+
+	for depth := 0; depth < _MAX_THREAD_DEPTH && len(pending) > 0; depth++ {
+		next := pending[0]
+		pending = pending[1:]
+
+		if seen[next] {
+			continue
+		} else {
+			seen[next] = true
+		}
+
+		parent, err := ancestor(s, next)
+		if err != nil {
+			log.Printf("cannot look up ancestor=%v: %v", next, err)
+			continue
+		}
+
+		for _, mute := range threads {
+			if matches(mute, parent) {
+				return true
+			}
+		}
+
+		pending = append(pending, parents(parent)...)
+	}
+
+	return false
+}
+
+// Return the IRIs the serialized object in mappings is a reply to.
+// Embedded objects (e.g. the Note in a Create) are considered as
+// well.
+func parents(mappings map[string]interface{}) []string {
+	ps := prop.Strings(mappings["inReplyTo"])
+
+	if embedded, ok := mappings["object"].(map[string]interface{}); ok {
+		ps = append(ps, parents(embedded)...)
+	}
+
+	return ps
+}
+
+// Return the serialized object at addr. Objects we do not have in
+// storage are fetched, but only from the public internet as addr
+// comes from whoever wrote the reply.
+func ancestor(s db.Storer, addr string) (map[string]interface{}, error) {
+	iri, err := url.Parse(addr)
+	if err != nil || !iri.IsAbs() {
+		return nil, errors.Newf("addr=%v is not an iri", addr)
+	}
+
+	obj, err := s.RetrieveObject(iri)
+	if err != nil {
+		if obj, err = fetch.FetchPublic(iri); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj.Serialize()
+}
+
+// Return whether mute matches the serialized object in mappings.
+// Embedded objects (e.g. the Note in a Create) are considered
+// as well.
+func matches(mute *db.FedMute, mappings map[string]interface{}) bool {
+	var keys []string
+
+	switch mute.Kind {
+	case db.MUTE_ACTOR:
+		keys = []string{"attributedTo", "actor"}
+	case db.MUTE_THREAD:
+		keys = []string{"id", "inReplyTo", "context", "conversation"}
+	case db.MUTE_KEYWORD:
+		return containsKeyword(mappings, mute.Value)
+	default:
+		return false
+	}
+
+	for _, key := range keys {
+		for _, s := range prop.Strings(mappings[key]) {
+			if s == mute.Value {
+				return true
+			}
+		}
+	}
+
+	if embedded, ok := mappings["object"].(map[string]interface{}); ok {
+		return matches(mute, embedded)
+	}
+
+	return false
+}
+
+// Return whether the text of the serialized object in mappings
+// contains keyword. The comparison ignores case and markup.
+func containsKeyword(mappings map[string]interface{}, keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	policy := bluemonday.StrictPolicy()
+
+	for _, key := range []string{"content", "summary", "name"} {
+		if text, ok := mappings[key].(string); ok {
+			if strings.Contains(strings.ToLower(policy.Sanitize(text)), keyword) {
+				return true
+			}
+		}
+	}
+
+	if embedded, ok := mappings["object"].(map[string]interface{}); ok {
+		return containsKeyword(embedded, keyword)
+	}
+
+	return false
+}
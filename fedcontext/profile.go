@@ -0,0 +1,175 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/prop"
+	"github.com/microcosm-cc/bluemonday"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Return the properties that represent profile on an actor object.
+//
+// Profile fields are Mastodon-style PropertyValue objects which go-fed
+// has no types for, which is why we work on the serialized form here;
+// go-fed keeps unknown properties around when deserializing.
+func ProfileMappings(profile *db.FedProfile) map[string]interface{} {
+	mappings := make(map[string]interface{})
+
+	if profile.DisplayName != "" {
+		mappings["name"] = profile.DisplayName
+	}
+
+	if profile.Summary != "" {
+		mappings["summary"] = profile.Summary
+	}
+
+	if profile.Icon != nil {
+		mappings["icon"] = imageMappings(profile.Icon)
+	}
+
+	if profile.Image != nil {
+		mappings["image"] = imageMappings(profile.Image)
+	}
+
+	var fields []interface{}
+
+	for _, field := range profile.Fields {
+		m := map[string]interface{}{
+			"type":  "PropertyValue",
+			"name":  field.Name,
+			"value": fieldHTML(field),
+		}
+
+		if field.VerifiedAt != nil {
+			m["verified_at"] = field.VerifiedAt.UTC().Format(time.RFC3339)
+		}
+
+		fields = append(fields, m)
+	}
+
+	if len(fields) > 0 {
+		mappings["attachment"] = fields
+	}
+
+	return mappings
+}
+
+// Extract the profile from actor. The summary is sanitized; profile
+// fields are converted to plain text. Verification of profile fields
+// is not taken from actor; we only trust our own checks.
+func ParseProfile(actor vocab.Type) (*db.FedProfile, error) {
+	mappings, err := actor.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize actor")
+	}
+
+	profile := &db.FedProfile{}
+
+	profile.DisplayName, _ = mappings["name"].(string)
+	profile.DisplayName = text(profile.DisplayName)
+
+	if summary, ok := mappings["summary"].(string); ok {
+		profile.Summary = profilePolicy().Sanitize(summary)
+	}
+
+	profile.Icon = imageURL(mappings["icon"])
+	profile.Image = imageURL(mappings["image"])
+
+	for _, entry := range entries(mappings["attachment"]) {
+		if entry["type"] != "PropertyValue" {
+			continue
+		}
+
+		name, _ := entry["name"].(string)
+		value, _ := entry["value"].(string)
+
+		if field := db.NewFedProfileField(text(name), text(value)); field != nil {
+			profile.Fields = append(profile.Fields, field)
+		}
+	}
+
+	if len(profile.Fields) > db.MAX_PROFILE_FIELDS {
+		profile.Fields = profile.Fields[:db.MAX_PROFILE_FIELDS]
+	}
+
+	return profile, nil
+}
+
+// Return the policy for HTML in profiles. It allows what the
+// web interface renders; there is no point in keeping anything
+// else around.
+func profilePolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+
+	policy.AllowStandardURLs()
+	policy.AllowAttrs("href", "rel").OnElements("a")
+	policy.AllowAttrs("class").OnElements("a", "span")
+	policy.AllowElements("p", "br", "span")
+
+	return policy
+}
+
+// Return the plain text contained in the HTML in s.
+func text(s string) string {
+	stripped := bluemonday.StrictPolicy().Sanitize(s)
+	return strings.TrimSpace(html.UnescapeString(stripped))
+}
+
+// Return the HTML for the value of field. Values that are links are
+// turned into anchors; rel=me allows others to verify that the linked
+// page belongs to the owner of the profile.
+func fieldHTML(field *db.FedProfileField) string {
+	escaped := html.EscapeString(field.Value)
+
+	if field.Link() == nil {
+		return escaped
+	}
+
+	return `<a href="` + escaped + `" rel="me nofollow noopener" target="_blank">` + escaped + `</a>`
+}
+
+// Return an embedded Image object that points to addr.
+func imageMappings(addr *url.URL) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "Image",
+		"url":  addr.String(),
+	}
+}
+
+// Return the URL of the image in value which is the serialized
+// form of the icon or image property. Returns nil if there is none.
+func imageURL(value interface{}) *url.URL {
+	if images := entries(value); len(images) > 0 {
+		value = images[0]["url"]
+	}
+
+	for _, addr := range prop.Strings(value) {
+		if u, err := url.Parse(addr); err == nil && u.Host != "" {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// Return the embedded objects in value which is the serialized form
+// of a property. Values that are not objects are skipped.
+func entries(value interface{}) (ms []map[string]interface{}) {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			ms = append(ms, m)
+		}
+	}
+
+	return ms
+}
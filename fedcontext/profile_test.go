@@ -0,0 +1,64 @@
+package fedcontext
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/kissen/fed/db"
+	"net/url"
+	"testing"
+)
+
+func TestProfileRoundTrip(t *testing.T) {
+	icon, _ := url.Parse("https://example.com/media/avatar")
+
+	profile := &db.FedProfile{
+		DisplayName: "Alice",
+		Summary:     `<p>Hello <script>alert(1)</script>world</p>`,
+		Icon:        icon,
+		Fields: []*db.FedProfileField{
+			db.NewFedProfileField("Website", "https://alice.example.com/"),
+			db.NewFedProfileField("Pronouns", "she/her & <b>"),
+		},
+	}
+
+	mappings := ProfileMappings(profile)
+	mappings["@context"] = "https://www.w3.org/ns/activitystreams"
+	mappings["type"] = "Person"
+	mappings["id"] = "https://example.com/alice"
+
+	actor, err := streams.ToType(context.Background(), mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseProfile(actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.DisplayName != "Alice" {
+		t.Errorf("bad display name=%v", parsed.DisplayName)
+	}
+
+	if parsed.Summary != "<p>Hello world</p>" {
+		t.Errorf("summary not sanitized summary=%v", parsed.Summary)
+	}
+
+	if parsed.Icon == nil || parsed.Icon.String() != icon.String() {
+		t.Errorf("bad icon=%v", parsed.Icon)
+	}
+
+	if parsed.Image != nil {
+		t.Errorf("unexpected image=%v", parsed.Image)
+	}
+
+	if len(parsed.Fields) != 2 {
+		t.Fatalf("bad number of fields expected=2 got=%v", len(parsed.Fields))
+	}
+
+	for i, field := range profile.Fields {
+		if *parsed.Fields[i] != *field {
+			t.Errorf("bad field expected=%v got=%v", field, parsed.Fields[i])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/httpsig"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fetch"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How far the Date header of signed requests may be off. Older
+// signatures are rejected s.t. captured requests cannot be replayed
+// forever.
+const _SIGNATURE_MAX_SKEW = time.Hour
+
+// Headers that signatures need to cover. Without them, a signature
+// could be reused for another target, host or time.
+var _REQUIRED_SIGNED_HEADERS = []string{
+	"(request-target)", "host", "date",
+}
+
+// Set the Requester and Signer fields on fc. Logged in clients are
+// identified by their actor IRI if their token allows them to read
+// statuses. Other requests might carry an HTTP signature of a remote
+// actor, which we verify.
+//
+// Call this after setClientOn.
+func setRequesterOn(fc *FedContext, from *http.Request) {
+	if fc.Client != nil {
+		if fc.Scope.Allows("read:statuses") {
+			fc.Requester = fc.Client.IRI()
+		}
+
+		return
+	}
+
+	if len(from.Header.Get("Signature")) == 0 {
+		return
+	}
+
+	if signer, err := verifySignature(from); err != nil {
+		log.Printf("rejecting HTTP signature: %v", err)
+	} else {
+		fc.Requester = signer
+		fc.Signer = signer
+		log.Printf("authenticated requester=%v with HTTP signature", signer)
+	}
+}
+
+// Verify the HTTP signature of r. On success, returns the IRI of the
+// actor that signed the request.
+func verifySignature(r *http.Request) (*url.URL, error) {
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed signature")
+	}
+
+	if err := checkSignedHeaders(r, time.Now()); err != nil {
+		return nil, err
+	}
+
+	keyId, err := url.Parse(verifier.KeyId())
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed keyId")
+	}
+
+	owner, key, err := fetch.PublicKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	// we do not know which algorithm the remote used; most of the
+	// fediverse uses RSA with SHA-256 so try that one first
+
+	algorithms := []httpsig.Algorithm{
+		httpsig.RSA_SHA256, httpsig.RSA_SHA512,
+	}
+
+	for _, algorithm := range algorithms {
+		if err = verifier.Verify(key, algorithm); err == nil {
+			return owner, nil
+		}
+	}
+
+	return nil, errors.Wrapf(err, "signature does not match keyId=%v", keyId)
+}
+
+// Return an error if the signature of r does not cover all headers
+// we require or if r was signed too long ago.
+func checkSignedHeaders(r *http.Request, now time.Time) error {
+	signed := strings.Fields(strings.ToLower(signatureParam(r, "headers")))
+
+	for _, required := range _REQUIRED_SIGNED_HEADERS {
+		found := false
+
+		for _, header := range signed {
+			found = found || header == required
+		}
+
+		if !found {
+			return errors.Newf("signature does not cover header=%v", required)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return errors.Wrap(err, "bad Date header")
+	}
+
+	if skew := now.Sub(date); skew > _SIGNATURE_MAX_SKEW || skew < -_SIGNATURE_MAX_SKEW {
+		return errors.Newf("signature date=%v is stale", date)
+	}
+
+	return nil
+}
+
+// Return the parameter with given name from the Signature header of
+// r. Returns the empty string if there is no such parameter.
+func signatureParam(r *http.Request, name string) string {
+	for _, param := range strings.Split(r.Header.Get("Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+
+		if len(kv) == 2 && kv[0] == name {
+			return strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return ""
+}
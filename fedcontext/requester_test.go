@@ -0,0 +1,38 @@
+package fedcontext
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, headers string, date time.Time) *http.Request {
+	r, err := http.NewRequest("POST", "https://example.com/alice/inbox", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	r.Header.Set("Signature", `keyId="https://remote.example/bob#main-key",algorithm="rsa-sha256",headers="`+headers+`",signature="AAAA"`)
+
+	return r
+}
+
+func TestCheckSignedHeaders(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	r := signedRequest(t, "(request-target) host date digest", now)
+	if err := checkSignedHeaders(r, now); err != nil {
+		t.Errorf("rejected good signature err=%v", err)
+	}
+
+	r = signedRequest(t, "date", now)
+	if err := checkSignedHeaders(r, now); err == nil {
+		t.Errorf("accepted signature that only covers date")
+	}
+
+	r = signedRequest(t, "(request-target) host date", now.Add(-2*time.Hour))
+	if err := checkSignedHeaders(r, now); err == nil {
+		t.Errorf("accepted stale signature")
+	}
+}
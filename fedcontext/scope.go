@@ -0,0 +1,34 @@
+package fedcontext
+
+import (
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"net/http"
+)
+
+// Return the scope of sessions started by logging in with the password
+// of the user with given username. Only administrators get the admin
+// scopes.
+func PasswordScope(username string) db.FedOAuthScope {
+	if config.Get().IsAdmin(username) {
+		return db.ADMIN_SCOPE
+	} else {
+		return db.USER_SCOPE
+	}
+}
+
+// Return an error if the client of fc may not do what scope covers,
+// e.g. "write:statuses". The error carries status 401 if nobody is
+// logged in and 403 if the token of the client lacks the scope.
+func (fc *FedContext) RequireScope(scope string) error {
+	if fc.Client == nil {
+		return errors.NewWith(http.StatusUnauthorized, "authentication required")
+	}
+
+	if !fc.Scope.Allows(scope) {
+		return errors.NewfWith(http.StatusForbidden, "token lacks scope=%v", scope)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
+	"log"
+	"net/url"
+	"sort"
+)
+
+// How many entries of each box we look at when building up a
+// timeline. Boxes are sorted newest first, so this limits
+// timelines to the most recent activities.
+const _TIMELINE_DEPTH = 64
+
+// Return an iterator over all public activities posted by users on
+// this instance, newest first.
+func LocalTimeline(s db.Storer) (fetch.Iter, error) {
+	users, err := s.RetrieveUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list users")
+	}
+
+	var boxes [][]*url.URL
+
+	for _, user := range users {
+		boxes = append(boxes, user.Outbox)
+	}
+
+	return publicTimeline(s, boxes...)
+}
+
+// Return an iterator over all public activities received by any
+// user on this instance, newest first.
+func FederatedTimeline(s db.Storer) (fetch.Iter, error) {
+	users, err := s.RetrieveUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list users")
+	}
+
+	var boxes [][]*url.URL
+
+	for _, user := range users {
+		boxes = append(boxes, user.Inbox)
+	}
+
+	return publicTimeline(s, boxes...)
+}
+
+// Return an iterator over all public activities posted by the
+// user with given username, newest first.
+func UserTimeline(s db.Storer, username string) (fetch.Iter, error) {
+	user, err := s.RetrieveUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicTimeline(s, user.Outbox)
+}
+
+// Return an iterator over all public activities known to this
+// instance that are tagged with hashtag, newest first.
+func TagTimeline(s db.Storer, hashtag string) (fetch.Iter, error) {
+	users, err := s.RetrieveUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list users")
+	}
+
+	var boxes [][]*url.URL
+
+	for _, user := range users {
+		boxes = append(boxes, user.Inbox, user.Outbox)
+	}
+
+	var tagged []vocab.Type
+
+	for _, obj := range publicObjects(s, boxes...) {
+		if prop.HasHashtag(obj, hashtag) {
+			tagged = append(tagged, obj)
+		}
+	}
+
+	return fetch.Slice(tagged), nil
+}
+
+// Given boxes that contain IRIs of activities, return an iterator
+// over all public activities in these boxes.
+func publicTimeline(s db.Storer, boxes ...[]*url.URL) (fetch.Iter, error) {
+	return fetch.Slice(publicObjects(s, boxes...)), nil
+}
+
+// Given boxes that contain IRIs of activities, return all public
+// activities in these boxes sorted newest first. Unlisted activities
+// and activities from blocked or silenced domains are skipped, as
+// are activities we do not have in storage. Each activity is only
+// returned once, even if it is in multiple boxes.
+func publicObjects(s db.Storer, boxes ...[]*url.URL) []vocab.Type {
+	bl := LoadBlocklist(s)
+	seen := make(map[string]bool)
+	var vs []vocab.Type
+
+	for _, box := range boxes {
+		for i, iri := range box {
+			if i >= _TIMELINE_DEPTH {
+				break
+			}
+
+			if key := iri.String(); seen[key] {
+				continue
+			} else {
+				seen[key] = true
+			}
+
+			// timelines are public, so we only show what we
+			// already have; anything else would let anonymous
+			// visitors make us fetch on every page load
+
+			obj, err := s.RetrieveObject(iri)
+			if err != nil {
+				log.Printf("skipping iri=%v: %v", iri, err)
+				continue
+			}
+
+			if prop.IsListed(obj) && !silenced(bl, obj) {
+				vs = append(vs, obj)
+			}
+		}
+	}
+
+	sort.SliceStable(vs, func(i, j int) bool {
+		ti, _ := prop.Published(vs[i])
+		tj, _ := prop.Published(vs[j])
+		return ti.After(tj)
+	})
+
+	return vs
+}
+
+// Return whether any of the authors of obj are silenced.
+func silenced(bl Blocklist, obj vocab.Type) bool {
+	for _, author := range prop.IRIs(obj, "attributedTo", "actor") {
+		if bl.Silences(author) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,103 @@
+package fedcontext
+
+import (
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"net/http"
+	"net/url"
+)
+
+// Decides who can see a post.
+type Visibility string
+
+const (
+	// Visible to everyone and shown on public timelines.
+	PUBLIC Visibility = "public"
+
+	// Visible to everyone, but not shown on public timelines.
+	UNLISTED Visibility = "unlisted"
+
+	// Only visible to followers and mentioned actors.
+	FOLLOWERS Visibility = "followers"
+
+	// Only visible to mentioned actors.
+	DIRECT Visibility = "direct"
+)
+
+// Parse s into a Visibility. The empty string is treated as PUBLIC.
+func ParseVisibility(s string) (Visibility, error) {
+	switch v := Visibility(s); v {
+	case "":
+		return PUBLIC, nil
+	case PUBLIC, UNLISTED, FOLLOWERS, DIRECT:
+		return v, nil
+	default:
+		return "", errors.NewfWith(http.StatusBadRequest, "bad visibility=%v", s)
+	}
+}
+
+// Set the to and cc properties on object according to visibility.
+// Followers is the followers collection of the author.
+//
+// Actors object is already addressed to (e.g. mentioned actors) stay
+// addressed; they are put into cc except for direct posts where
+// they end up in to.
+func Address(object vocab.Type, visibility Visibility, followers *url.URL) error {
+	type addressable interface {
+		SetActivityStreamsTo(vocab.ActivityStreamsToProperty)
+		SetActivityStreamsCc(vocab.ActivityStreamsCcProperty)
+	}
+
+	a, ok := object.(addressable)
+	if !ok {
+		return errors.Newf("%T cannot be addressed", object)
+	}
+
+	// collect everyone already addressed except for the special
+	// collections, those we set ourselves
+
+	var addressed []*url.URL
+
+	for _, iri := range prop.IRIs(object, "to", "cc") {
+		if prop.IsPublicIRI(iri) || util.UrlEq(iri, followers) || util.UrlIn(iri, addressed) {
+			continue
+		}
+
+		addressed = append(addressed, iri)
+	}
+
+	public := publicIRI()
+
+	// build up the new addressing
+
+	var to, cc []*url.URL
+
+	switch visibility {
+	case PUBLIC:
+		to = []*url.URL{public}
+		cc = append([]*url.URL{followers}, addressed...)
+	case UNLISTED:
+		to = []*url.URL{followers}
+		cc = append([]*url.URL{public}, addressed...)
+	case FOLLOWERS:
+		to = []*url.URL{followers}
+		cc = addressed
+	case DIRECT:
+		to = addressed
+	default:
+		return errors.Newf("bad visibility=%v", visibility)
+	}
+
+	toProperty := streams.NewActivityStreamsToProperty()
+	prop.AppendIRIs(toProperty, to)
+	a.SetActivityStreamsTo(toProperty)
+
+	ccProperty := streams.NewActivityStreamsCcProperty()
+	prop.AppendIRIs(ccProperty, cc)
+	a.SetActivityStreamsCc(ccProperty)
+
+	return nil
+}
@@ -59,6 +59,23 @@ func LikedIRI(owner string) IRI {
 	return NewIRI(owner, "liked")
 }
 
+// Generate the IRI of the endpoint the user with given username
+// uploads files to.
+func UploadMediaIRI(owner string) IRI {
+	return NewIRI(owner, "media")
+}
+
+// Generate the IRI under which the uploaded file with given id
+// is served.
+func MediaIRI(id string) IRI {
+	return NewIRI("media", id)
+}
+
+// Generate the IRI of the page that lists posts tagged with tag.
+func TagIRI(tag string) IRI {
+	return NewIRI("tags", tag)
+}
+
 // Generate a new object IRI with a random UUID used as an object id.
 func RollObjectIRI() IRI {
 	id := uuid.New().String()
@@ -132,13 +149,91 @@ func (iri IRI) LikedOwner() (string, error) {
 func (iri IRI) Object() (string, error) {
 	if dir, id, err := iri.split(); err != nil {
 		return "", err
-	} else if *dir != "storage" || id == nil {
+	} else if dir == nil || *dir != "storage" || id == nil {
 		return "", fmt.Errorf("Target=%v not an object", iri.Target)
 	} else {
 		return *id, nil
 	}
 }
 
+// Return the owner of the given IRI. The IRI needs to have the form
+//
+//   */{username}/media
+//
+// where the asterix is the placeholder for the base path.
+func (iri IRI) UploadMediaOwner() (string, error) {
+	return iri.owner("media")
+}
+
+// Return the owner of the given IRI. The IRI needs to have the form
+//
+//   */{username}/totp
+//
+// where the asterix is the placeholder for the base path. These
+// IRIs are used by the admin API to reset the second factor of users.
+func (iri IRI) TOTPOwner() (string, error) {
+	return iri.owner("totp")
+}
+
+// Return the media id of the given IRI. The IRI needs to have the form
+//
+//   */media/{id}
+//
+// where the asterix is the placeholder for the base path.
+func (iri IRI) Media() (string, error) {
+	if dir, id, err := iri.split(); err != nil {
+		return "", err
+	} else if dir == nil || *dir != "media" || id == nil {
+		return "", fmt.Errorf("Target=%v not a media file", iri.Target)
+	} else {
+		return *id, nil
+	}
+}
+
+// Return the domain of the given IRI. The IRI needs to have the form
+//
+//   */blocks/{domain}
+//
+// where the asterix is the placeholder for the base path. These
+// IRIs are used by the admin API to manage domain blocks.
+func (iri IRI) BlockedDomain() (string, error) {
+	if dir, domain, err := iri.split(); err != nil {
+		return "", err
+	} else if dir == nil || *dir != "blocks" || domain == nil {
+		return "", fmt.Errorf("Target=%v not a domain block", iri.Target)
+	} else {
+		return *domain, nil
+	}
+}
+
+// Return whether the IRI has the form
+//
+//   */lockouts
+//
+// where the asterix is the placeholder for the base path. This IRI
+// is used by the admin API to list failed logins.
+func (iri IRI) IsLockouts() bool {
+	dir, key, err := iri.split()
+	return err == nil && *dir == "lockouts" && key == nil
+}
+
+// Return the throttle key of the given IRI. The IRI needs to have
+// the form
+//
+//   */lockouts/{key}
+//
+// where the asterix is the placeholder for the base path. These
+// IRIs are used by the admin API to lift lockouts.
+func (iri IRI) Lockout() (string, error) {
+	if dir, key, err := iri.split(); err != nil {
+		return "", err
+	} else if *dir != "lockouts" || key == nil {
+		return "", fmt.Errorf("Target=%v not a lockout", iri.Target)
+	} else {
+		return *key, nil
+	}
+}
+
 // Return the owner of this IRI.
 func (iri IRI) Owner() (string, error) {
 	if username, _, err := iri.split(); err != nil {
@@ -150,6 +245,11 @@ func (iri IRI) Owner() (string, error) {
 	}
 }
 
+// Return whether this IRI points to a resource on this instance.
+func (iri IRI) IsLocal() bool {
+	return iri.Target.Host == config.Get().GlobalURL().Host
+}
+
 func (iri IRI) String() string {
 	return iri.Target.String()
 }
@@ -5,7 +5,10 @@ import "github.com/kissen/stringset"
 var reserved = stringset.NewWith(
 	"storage", "static", "oauth", "stream", "liked",
 	"following", "followers", "login", "logout", "remote",
-	"submit",
+	"submit", "local", "federated", "reply", "repeat", "like",
+	"follow", "search", "tags", "block", "blocks",
+	"settings", "edit", "delete", "media", "proxy", "api",
+	"lockouts",
 )
 
 // Return whether username is a reserved username, that is a name
@@ -188,7 +188,7 @@ func (b *begins) head() int {
 	for i, v := range b.values {
 		if iTime, err := prop.Published(v); err == nil {
 			if iTime.After(newestTime) {
-				newestIdx = i
+				newestIdx, newestTime = i, iTime
 			}
 		}
 	}
@@ -1,6 +1,8 @@
 package fetch
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/kissen/complcache"
 	"github.com/kissen/fed/errors"
@@ -50,6 +52,57 @@ func Fetch(iri *url.URL) (vocab.Type, error) {
 	}
 }
 
+// Fetch the resource at iri like Fetch does. The request carries
+// authorization as Authorization header.
+//
+// Cached versions are only shared between requests with the same
+// authorization; what one client may see might be hidden from another.
+func FetchAuthorized(iri *url.URL, authorization string) (vocab.Type, error) {
+	creator := func() (interface{}, error) {
+		if raw, err := get(client(), iri, _CONTENT_TYPE, authorization); err != nil {
+			return nil, err
+		} else if obj, err := marshal.BytesToVocab(raw); err != nil {
+			return nil, err
+		} else {
+			return obj, nil
+		}
+	}
+
+	sum := sha256.Sum256([]byte(authorization))
+	key := iri.String() + " " + hex.EncodeToString(sum[:])
+
+	if obj, err := fetchCache.GetOrCreate(key, creator); err != nil {
+		return nil, err
+	} else {
+		return obj.(vocab.Type), nil
+	}
+}
+
+// Fetch the resource at iri like Fetch does. The request only goes
+// out if iri points to the public internet, so use it for IRIs that
+// users gave us.
+func FetchPublic(iri *url.URL) (vocab.Type, error) {
+	creator := func() (interface{}, error) {
+		if raw, err := get(publicClient(), iri, _CONTENT_TYPE, ""); err != nil {
+			return nil, err
+		} else if obj, err := marshal.BytesToVocab(raw); err != nil {
+			return nil, err
+		} else {
+			return obj, nil
+		}
+	}
+
+	// objects fetched without restrictions might come from
+	// places public requests may not reach, so they do not
+	// share cache entries
+
+	if obj, err := fetchCache.GetOrCreate(iri.String()+" public", creator); err != nil {
+		return nil, err
+	} else {
+		return obj.(vocab.Type), nil
+	}
+}
+
 // Fetch the resource at it.
 //
 // If a cached version of the resource at iri is available, that
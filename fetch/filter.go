@@ -0,0 +1,83 @@
+package fetch
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"log"
+	"net/url"
+)
+
+// Implements the iter.Iter and iter.IterEntry interfaces. This
+// struct skips over the objects of another iterator that we do not
+// want to keep.
+type filtered struct {
+	it    Iter
+	value vocab.Type
+	keep  func(vocab.Type) bool
+}
+
+// Singleton of filtered that is returned on calls to filtered.End.
+var _FILTERED_END Iter = &filtered{}
+
+// Return an iterator over all objects in it for which keep returns
+// true. The order of objects is preserved.
+//
+// To decide whether to keep an object, IterEntrys that contain IRIs
+// are dereferenced. This happens as the returned iterator advances,
+// so callers that only look at the first few objects do not pay for
+// the rest. Objects that cannot be dereferenced are skipped.
+func Filter(it Iter, keep func(vocab.Type) bool) (Iter, error) {
+	return filterFrom(it, keep), nil
+}
+
+// Return an iterator that starts at the first object in it for which
+// keep returns true.
+func filterFrom(it Iter, keep func(vocab.Type) bool) Iter {
+	for ; it != it.End(); it = it.Next() {
+		if !it.HasAny() {
+			continue
+		}
+
+		v, err := FetchIter(it)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if keep(v) {
+			return &filtered{it: it, value: v, keep: keep}
+		}
+	}
+
+	return _FILTERED_END
+}
+
+func (f *filtered) HasAny() bool {
+	return f.value != nil
+}
+
+func (f *filtered) IsIRI() bool {
+	// we only ever contain full objects
+	return false
+}
+
+func (f *filtered) GetIRI() *url.URL {
+	// IsIRI is always false -> GetIRI never returns
+	// an actually usable value
+	return nil
+}
+
+func (f *filtered) GetType() vocab.Type {
+	return f.value
+}
+
+func (f *filtered) Next() Iter {
+	if f.it == nil {
+		return _FILTERED_END
+	}
+
+	return filterFrom(f.it.Next(), f.keep)
+}
+
+func (f *filtered) End() Iter {
+	return _FILTERED_END
+}
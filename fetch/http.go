@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/proxy"
 	"github.com/kissen/fed/util"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"sync"
@@ -20,11 +22,19 @@ const _HTTP_TIMEOUT = 8 * time.Second
 // http client for multiple use
 var cache struct {
 	sync.Mutex
-	Client *http.Client
+	Client       *http.Client
+	PublicClient *http.Client
 }
 
 // Issue an HTTP request that GETs the ActivityPub resource at iri.
 func Get(iri *url.URL) (body []byte, err error) {
+	return get(client(), iri, _CONTENT_TYPE, "")
+}
+
+// Issue an HTTP request that GETs the resource at iri with client c.
+// The Accept header is set to accept. If authorization is not empty,
+// it is sent as Authorization header.
+func get(c *http.Client, iri *url.URL, accept, authorization string) (body []byte, err error) {
 	log.Printf("Get(%v)", iri)
 
 	// build up the request
@@ -36,12 +46,14 @@ func Get(iri *url.URL) (body []byte, err error) {
 	}
 
 	setActivityPubHeaders(req)
+	setAuthorization(req, authorization)
+	req.Header.Set("Accept", accept)
 
 	// GET to the address
 
 	var resp *http.Response
 
-	if resp, err = client().Do(req); err != nil {
+	if resp, err = c.Do(req); err != nil {
 		return nil, err
 	}
 
@@ -61,6 +73,15 @@ func Get(iri *url.URL) (body []byte, err error) {
 // Issue an HTTP request that POSTs body to the ActiviyPub endpoint at
 // iri.
 func Post(body []byte, iri *url.URL) (err error) {
+	_, err = post(body, iri, "")
+	return err
+}
+
+// Issue an HTTP request that POSTs body to the ActiviyPub endpoint at
+// iri. If authorization is not empty, it is sent as Authorization
+// header. Returns the address from the Location header of the reply;
+// nil if there was none.
+func post(body []byte, iri *url.URL, authorization string) (location *url.URL, err error) {
 	log.Printf("Post(%v)", iri)
 
 	// preapre the io.Reader that contains the request body
@@ -73,17 +94,18 @@ func Post(body []byte, iri *url.URL) (err error) {
 	var req *http.Request
 
 	if req, err = http.NewRequest("POST", iri.String(), respBody); err != nil {
-		return errors.Wrap(err, "cannot set up request")
+		return nil, errors.Wrap(err, "cannot set up request")
 	}
 
 	setActivityPubHeaders(req)
+	setAuthorization(req, authorization)
 
 	// POST to the address
 
 	var resp *http.Response
 
 	if resp, err = client().Do(req); err != nil {
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
@@ -101,10 +123,18 @@ func Post(body []byte, iri *url.URL) (err error) {
 
 		// return error
 
-		return fmt.Errorf(`%v returned status="%v" body="%v"`, iri, resp.Status, body)
+		return nil, fmt.Errorf(`%v returned status="%v" body="%v"`, iri, resp.Status, body)
 	}
 
-	return nil
+	// the location might be relative to iri
+
+	if header := resp.Header.Get("Location"); header != "" {
+		if location, err = iri.Parse(header); err != nil {
+			return nil, errors.Wrapf(err, "%v returned bad location", iri)
+		}
+	}
+
+	return location, nil
 }
 
 // Return an HTTP client that may be used to interact with ActivityPub
@@ -129,6 +159,33 @@ func client() *http.Client {
 	return cache.Client
 }
 
+// Return an HTTP client like client does that only connects to
+// addresses on the public internet. Use it for requests to addresses
+// that users or remotes gave us.
+func publicClient() *http.Client {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.PublicClient == nil {
+		cache.PublicClient = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				setActivityPubHeaders(req)
+				return nil
+			},
+			Timeout: _HTTP_TIMEOUT,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout: _HTTP_TIMEOUT,
+					Control: proxy.DialPublicOnly,
+				}).DialContext,
+			},
+		}
+	}
+
+	return cache.PublicClient
+}
+
 // Set Content-Type/Accept and User-Agent headers on req such that it
 // may interact with ActivityPub services.
 func setActivityPubHeaders(req *http.Request) {
@@ -141,3 +198,11 @@ func setActivityPubHeaders(req *http.Request) {
 
 	req.Header.Set("User-Agent", "fed/0.x")
 }
+
+// Set the Authorization header on req to authorization. If
+// authorization is empty, the header is left alone.
+func setAuthorization(req *http.Request, authorization string) {
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+}
@@ -61,6 +61,14 @@ func Begin(iterable interface{}) (Iter, error) {
 		items := v.GetActivityStreamsItems()
 		return begin(items)
 
+	case vocab.ActivityStreamsCollectionPage:
+		items := v.GetActivityStreamsItems()
+		return begin(items)
+
+	case vocab.ActivityStreamsOrderedCollection:
+		items := v.GetActivityStreamsOrderedItems()
+		return begin(items)
+
 	case vocab.ActivityStreamsOrderedCollectionPage:
 		items := v.GetActivityStreamsOrderedItems()
 		return begin(items)
@@ -0,0 +1,161 @@
+package fetch
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/kissen/complcache"
+	"github.com/kissen/fed/errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+const _KEY_EXPIRATION = 10 * time.Minute
+const _KEY_FILL = 30 * time.Second
+const _KEY_GC = 10 * time.Minute
+
+// Contains public keys and their owners identified by keyId. Every
+// signed request needs the key of its signer, so we do not want to
+// look it up again and again.
+var keyCache complcache.Cache
+
+// A public key together with the actor that owns it.
+type ownedKey struct {
+	owner *url.URL
+	key   crypto.PublicKey
+}
+
+// Create the cache on init.
+func init() {
+	var err error
+
+	if keyCache, err = complcache.New(_KEY_EXPIRATION, _KEY_FILL, _KEY_GC); err != nil {
+		log.Panicf("cannot create cache: %v", err)
+	}
+}
+
+// Fetch the public key identified by keyId. Returns the IRI of the
+// actor that owns the key and the key itself.
+//
+// keyId either points to a standalone key document or, as is common
+// on the fediverse, to the actor document with a fragment attached.
+// Both cases are handled.
+//
+// Key documents name their owner themselves, so anyone could claim
+// to own a key. We only accept the key if the owner lives on the
+// same origin as the key and the actor document of the owner names
+// keyId as its key.
+//
+// keyId comes from whoever signed the request, so keys are only
+// fetched from the public internet. Keys are cached for a while.
+func PublicKey(keyId *url.URL) (owner *url.URL, key crypto.PublicKey, err error) {
+	creator := func() (interface{}, error) {
+		if owner, key, err := publicKey(keyId); err != nil {
+			return nil, err
+		} else {
+			return &ownedKey{owner, key}, nil
+		}
+	}
+
+	if cached, err := keyCache.GetOrCreate(keyId.String(), creator); err != nil {
+		return nil, nil, err
+	} else {
+		return cached.(*ownedKey).owner, cached.(*ownedKey).key, nil
+	}
+}
+
+// Fetch the public key identified by keyId without looking at the
+// cache. See PublicKey.
+func publicKey(keyId *url.URL) (owner *url.URL, key crypto.PublicKey, err error) {
+	document, err := getMappings(keyId)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot get keyId=%v", keyId)
+	}
+
+	// find out who claims to own the key
+
+	claimed := document
+
+	if embedded, ok := document["publicKey"].(map[string]interface{}); ok {
+		claimed = embedded
+	}
+
+	ownerString, ok := claimed["owner"].(string)
+	if !ok {
+		return nil, nil, errors.Newf("keyId=%v is missing owner", keyId)
+	}
+
+	if owner, err = url.Parse(ownerString); err != nil {
+		return nil, nil, errors.Wrapf(err, "keyId=%v has bad owner", keyId)
+	}
+
+	if owner.Scheme != keyId.Scheme || owner.Host != keyId.Host {
+		return nil, nil, errors.Newf("keyId=%v and owner=%v differ in origin", keyId, owner)
+	}
+
+	// look at the actor document of the owner; if keyId pointed to
+	// it, we already have it
+
+	actor := document
+
+	if id, _ := document["id"].(string); id != owner.String() {
+		if actor, err = getMappings(owner); err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot get owner=%v of keyId=%v", owner, keyId)
+		}
+	}
+
+	published, ok := actor["publicKey"].(map[string]interface{})
+	if !ok {
+		return nil, nil, errors.Newf("owner=%v has no publicKey", owner)
+	}
+
+	if id, _ := published["id"].(string); id != keyId.String() {
+		return nil, nil, errors.Newf("owner=%v does not claim keyId=%v", owner, keyId)
+	}
+
+	pemString, ok := published["publicKeyPem"].(string)
+	if !ok {
+		return nil, nil, errors.Newf("keyId=%v is missing publicKeyPem", keyId)
+	}
+
+	if key, err = parsePublicKey(pemString); err != nil {
+		return nil, nil, errors.Wrapf(err, "keyId=%v has bad publicKeyPem", keyId)
+	}
+
+	return owner, key, nil
+}
+
+// Get the raw document at iri. We are only interested in the raw
+// document; the go-fed vocabulary does not know about the security
+// extensions.
+func getMappings(iri *url.URL) (map[string]interface{}, error) {
+	raw, err := get(publicClient(), iri, _CONTENT_TYPE, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings map[string]interface{}
+
+	if err := json.Unmarshal(raw, &mappings); err != nil {
+		return nil, errors.Wrapf(err, "iri=%v is malformed", iri)
+	}
+
+	return mappings, nil
+}
+
+// Parse a PEM encoded public key. Both PKIX and PKCS #1 encoded keys
+// are supported.
+func parsePublicKey(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
@@ -0,0 +1,83 @@
+package fetch
+
+import (
+	"bytes"
+	"github.com/kissen/fed/util"
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const _HTML_CONTENT_TYPE = "text/html, application/xhtml+xml"
+
+// Return whether the web page at page links back to profile with
+// a rel="me" link. Both <a> and <link> elements are considered.
+//
+// Users pick page, so we only connect to the public internet.
+func RelMe(page, profile *url.URL) (bool, error) {
+	body, err := get(publicClient(), page, _HTML_CONTENT_TYPE, "")
+	if err != nil {
+		return false, err
+	}
+
+	for _, link := range RelMeLinks(bytes.NewReader(body), page) {
+		if util.UrlEq(link, profile) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Return the targets of all rel="me" links in the HTML document
+// read from r. Relative links are resolved against base.
+func RelMeLinks(r io.Reader, base *url.URL) (links []*url.URL) {
+	tokenizer := html.NewTokenizer(r)
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+
+			if token.Data != "a" && token.Data != "link" {
+				continue
+			}
+
+			var href string
+			var me bool
+
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "href":
+					href = attr.Val
+				case "rel":
+					me = me || isRelMe(attr.Val)
+				}
+			}
+
+			if !me || href == "" {
+				continue
+			}
+
+			if target, err := base.Parse(href); err == nil {
+				links = append(links, target)
+			}
+		}
+	}
+}
+
+// Return whether rel, the value of a rel attribute, contains "me".
+// Rel attributes are lists of space separated keywords.
+func isRelMe(rel string) bool {
+	for _, keyword := range strings.Fields(rel) {
+		if strings.EqualFold(keyword, "me") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package fetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRelMeLinks(t *testing.T) {
+	page := `
+		<html>
+		<head>
+			<link rel="me" href="https://example.com/alice">
+			<link rel="stylesheet" href="/style.css">
+		</head>
+		<body>
+			<a href="/about">About</a>
+			<a rel="nofollow me" href="/bob">Bob</a>
+			<a rel="me"></a>
+		</body>
+		</html>
+	`
+
+	base, _ := url.Parse("https://alice.example.org/index.html")
+	links := RelMeLinks(strings.NewReader(page), base)
+
+	expected := []string{
+		"https://example.com/alice", "https://alice.example.org/bob",
+	}
+
+	if len(links) != len(expected) {
+		t.Fatalf("bad number of links expected=%v got=%v", len(expected), links)
+	}
+
+	for i := range expected {
+		if links[i].String() != expected[i] {
+			t.Errorf("bad link expected=%v got=%v", expected[i], links[i])
+		}
+	}
+}
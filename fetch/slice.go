@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+)
+
+// Implements the iter.Iter and iter.IterEntry interfaces. This
+// struct iterates over objects we already have in memory.
+type slice struct {
+	values []vocab.Type
+}
+
+// Singleton of slice that is returned on calls to slice.End.
+var _SLICE_END Iter = &slice{}
+
+// Return an iterator over all objects in vs. The order of
+// vs is preserved.
+func Slice(vs []vocab.Type) Iter {
+	if len(vs) == 0 {
+		return _SLICE_END
+	}
+
+	return &slice{values: vs}
+}
+
+func (s *slice) HasAny() bool {
+	return len(s.values) > 0
+}
+
+func (s *slice) IsIRI() bool {
+	// we only ever contain full objects
+	return false
+}
+
+func (s *slice) GetIRI() *url.URL {
+	// IsIRI is always false -> GetIRI never returns
+	// an actually usable value
+	return nil
+}
+
+func (s *slice) GetType() vocab.Type {
+	if len(s.values) == 0 {
+		return nil
+	} else {
+		return s.values[0]
+	}
+}
+
+func (s *slice) Next() Iter {
+	// to make sure that checking for == End works, return the
+	// End singleton if there is nothing left
+
+	if len(s.values) <= 1 {
+		return _SLICE_END
+	}
+
+	return &slice{values: s.values[1:]}
+}
+
+func (s *slice) End() Iter {
+	return _SLICE_END
+}
@@ -17,3 +17,22 @@ func Submit(object vocab.Type, iri *url.URL) error {
 
 	return Post(bs, iri)
 }
+
+// Submit object to iri like Submit does. The request carries
+// authorization as Authorization header.
+func SubmitAuthorized(object vocab.Type, iri *url.URL, authorization string) error {
+	_, err := SubmitAuthorizedLocated(object, iri, authorization)
+	return err
+}
+
+// Submit object to iri like SubmitAuthorized does. Returns the IRI
+// the receiver reported in the Location header, e.g. the id an outbox
+// assigned to object. Returns a nil IRI if there was no such header.
+func SubmitAuthorizedLocated(object vocab.Type, iri *url.URL, authorization string) (*url.URL, error) {
+	bs, err := marshal.VocabToBytes(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "serialization failed before submitting")
+	}
+
+	return post(bs, iri, authorization)
+}
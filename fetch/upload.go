@@ -0,0 +1,90 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/marshal"
+	"github.com/kissen/fed/util"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// Upload the contents of file to the uploadMedia endpoint at iri.
+// Filename is the name of the file on the client, name is the
+// description of the file. The request carries authorization as
+// Authorization header. Returns the object that describes the
+// uploaded file.
+func Upload(file io.Reader, filename, name string, iri *url.URL, authorization string) (vocab.Type, error) {
+	log.Printf("Upload(%v)", iri)
+
+	// build up the multipart body; the object is the shell that
+	// the server fills in with the uploaded file
+
+	shell, err := json.Marshal(map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Object",
+		"name":     name,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize object")
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	if err := form.WriteField("object", string(shell)); err != nil {
+		return nil, errors.Wrap(err, "cannot write object")
+	}
+
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot write file")
+	}
+
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, errors.Wrap(err, "cannot write file")
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, errors.Wrap(err, "cannot finish form")
+	}
+
+	// POST to the address
+
+	req, err := http.NewRequest("POST", iri.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot set up request")
+	}
+
+	setActivityPubHeaders(req)
+	setAuthorization(req, authorization)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// evaluate result
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read response")
+	}
+
+	if !util.IsHTTPSuccess(resp.StatusCode) {
+		return nil, fmt.Errorf(`%v returned status="%v" body="%v"`, iri, resp.Status, string(raw))
+	}
+
+	return marshal.BytesToVocab(raw)
+}
@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/kissen/complcache"
+	"github.com/kissen/fed/errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const _WEBFINGER_EXPIRATION = 10 * time.Minute
+const _WEBFINGER_FILL = 30 * time.Second
+const _WEBFINGER_GC = 10 * time.Minute
+
+const _JRD_CONTENT_TYPE = "application/jrd+json, application/json"
+const _XRD_CONTENT_TYPE = "application/xrd+xml, application/xml"
+
+// Contains actor IRIs identified by the acct URI they were looked
+// up with. Handles change rarely, so we can keep them around for
+// longer than other objects.
+var webfingerCache complcache.Cache
+
+// Create the cache on init.
+func init() {
+	var err error
+
+	if webfingerCache, err = complcache.New(_WEBFINGER_EXPIRATION, _WEBFINGER_FILL, _WEBFINGER_GC); err != nil {
+		log.Panicf("cannot create cache: %v", err)
+	}
+}
+
+// Resolve handle to the IRI of the actor it refers to. Handle may
+// be given as "@user@host", "user@host" or "acct:user@host".
+//
+// The actor is looked up with WebFinger on host. If host does not
+// serve WebFinger at the usual location, we try to find the right
+// endpoint in host-meta. Handles come from users, so requests only
+// go out to the public internet.
+func WebFinger(handle string) (*url.URL, error) {
+	user, host, err := SplitHandle(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	acct := fmt.Sprintf("acct:%v@%v", user, host)
+
+	creator := func() (interface{}, error) {
+		return webfinger(acct, host)
+	}
+
+	if iri, err := webfingerCache.GetOrCreate(acct, creator); err != nil {
+		return nil, err
+	} else {
+		return iri.(*url.URL), nil
+	}
+}
+
+// Split handle into its user and host components. Handle may be
+// given as "@user@host", "user@host" or "acct:user@host".
+func SplitHandle(handle string) (user, host string, err error) {
+	trimmed := strings.TrimSpace(handle)
+	trimmed = strings.TrimPrefix(trimmed, "acct:")
+	trimmed = strings.TrimPrefix(trimmed, "@")
+
+	components := strings.Split(trimmed, "@")
+
+	if len(components) != 2 || len(components[0]) == 0 || len(components[1]) == 0 {
+		return "", "", errors.Newf("handle=%v does not have format user@host", handle)
+	}
+
+	return components[0], components[1], nil
+}
+
+// Look up acct on host. First we try the well known location; if that
+// fails we look for the right location in host-meta.
+func webfinger(acct, host string) (*url.URL, error) {
+	query := url.Values{}
+	query.Set("resource", acct)
+
+	endpoint := &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     "/.well-known/webfinger",
+		RawQuery: query.Encode(),
+	}
+
+	iri, err := webfingerAt(endpoint)
+	if err == nil {
+		return iri, nil
+	}
+
+	log.Printf("webfinger at endpoint=%v failed, trying host-meta: %v", endpoint, err)
+
+	if endpoint, err = hostMeta(acct, host); err != nil {
+		return nil, errors.Wrapf(err, "cannot look up acct=%v", acct)
+	}
+
+	return webfingerAt(endpoint)
+}
+
+// Query the WebFinger endpoint and return the actor IRI from the
+// response.
+func webfingerAt(endpoint *url.URL) (*url.URL, error) {
+	body, err := get(publicClient(), endpoint, _JRD_CONTENT_TYPE, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var jrd struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+
+	if err := json.Unmarshal(body, &jrd); err != nil {
+		return nil, errors.Wrap(err, "bad webfinger response")
+	}
+
+	for _, link := range jrd.Links {
+		if link.Rel != "self" {
+			continue
+		}
+
+		if strings.Contains(link.Type, "activity+json") || strings.Contains(link.Type, "ld+json") {
+			return url.Parse(link.Href)
+		}
+	}
+
+	return nil, errors.Newf("no actor link at endpoint=%v", endpoint)
+}
+
+// Return the WebFinger endpoint for acct as advertised in the
+// host-meta document of host.
+func hostMeta(acct, host string) (*url.URL, error) {
+	addr := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   "/.well-known/host-meta",
+	}
+
+	body, err := get(publicClient(), addr, _XRD_CONTENT_TYPE, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var xrd struct {
+		Links []struct {
+			Rel      string `xml:"rel,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Link"`
+	}
+
+	if err := xml.Unmarshal(body, &xrd); err != nil {
+		return nil, errors.Wrap(err, "bad host-meta document")
+	}
+
+	for _, link := range xrd.Links {
+		if link.Rel == "lrdd" && strings.Contains(link.Template, "{uri}") {
+			endpoint := strings.Replace(link.Template, "{uri}", url.QueryEscape(acct), 1)
+			return url.Parse(endpoint)
+		}
+	}
+
+	return nil, errors.Newf("no lrdd template in host-meta of host=%v", host)
+}
@@ -0,0 +1,34 @@
+package fetch
+
+import (
+	"testing"
+)
+
+func TestSplitHandle(t *testing.T) {
+	good := []string{
+		"@alice@example.com", "alice@example.com", "acct:alice@example.com",
+	}
+
+	for _, handle := range good {
+		user, host, err := SplitHandle(handle)
+
+		if err != nil {
+			t.Errorf("rejected good handle=%v err=%v", handle, err)
+			continue
+		}
+
+		if user != "alice" || host != "example.com" {
+			t.Errorf("bad split handle=%v user=%v host=%v", handle, user, host)
+		}
+	}
+
+	bad := []string{
+		"", "alice", "@alice", "alice@", "@@example.com", "alice@example.com@example.org",
+	}
+
+	for _, handle := range bad {
+		if _, _, err := SplitHandle(handle); err == nil {
+			t.Errorf("accepted bad handle=%v", handle)
+		}
+	}
+}
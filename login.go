@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/throttle"
+	"github.com/kissen/fed/util"
+	"log"
+	"net/http"
+	"time"
+)
+
+// How long users have to enter their second factor after entering
+// their password.
+const _SECOND_FACTOR_TIMEOUT = 5 * time.Minute
+
+// Check the login form submitted with r. Users first submit username
+// and password. If they set up a second factor, they are asked for a
+// code in a second step; the login is remembered in the session
+// cookie in between.
+//
+// Returns the user once all factors were checked. If secondStep is
+// true, the caller should ask for the code of the second factor.
+func checkLogin(r *http.Request) (user *db.FedUser, secondStep bool, err error) {
+	if code, ok := util.FormValue(r, "otp"); ok {
+		return checkSecondFactor(r, code)
+	}
+
+	fc := fedcontext.Context(r)
+
+	username, ok := util.FormValue(r, "username")
+	if !ok {
+		return nil, false, errors.NewWith(http.StatusBadRequest, "missing username")
+	}
+
+	password, ok := util.FormValue(r, "password")
+	if !ok {
+		return nil, false, errors.NewWith(http.StatusBadRequest, "missing password")
+	}
+
+	err = throttle.Login(r, username, func() error {
+		if err := db.CheckCredentials(username, password, fc.Storage); err != nil {
+			return errors.WithStatus(http.StatusUnauthorized, err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err = fc.Storage.RetrieveUser(username)
+	if err != nil {
+		return nil, false, errors.WithStatus(http.StatusInternalServerError, err)
+	}
+
+	if user.SecondFactorRequired() {
+		fc.PendingLogin = &fedcontext.PendingLogin{
+			Username: username,
+			Until:    time.Now().Add(_SECOND_FACTOR_TIMEOUT),
+		}
+
+		return nil, true, nil
+	}
+
+	return user, false, nil
+}
+
+// Check code against the second factor of the login waiting in the
+// session cookie. On success, the login is finished.
+func checkSecondFactor(r *http.Request, code string) (user *db.FedUser, secondStep bool, err error) {
+	fc := fedcontext.Context(r)
+
+	if !fc.PendingLogin.Valid() {
+		fc.PendingLogin = nil
+		return nil, false, errors.NewWith(http.StatusUnauthorized, "login expired, please start over")
+	}
+
+	user, err = fc.Storage.RetrieveUser(fc.PendingLogin.Username)
+	if err != nil {
+		return nil, false, errors.WithStatus(http.StatusInternalServerError, err)
+	}
+
+	err = throttle.Login(r, user.Name, func() error {
+		if !user.CheckSecondFactor(code) {
+			log.Printf("bad second factor for user=%v", user.Name)
+			return errors.NewWith(http.StatusUnauthorized, "bad code")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	// checking the code used it up
+
+	if err := fc.Storage.StoreUser(user); err != nil {
+		return nil, false, errors.WithStatus(http.StatusInternalServerError, err)
+	}
+
+	fc.PendingLogin = nil
+	return user, false, nil
+}
+
+// Check form value otp of r with verify, e.g. when the logged in
+// user changes their second factor. Failed attempts count towards
+// the login throttle; otherwise whoever got hold of a session could
+// guess codes as fast as they like.
+func checkOTP(r *http.Request, user *db.FedUser, verify func(code string) bool) error {
+	return throttle.Login(r, user.Name, func() error {
+		if !verify(r.FormValue("otp")) {
+			log.Printf("bad second factor for user=%v", user.Name)
+			return errors.NewWith(http.StatusUnauthorized, "bad code")
+		}
+
+		return nil
+	})
+}
+
+// Return the HTTP status err carries. If it carries none, fallback
+// is returned.
+func statusOf(err error, fallback int) int {
+	if status, ok := errors.Status(err); ok {
+		return status
+	}
+
+	return fallback
+}
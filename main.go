@@ -57,6 +57,10 @@ func CreateProxies() (pub.FederatingActor, pub.HandlerFunc) {
 // I think that's easier than bothering with a web gui for configuration for now.
 func InstallAdminHandlers(router *mux.Router) {
 	router.HandleFunc(`/{username:[A-Za-z]+}`, PutUser).Methods("PUT")
+	router.HandleFunc(`/blocks/{domain}`, PutDeleteDomainBlock).Methods("PUT", "DELETE")
+	router.HandleFunc(`/{username:[A-Za-z]+}/totp`, DeleteUserTOTP).Methods("DELETE")
+	router.HandleFunc("/lockouts", GetDeleteLockouts).Methods("GET")
+	router.HandleFunc("/lockouts/{key}", GetDeleteLockouts).Methods("DELETE")
 }
 
 // Install the OAuth2 handlers. These handlers take care of authorization
@@ -65,6 +69,22 @@ func InstallOAuthHandlers(router *mux.Router) {
 	router.HandleFunc("/oauth/authorize", GetOAuthAuthorize).Methods("GET")
 	router.HandleFunc("/oauth/authorize", PostOAuthAuthorize).Methods("POST")
 	router.HandleFunc("/oauth/token", PostOAuthToken).Methods("POST")
+	router.HandleFunc("/oauth/revoke", PostOAuthRevoke).Methods("POST")
+}
+
+// Install the handlers for the client API. The API follows the
+// Mastodon API s.t. existing clients can talk to us.
+func InstallApiHandlers(router *mux.Router) {
+	router.HandleFunc("/api/v1/apps", PostApiApps).Methods("POST")
+	router.HandleFunc("/api/v1/instance", GetApiInstance).Methods("GET")
+	router.HandleFunc("/api/v1/accounts/verify_credentials", GetApiVerifyCredentials).Methods("GET")
+	router.HandleFunc("/api/v1/accounts/{id}", GetApiAccount).Methods("GET")
+	router.HandleFunc("/api/v1/statuses", PostApiStatus).Methods("POST")
+	router.HandleFunc("/api/v1/statuses/{id}", GetApiStatus).Methods("GET")
+	router.HandleFunc("/api/v1/statuses/{id}", DeleteApiStatus).Methods("DELETE")
+	router.HandleFunc("/api/v1/statuses/{id}/favourite", PostApiFavourite).Methods("POST")
+	router.HandleFunc("/api/v1/statuses/{id}/reblog", PostApiReblog).Methods("POST")
+	router.HandleFunc("/api/v1/timelines/home", GetApiHomeTimeline).Methods("GET")
 }
 
 // Install the handlers for all /.well-known/ targets. These are used by
@@ -77,6 +97,14 @@ func InstallWellKnownHandlers(router *mux.Router) {
 	router.HandleFunc("/.well-known/host-meta", GetHostMeta).Methods("GET")
 }
 
+// Install the handlers for uploading files, serving files that
+// were uploaded and proxying remote files.
+func InstallMediaHandlers(router *mux.Router) {
+	router.HandleFunc(`/{username:[A-Za-z]+}/media`, PostUploadMedia).Methods("POST")
+	router.HandleFunc("/media/{id}", GetMedia).Methods("GET")
+	router.HandleFunc("/proxy/media", GetProxyMedia).Methods("GET")
+}
+
 // Install handlers that are really just workaround and redirects
 // to deal with other software on the fediverse.
 func InstallShimHandlers(router *mux.Router) {
@@ -107,21 +135,50 @@ func InstallApHandler(target *mux.Router, h http.HandlerFunc, pattern string) {
 func InstallWebHandlers(router *mux.Router) {
 	InstallWebHandler(router, WebGetIndex, "/", "GET")
 	InstallWebHandler(router, WebGetStream, "/stream", "GET")
+	InstallWebHandler(router, WebGetLocal, "/local", "GET")
+	InstallWebHandler(router, WebGetFederated, "/federated", "GET")
 	InstallWebHandler(router, WebGetLiked, "/liked", "GET")
 	InstallWebHandler(router, WebGetFollowing, "/following", "GET")
 	InstallWebHandler(router, WebGetFollowers, "/followers", "GET")
+	InstallWebHandler(router, WebGetSearch, "/search", "GET")
+	InstallWebHandler(router, WebGetTag, "/tags/{tag}", "GET")
+	InstallWebHandler(router, WebGetRemoteThread, "/remote/thread/{remote_path:.+}", "GET")
 	InstallWebHandler(router, WebGetRemote, "/remote/{remote_path:.+}", "GET")
 	InstallWebHandler(router, WebGetLogin, "/login", "GET")
 	InstallWebHandler(router, WebPostLogin, "/login", "POST")
 	InstallWebHandler(router, WebPostLogout, "/logout", "POST")
 	InstallWebHandler(router, WebPostSubmit, "/submit", "POST")
 	InstallWebHandler(router, WebPostReply, "/reply", "POST")
+	InstallWebHandler(router, WebPostEdit, "/edit", "POST")
+	InstallWebHandler(router, WebPostDelete, "/delete", "POST")
 	InstallWebHandler(router, WebPostRepeat, "/repeat", "POST")
 	InstallWebHandler(router, WebPostLike, "/like", "POST")
+	InstallWebHandler(router, WebPostFollow, "/follow", "POST")
+	InstallWebHandler(router, WebPostBlock, "/block", "POST")
+	InstallWebHandler(router, WebGetSettings, "/settings", "GET")
+	InstallWebHandler(router, WebPostProfile, "/settings/profile", "POST")
+	InstallWebHandler(router, WebPostMute, "/settings/mute", "POST")
+	InstallWebHandler(router, WebPostUnmute, "/settings/unmute", "POST")
+	InstallWebHandler(router, WebPostRevoke, "/settings/revoke", "POST")
+	InstallWebHandler(router, WebPostTOTP, "/settings/totp", "POST")
+	InstallWebHandler(router, WebPostConfirmTOTP, "/settings/totp/confirm", "POST")
+	InstallWebHandler(router, WebPostRecoveryCodes, "/settings/totp/recovery", "POST")
+	InstallWebHandler(router, WebPostDisableTOTP, "/settings/totp/disable", "POST")
+
+	// needs to come last; otherwise it would shadow all
+	// the other handlers above
+	InstallWebHandler(router, WebGetUser, "/{username:[A-Za-z]+}", "GET")
 }
 
 // Install web handler h for pattern and matching request methods.
+// POST requests need to carry the CSRF token of the session.
 func InstallWebHandler(target *mux.Router, h http.HandlerFunc, pattern string, methods ...string) {
+	for _, method := range methods {
+		if method == "POST" {
+			h = RequireCSRF(h)
+		}
+	}
+
 	target.HandleFunc(pattern, h).Methods(methods...)
 }
 
@@ -163,8 +220,10 @@ func main() {
 
 	InstallAdminHandlers(router)
 	InstallOAuthHandlers(router)
+	InstallApiHandlers(router)
 	InstallWellKnownHandlers(router)
 	InstallShimHandlers(router)
+	InstallMediaHandlers(router)
 	InstallApHandlers(router)
 	InstallWebHandlers(router)
 	InstallStaticHandlers(router)
@@ -41,11 +41,61 @@ func BytesToVocab(bin []byte) (vocab.Type, error) {
 			return nil
 		},
 
+		func(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+			obj = announce
+			return nil
+		},
+
+		func(c context.Context, update vocab.ActivityStreamsUpdate) error {
+			obj = update
+			return nil
+		},
+
+		func(c context.Context, del vocab.ActivityStreamsDelete) error {
+			obj = del
+			return nil
+		},
+
+		func(c context.Context, undo vocab.ActivityStreamsUndo) error {
+			obj = undo
+			return nil
+		},
+
+		func(c context.Context, block vocab.ActivityStreamsBlock) error {
+			obj = block
+			return nil
+		},
+
 		func(c context.Context, note vocab.ActivityStreamsNote) error {
 			obj = note
 			return nil
 		},
 
+		func(c context.Context, image vocab.ActivityStreamsImage) error {
+			obj = image
+			return nil
+		},
+
+		func(c context.Context, video vocab.ActivityStreamsVideo) error {
+			obj = video
+			return nil
+		},
+
+		func(c context.Context, audio vocab.ActivityStreamsAudio) error {
+			obj = audio
+			return nil
+		},
+
+		func(c context.Context, document vocab.ActivityStreamsDocument) error {
+			obj = document
+			return nil
+		},
+
+		func(c context.Context, tombstone vocab.ActivityStreamsTombstone) error {
+			obj = tombstone
+			return nil
+		},
+
 		func(c context.Context, person vocab.ActivityStreamsPerson) error {
 			obj = person
 			return nil
@@ -56,6 +106,11 @@ func BytesToVocab(bin []byte) (vocab.Type, error) {
 			return nil
 		},
 
+		func(c context.Context, page vocab.ActivityStreamsCollectionPage) error {
+			obj = page
+			return nil
+		},
+
 		func(c context.Context, oc vocab.ActivityStreamsOrderedCollection) error {
 			obj = oc
 			return nil
@@ -0,0 +1,138 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/prop"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// Return the Account entity for actor as described in the Mastodon
+// API documentation. For users of this instance, the numbers of
+// followers and posts are filled in; for remote actors we do not
+// know them and report zero.
+func Account(fc *fedcontext.FedContext, actor vocab.Type) (map[string]interface{}, error) {
+	if !IsActor(actor) {
+		return nil, errors.NewfWith(http.StatusNotFound, "type=%v is not an actor", prop.Type(actor))
+	}
+
+	mappings, err := actor.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize actor")
+	}
+
+	id, err := url.Parse(str(mappings, "id"))
+	if err != nil || !id.IsAbs() {
+		return nil, errors.New("actor has no id")
+	}
+
+	profile, err := fedcontext.ParseProfile(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	username := str(mappings, "preferredUsername")
+	if username == "" {
+		username = path.Base(id.Path)
+	}
+
+	account := map[string]interface{}{
+		"id":              ID(id),
+		"username":        username,
+		"acct":            username + "@" + id.Host,
+		"url":             str(mappings, "url"),
+		"display_name":    profile.DisplayName,
+		"note":            profile.Summary,
+		"avatar":          mediaURL(profile.Icon),
+		"avatar_static":   mediaURL(profile.Icon),
+		"header":          mediaURL(profile.Image),
+		"header_static":   mediaURL(profile.Image),
+		"locked":          false,
+		"bot":             str(mappings, "type") == "Service",
+		"created_at":      timestamp(mappings, "published"),
+		"followers_count": 0,
+		"following_count": 0,
+		"statuses_count":  0,
+		"emojis":          []interface{}{},
+	}
+
+	if account["url"] == "" {
+		account["url"] = id.String()
+	}
+
+	if account["display_name"] == "" {
+		account["display_name"] = username
+	}
+
+	// for our own users we know more; the stored profile also knows
+	// which fields were verified
+
+	if (fediri.IRI{id}).IsLocal() {
+		if user, err := fc.Storage.RetrieveUser(username); err != nil {
+			log.Printf("cannot look up local user=%v: %v", username, err)
+		} else {
+			account["acct"] = username
+			account["followers_count"] = len(user.Followers)
+			account["following_count"] = len(user.Following)
+			account["statuses_count"] = len(user.Outbox)
+			profile = &user.Profile
+		}
+	}
+
+	account["fields"] = fields(profile)
+	return account, nil
+}
+
+// Return whether obj is some kind of actor, that is whether it can
+// be shown as Account.
+func IsActor(obj vocab.Type) bool {
+	switch prop.Type(obj) {
+	case "Person", "Service", "Application", "Group", "Organization":
+		return true
+	default:
+		return false
+	}
+}
+
+// Return the profile fields of profile as Field entities.
+func fields(profile *db.FedProfile) []interface{} {
+	fs := []interface{}{}
+
+	for _, field := range profile.Fields {
+		f := map[string]interface{}{
+			"name":        field.Name,
+			"value":       html.EscapeString(field.Value),
+			"verified_at": nil,
+		}
+
+		if field.VerifiedAt != nil {
+			f["verified_at"] = field.VerifiedAt.UTC().Format(_TIME_FORMAT)
+		}
+
+		fs = append(fs, f)
+	}
+
+	return fs
+}
+
+// Return the account of the author of obj.
+func author(fc *fedcontext.FedContext, obj vocab.Type) (map[string]interface{}, error) {
+	authors := prop.IRIs(obj, "attributedTo", "actor")
+	if len(authors) == 0 {
+		return nil, errors.New("object has no author")
+	}
+
+	actor, err := Retrieve(fc, authors[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot look up author")
+	}
+
+	return Account(fc, actor)
+}
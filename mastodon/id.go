@@ -0,0 +1,32 @@
+package mastodon
+
+import (
+	"encoding/base64"
+	"github.com/kissen/fed/errors"
+	"net/http"
+	"net/url"
+)
+
+// Return the id clients use to refer to the object at iri. The
+// Mastodon API identifies statuses and accounts with opaque strings
+// that appear in paths, so we encode the whole IRI.
+func ID(iri *url.URL) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(iri.String()))
+}
+
+// Return the IRI encoded in id which was created with ID. The error
+// carries http.StatusNotFound s.t. unknown ids look like unknown
+// objects to clients.
+func ParseID(id string) (*url.URL, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, errors.WrapWith(http.StatusNotFound, err, "malformed id")
+	}
+
+	iri, err := url.Parse(string(bs))
+	if err != nil || !iri.IsAbs() {
+		return nil, errors.NewfWith(http.StatusNotFound, "id=%v does not encode an iri", id)
+	}
+
+	return iri, nil
+}
@@ -0,0 +1,37 @@
+package mastodon
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	iri, err := url.Parse("https://example.com/storage/a1b2?page=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := ID(iri)
+
+	if strings.ContainsAny(id, "/?#") {
+		t.Errorf("id=%v cannot be used in paths", id)
+	}
+
+	parsed, err := ParseID(id)
+	if err != nil {
+		t.Fatalf("cannot parse id=%v: %v", id, err)
+	}
+
+	if parsed.String() != iri.String() {
+		t.Errorf("got iri=%v expected iri=%v", parsed, iri)
+	}
+}
+
+func TestParseID_Bad(t *testing.T) {
+	for _, id := range []string{"", "!!!", ID(&url.URL{Path: "relative"})} {
+		if _, err := ParseID(id); err == nil {
+			t.Errorf("accepted bad id=%v", id)
+		}
+	}
+}
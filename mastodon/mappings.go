@@ -0,0 +1,93 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/proxy"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Format of timestamps in the Mastodon API.
+const _TIME_FORMAT = "2006-01-02T15:04:05.000Z"
+
+// Return the string property key from the serialized object
+// mappings. Returns the empty string if there is no such string.
+func str(mappings map[string]interface{}, key string) string {
+	s, _ := mappings[key].(string)
+	return s
+}
+
+// Return the time property key from the serialized object mappings
+// in the format of the Mastodon API. Clients expect a timestamp, so
+// if there is none, the zero time is returned.
+func timestamp(mappings map[string]interface{}, key string) string {
+	t, _ := time.Parse(time.RFC3339, str(mappings, key))
+	return t.UTC().Format(_TIME_FORMAT)
+}
+
+// Return the embedded objects in value which is the serialized form
+// of a property. Values that are not objects are skipped.
+func entries(value interface{}) (ms []map[string]interface{}) {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			ms = append(ms, m)
+		}
+	}
+
+	return ms
+}
+
+// Return the URL under which clients should load the media at addr.
+// Like in the web interface, remote media goes through our proxy.
+// Returns the empty string if addr is nil.
+func mediaURL(addr *url.URL) string {
+	if addr == nil {
+		return ""
+	}
+
+	if (fediri.IRI{addr}).IsLocal() {
+		return addr.String()
+	}
+
+	proxied, err := url.Parse(proxy.URL(addr))
+	if err != nil {
+		return ""
+	}
+
+	return config.Get().GlobalURL().ResolveReference(proxied).String()
+}
+
+// Return the object at iri. If fc has a client, the object is looked
+// up with the permissions of the client.
+//
+// Anonymous requests must not make us fetch arbitrary addresses, so
+// for them remote objects are only returned if we already have a
+// copy in storage that is public or an actor.
+func Retrieve(fc *fedcontext.FedContext, iri *url.URL) (vocab.Type, error) {
+	if fc.Client != nil {
+		return fc.Client.Get(iri)
+	}
+
+	if (fediri.IRI{iri}).IsLocal() {
+		return fetch.Fetch(iri)
+	}
+
+	obj, err := fc.Storage.RetrieveObject(iri)
+	if err != nil || !(prop.IsPublic(obj) || IsActor(obj)) {
+		return nil, errors.NewfWith(http.StatusNotFound, "iri=%v not known", iri)
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,356 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/template"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Return the Status entity for obj as described in the Mastodon API
+// documentation. Obj is either an object like a note, a Create of
+// such an object or an Announce. Announces are returned as reblogs.
+//
+// Whether the status was favourited and reblogged is answered from
+// the point of view of the client of fc.
+func Status(fc *fedcontext.FedContext, obj vocab.Type) (map[string]interface{}, error) {
+	switch obj.(type) {
+	case vocab.ActivityStreamsCreate:
+		if object, err := Object(fc, obj); err != nil {
+			return nil, err
+		} else {
+			return status(fc, object)
+		}
+
+	case vocab.ActivityStreamsAnnounce:
+		return reblog(fc, obj)
+
+	case vocab.ActivityStreamsNote, vocab.ActivityStreamsArticle, vocab.ActivityStreamsPage:
+		return status(fc, obj)
+
+	default:
+		return nil, errors.Newf("type=%v cannot be shown as status", prop.Type(obj))
+	}
+}
+
+// Return the IRI the id of the Status entity for obj is made from.
+// Unlike Status, this does not look anything up, so it is cheap
+// enough to find a status in a long list. Returns nil if obj has no
+// usable id.
+func StatusIRI(obj vocab.Type) *url.URL {
+	mappings, err := obj.Serialize()
+	if err != nil {
+		return nil
+	}
+
+	// statuses for creates are about the created object
+
+	if _, ok := obj.(vocab.ActivityStreamsCreate); ok {
+		switch object := mappings["object"].(type) {
+		case map[string]interface{}:
+			mappings = object
+		case []interface{}:
+			if len(object) > 0 {
+				if m, ok := object[0].(map[string]interface{}); ok {
+					mappings = m
+				} else {
+					mappings = map[string]interface{}{"id": object[0]}
+				}
+			}
+		default:
+			mappings = map[string]interface{}{"id": object}
+		}
+	}
+
+	iri, err := url.Parse(str(mappings, "id"))
+	if err != nil || !iri.IsAbs() {
+		return nil
+	}
+
+	return iri
+}
+
+// Return the Status entities for those of objs that can be shown as
+// statuses. Everything else is skipped.
+func Statuses(fc *fedcontext.FedContext, objs []vocab.Type) []interface{} {
+	ss := []interface{}{}
+
+	for _, obj := range objs {
+		if s, err := Status(fc, obj); err != nil {
+			log.Printf("skipping type=%v: %v", prop.Type(obj), err)
+		} else {
+			ss = append(ss, s)
+		}
+	}
+
+	return ss
+}
+
+// Return the Status entity for obj which is some kind of object
+// with content, e.g. a note.
+func status(fc *fedcontext.FedContext, obj vocab.Type) (map[string]interface{}, error) {
+	mappings, err := obj.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize object")
+	}
+
+	id, err := url.Parse(str(mappings, "id"))
+	if err != nil || !id.IsAbs() {
+		return nil, errors.New("object has no id")
+	}
+
+	account, err := author(fc, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	spoiler := template.Plaintext(str(mappings, "summary"))
+	sensitive, _ := mappings["sensitive"].(bool)
+
+	s := map[string]interface{}{
+		"id":                     ID(id),
+		"uri":                    id.String(),
+		"url":                    str(mappings, "url"),
+		"created_at":             timestamp(mappings, "published"),
+		"account":                account,
+		"content":                string(template.HTML(str(mappings, "content"))),
+		"visibility":             Visibility(obj),
+		"sensitive":              sensitive || spoiler != "",
+		"spoiler_text":           spoiler,
+		"media_attachments":      attachments(mappings),
+		"mentions":               mentions(mappings),
+		"tags":                   tags(obj),
+		"emojis":                 []interface{}{},
+		"reblogs_count":          0,
+		"favourites_count":       0,
+		"replies_count":          0,
+		"in_reply_to_id":         nil,
+		"in_reply_to_account_id": nil,
+		"reblog":                 nil,
+		"application":            nil,
+		"language":               nil,
+		"card":                   nil,
+		"poll":                   nil,
+		"favourited":             false,
+		"reblogged":              false,
+		"muted":                  false,
+		"bookmarked":             false,
+		"pinned":                 false,
+	}
+
+	if s["url"] == "" {
+		s["url"] = id.String()
+	}
+
+	if parents := prop.IRIs(obj, "inReplyTo"); len(parents) > 0 {
+		s["in_reply_to_id"] = ID(parents[0])
+	}
+
+	if user := viewer(fc); user != nil {
+		s["favourited"] = user.HasLiked(id)
+		s["reblogged"] = user.HasRepeated(id)
+	}
+
+	return s, nil
+}
+
+// Return the Status entity for the Announce announce. The announced
+// object is put into the reblog field.
+func reblog(fc *fedcontext.FedContext, announce vocab.Type) (map[string]interface{}, error) {
+	mappings, err := announce.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot serialize announce")
+	}
+
+	id, err := url.Parse(str(mappings, "id"))
+	if err != nil || !id.IsAbs() {
+		return nil, errors.New("announce has no id")
+	}
+
+	announced, err := Object(fc, announce)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := status(fc, announced)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := author(fc, announce)
+	if err != nil {
+		return nil, err
+	}
+
+	// a reblog is a status of its own that mostly repeats what
+	// the original says
+
+	s := make(map[string]interface{})
+
+	for key, value := range original {
+		s[key] = value
+	}
+
+	s["id"] = ID(id)
+	s["uri"] = id.String()
+	s["url"] = id.String()
+	s["created_at"] = timestamp(mappings, "published")
+	s["account"] = account
+	s["visibility"] = Visibility(announce)
+	s["in_reply_to_id"] = nil
+	s["reblog"] = original
+
+	return s, nil
+}
+
+// Return the object activity is about, e.g. the note that was
+// created.
+func Object(fc *fedcontext.FedContext, activity vocab.Type) (vocab.Type, error) {
+	type objecter interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}
+
+	o, ok := activity.(objecter)
+	if !ok {
+		return nil, errors.Newf("type=%v has no object", prop.Type(activity))
+	}
+
+	it, err := fetch.Begin(o.GetActivityStreamsObject())
+	if err != nil {
+		return nil, err
+	}
+
+	for ; it != it.End(); it = it.Next() {
+		if !it.HasAny() {
+			continue
+		}
+
+		if !it.IsIRI() {
+			return it.GetType(), nil
+		}
+
+		return Retrieve(fc, it.GetIRI())
+	}
+
+	return nil, errors.New("activity has no object")
+}
+
+// Return the Attachment entities for the attachments in the
+// serialized object mappings.
+func attachments(mappings map[string]interface{}) []interface{} {
+	as := []interface{}{}
+
+	for _, entry := range entries(mappings["attachment"]) {
+		addrs := prop.Strings(entry["url"])
+		if len(addrs) == 0 {
+			continue
+		}
+
+		addr, err := url.Parse(addrs[0])
+		if err != nil || !addr.IsAbs() {
+			continue
+		}
+
+		kind := "unknown"
+		mediaType := str(entry, "mediaType")
+
+		switch {
+		case strings.HasPrefix(mediaType, "image/"):
+			kind = "image"
+		case strings.HasPrefix(mediaType, "video/"):
+			kind = "video"
+		case strings.HasPrefix(mediaType, "audio/"):
+			kind = "audio"
+		}
+
+		a := map[string]interface{}{
+			"id":          ID(addr),
+			"type":        kind,
+			"url":         mediaURL(addr),
+			"preview_url": mediaURL(addr),
+			"remote_url":  addr.String(),
+			"description": nil,
+			"blurhash":    nil,
+		}
+
+		if name := str(entry, "name"); name != "" {
+			a["description"] = name
+		}
+
+		if blurhash := str(entry, "blurhash"); blurhash != "" {
+			a["blurhash"] = blurhash
+		}
+
+		as = append(as, a)
+	}
+
+	return as
+}
+
+// Return the Mention entities for the mentions in the serialized
+// object mappings.
+func mentions(mappings map[string]interface{}) []interface{} {
+	ms := []interface{}{}
+
+	for _, entry := range entries(mappings["tag"]) {
+		if str(entry, "type") != "Mention" {
+			continue
+		}
+
+		href, err := url.Parse(str(entry, "href"))
+		if err != nil || !href.IsAbs() {
+			continue
+		}
+
+		// names of mentions look like "@alice@example.com"
+
+		acct := strings.TrimPrefix(str(entry, "name"), "@")
+		username := strings.SplitN(acct, "@", 2)[0]
+
+		ms = append(ms, map[string]interface{}{
+			"id":       ID(href),
+			"username": username,
+			"acct":     acct,
+			"url":      href.String(),
+		})
+	}
+
+	return ms
+}
+
+// Return the Tag entities for the hashtags of obj.
+func tags(obj vocab.Type) []interface{} {
+	ts := []interface{}{}
+
+	for _, hashtag := range prop.Hashtags(obj) {
+		ts = append(ts, map[string]interface{}{
+			"name": hashtag,
+			"url":  fediri.TagIRI(hashtag).String(),
+		})
+	}
+
+	return ts
+}
+
+// Return the user the client of fc acts for. Returns nil if there
+// is no client or the lookup failed.
+func viewer(fc *fedcontext.FedContext) *db.FedUser {
+	if fc.Client == nil {
+		return nil
+	}
+
+	user, err := fc.Storage.RetrieveUser(fc.Client.Username())
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return user
+}
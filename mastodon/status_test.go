@@ -0,0 +1,45 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams"
+	"github.com/kissen/fed/util"
+	"testing"
+)
+
+func TestStatusIRI(t *testing.T) {
+	noteIRI := toUrl(t, "https://example.com/alice/notes/1")
+	createIRI := toUrl(t, "https://example.com/alice/activities/1")
+
+	note := streams.NewActivityStreamsNote()
+	noteId := streams.NewJSONLDIdProperty()
+	noteId.Set(noteIRI)
+	note.SetJSONLDId(noteId)
+
+	if got := StatusIRI(note); !util.UrlEq(got, noteIRI) {
+		t.Errorf("got=%v for note", got)
+	}
+
+	// creates are shown as the created object, no matter whether
+	// it is embedded or not
+
+	create := streams.NewActivityStreamsCreate()
+	createId := streams.NewJSONLDIdProperty()
+	createId.Set(createIRI)
+	create.SetJSONLDId(createId)
+
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendActivityStreamsNote(note)
+	create.SetActivityStreamsObject(object)
+
+	if got := StatusIRI(create); !util.UrlEq(got, noteIRI) {
+		t.Errorf("got=%v for create with embedded note", got)
+	}
+
+	object = streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(noteIRI)
+	create.SetActivityStreamsObject(object)
+
+	if got := StatusIRI(create); !util.UrlEq(got, noteIRI) {
+		t.Errorf("got=%v for create with note iri", got)
+	}
+}
@@ -0,0 +1,49 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/util"
+	"net/http"
+)
+
+// Parse the visibility s as sent by Mastodon clients. Mastodon calls
+// posts only visible to followers "private". The empty string is
+// treated as public.
+func ParseVisibility(s string) (fedcontext.Visibility, error) {
+	if s == "private" {
+		return fedcontext.FOLLOWERS, nil
+	}
+
+	if v, err := fedcontext.ParseVisibility(s); err != nil {
+		return "", errors.WithStatus(http.StatusUnprocessableEntity, err)
+	} else {
+		return v, nil
+	}
+}
+
+// Return the visibility of obj as Mastodon clients expect it. We
+// infer it from the addressing: objects addressed only to mentioned
+// actors are direct, everything else that is not public is assumed
+// to be addressed to followers.
+func Visibility(obj vocab.Type) string {
+	if prop.IsListed(obj) {
+		return "public"
+	}
+
+	if prop.IsPublic(obj) {
+		return "unlisted"
+	}
+
+	mentions := prop.Mentions(obj)
+
+	for _, recipient := range prop.Recipients(obj) {
+		if !util.UrlIn(recipient, mentions) {
+			return "private"
+		}
+	}
+
+	return "direct"
+}
@@ -0,0 +1,88 @@
+package mastodon
+
+import (
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/prop"
+	"net/url"
+	"testing"
+)
+
+func TestParseVisibility(t *testing.T) {
+	expected := map[string]fedcontext.Visibility{
+		"":         fedcontext.PUBLIC,
+		"public":   fedcontext.PUBLIC,
+		"unlisted": fedcontext.UNLISTED,
+		"private":  fedcontext.FOLLOWERS,
+		"direct":   fedcontext.DIRECT,
+	}
+
+	for s, v := range expected {
+		if got, err := ParseVisibility(s); err != nil || got != v {
+			t.Errorf("s=%v got=%v err=%v expected=%v", s, got, err, v)
+		}
+	}
+
+	if _, err := ParseVisibility("everyone"); err == nil {
+		t.Errorf("accepted bad visibility")
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	alice := toUrl(t, "https://example.com/alice")
+	followers := toUrl(t, "https://example.com/bob/followers")
+
+	for _, visibility := range []fedcontext.Visibility{
+		fedcontext.PUBLIC, fedcontext.UNLISTED, fedcontext.FOLLOWERS, fedcontext.DIRECT,
+	} {
+		note := mentioning(t, alice)
+
+		if err := fedcontext.Address(note, visibility, followers); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := string(visibility)
+
+		if visibility == fedcontext.FOLLOWERS {
+			expected = "private"
+		}
+
+		if got := Visibility(note); got != expected {
+			t.Errorf("got visibility=%v expected=%v", got, expected)
+		}
+	}
+}
+
+// Return a new note that mentions and is addressed to actor.
+func mentioning(t *testing.T, actor *url.URL) vocab.ActivityStreamsNote {
+	href := streams.NewActivityStreamsHrefProperty()
+	href.Set(actor)
+
+	mention := streams.NewActivityStreamsMention()
+	mention.SetActivityStreamsHref(href)
+
+	tag := streams.NewActivityStreamsTagProperty()
+	tag.AppendActivityStreamsMention(mention)
+
+	cc := streams.NewActivityStreamsCcProperty()
+	cc.AppendIRI(actor)
+
+	note := streams.NewActivityStreamsNote()
+	note.SetActivityStreamsTag(tag)
+	note.SetActivityStreamsCc(cc)
+
+	if len(prop.Mentions(note)) != 1 {
+		t.Fatalf("note does not mention actor=%v", actor)
+	}
+
+	return note
+}
+
+func toUrl(t *testing.T, iri string) *url.URL {
+	u, err := url.Parse(iri)
+	if err != nil {
+		t.Fatalf("iri=%v is not parsable to url.URL", iri)
+	}
+	return u
+}
@@ -0,0 +1,45 @@
+package media
+
+import (
+	"context"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fediri"
+)
+
+// Return the ActivityStreams representation of m for use in the
+// attachment property of objects.
+//
+// go-fed does not know about dimensions on objects or blurhashes,
+// which is why we go through a map; go-fed keeps unknown properties
+// around when serializing.
+func Attachment(m *db.FedMedia) (vocab.Type, error) {
+	mappings := map[string]interface{}{
+		"@context":  "https://www.w3.org/ns/activitystreams",
+		"type":      m.Kind(),
+		"url":       fediri.MediaIRI(m.Id).String(),
+		"mediaType": m.MediaType,
+	}
+
+	if m.Name != "" {
+		mappings["name"] = m.Name
+	}
+
+	if m.Width > 0 && m.Height > 0 {
+		mappings["width"] = m.Width
+		mappings["height"] = m.Height
+	}
+
+	if m.Blurhash != "" {
+		mappings["blurhash"] = m.Blurhash
+	}
+
+	obj, err := streams.ToType(context.Background(), mappings)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot build attachment for media=%v", m.Id)
+	}
+
+	return obj, nil
+}
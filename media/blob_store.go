@@ -0,0 +1,132 @@
+package media
+
+import (
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A place to keep the contents of uploaded files. Metadata is kept
+// in the database, a blob store only knows about ids and bytes.
+type BlobStore interface {
+	// Write all of r as the blob with given id. Existing blobs
+	// are overwritten.
+	Put(id string, r io.Reader) error
+
+	// Open the blob with given id for reading. The caller has to
+	// close the returned reader.
+	Open(id string) (io.ReadCloser, error)
+
+	// Remove the blob with given id.
+	Delete(id string) error
+}
+
+// The blob store returned by Store. Can be replaced with SetStore.
+var store BlobStore
+var storeLock sync.Mutex
+
+// Return the blob store uploaded files are kept in. Unless something
+// else was set with SetStore, this is a DiskStore in the configured
+// media directory.
+func Store() BlobStore {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	if store == nil {
+		store = &DiskStore{
+			Directory: config.Get().MediaPath(),
+		}
+	}
+
+	return store
+}
+
+// Use bs for keeping uploaded files from now on.
+func SetStore(bs BlobStore) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	store = bs
+}
+
+// Implements BlobStore by keeping each blob as a file in Directory.
+type DiskStore struct {
+	Directory string
+}
+
+func (ds *DiskStore) Put(id string, r io.Reader) error {
+	filename, err := ds.filename(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ds.Directory, 0700); err != nil {
+		return errors.Wrap(err, "cannot create media directory")
+	}
+
+	// write to a temporary file first s.t. readers never see
+	// half written files
+
+	tmp, err := ioutil.TempFile(ds.Directory, id+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "cannot create media file")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "cannot write media file")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "cannot write media file")
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (ds *DiskStore) Open(id string) (io.ReadCloser, error) {
+	filename, err := ds.filename(id)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, errors.NewfWith(http.StatusNotFound, "no media with id=%v", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "cannot open media file")
+	}
+
+	return fd, nil
+}
+
+func (ds *DiskStore) Delete(id string) error {
+	filename, err := ds.filename(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "cannot remove media file")
+	}
+
+	return nil
+}
+
+// Return the path of the file for the blob with given id. Ids that
+// would escape Directory are rejected.
+func (ds *DiskStore) filename(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", errors.NewfWith(http.StatusBadRequest, "bad media id=%v", id)
+	}
+
+	return filepath.Join(ds.Directory, id), nil
+}
@@ -0,0 +1,135 @@
+package media
+
+import (
+	"bytes"
+	"github.com/buckket/go-blurhash"
+	"github.com/kissen/fed/errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Number of components used for blurhashes. More components mean
+// more detail, but longer hashes. These are the values recommended
+// by the blurhash authors.
+const (
+	_BLURHASH_X = 4
+	_BLURHASH_Y = 3
+)
+
+// Largest number of pixels we are willing to decode. Small files can
+// describe huge images that would take up gigabytes once decoded.
+const _MAX_PIXELS = 40 * 1000 * 1000
+
+// Blurhashes are computed on a copy of the image that is at most
+// this many pixels wide and high. Blurhashes are blurry anyways and
+// computing them on large images is slow.
+const _BLURHASH_SIZE = 64
+
+// What we could find out about the contents of a file.
+type Info struct {
+	// MIME type of the file, e.g. "image/png".
+	MediaType string
+
+	// Dimensions of images in pixels. Zero for other files.
+	Width  int
+	Height int
+
+	// Blurhash of images. Empty for other files.
+	Blurhash string
+}
+
+// Look at the contents bs of a file and return what we can find out
+// about it. The media type is sniffed from the contents, what the
+// client claimed is ignored. Failing to decode an image is not an
+// error; we just know less about the file. Images that are too large
+// to decode are rejected with http.StatusRequestEntityTooLarge.
+func Inspect(bs []byte) (*Info, error) {
+	info := &Info{
+		MediaType: http.DetectContentType(bs),
+	}
+
+	// strip parameters like "; charset=utf-8"
+
+	if idx := strings.Index(info.MediaType, ";"); idx >= 0 {
+		info.MediaType = strings.TrimSpace(info.MediaType[:idx])
+	}
+
+	if !strings.HasPrefix(info.MediaType, "image/") {
+		return info, nil
+	}
+
+	// look at the dimensions before decoding the whole image
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(bs))
+	if err != nil {
+		log.Printf("cannot decode image of type=%v: %v", info.MediaType, err)
+		return info, nil
+	}
+
+	if int64(config.Width)*int64(config.Height) > _MAX_PIXELS {
+		return nil, errors.NewfWith(http.StatusRequestEntityTooLarge, "image with width=%v height=%v too large", config.Width, config.Height)
+	}
+
+	info.Width, info.Height = config.Width, config.Height
+
+	img, _, err := image.Decode(bytes.NewReader(bs))
+	if err != nil {
+		log.Printf("cannot decode image of type=%v: %v", info.MediaType, err)
+		return info, nil
+	}
+
+	if hash, err := blurhash.Encode(_BLURHASH_X, _BLURHASH_Y, shrink(img, _BLURHASH_SIZE)); err != nil {
+		log.Printf("cannot compute blurhash: %v", err)
+	} else {
+		info.Blurhash = hash
+	}
+
+	return info, nil
+}
+
+// Return a copy of img that is at most size pixels wide and high.
+// The aspect ratio is kept. Pixels are picked, not averaged; that is
+// good enough for blurhashes. Images that are small enough are
+// returned as they are.
+func shrink(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, size
+
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, tw, th))
+
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			sx := bounds.Min.X + x*w/tw
+			sy := bounds.Min.Y + y*h/th
+			small.Set(x, y, img.At(sx, sy))
+		}
+	}
+
+	return small
+}
+
+// Return the larger of a and b.
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,71 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x), A: 255})
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestInspectImage(t *testing.T) {
+	info, err := Inspect(encodePNG(t, 300, 200))
+	if err != nil {
+		t.Fatalf("inspect failed err=%v", err)
+	}
+
+	if info.MediaType != "image/png" || info.Width != 300 || info.Height != 200 {
+		t.Errorf("got info=%+v", info)
+	}
+
+	if info.Blurhash == "" {
+		t.Errorf("missing blurhash")
+	}
+}
+
+func TestInspectTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the logical screen size follows the signature; claim the
+	// largest size a gif can have
+
+	bs := buf.Bytes()
+	copy(bs[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	if _, err := Inspect(bs); err == nil {
+		t.Errorf("accepted huge image")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 10))
+
+	if b := shrink(img, 64).Bounds(); b.Dx() != 64 || b.Dy() != 1 {
+		t.Errorf("got bounds=%v", b)
+	}
+
+	if shrink(img, 2000) != image.Image(img) {
+		t.Errorf("small image was copied")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-fed/activity/streams"
+	"github.com/gorilla/mux"
+	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/media"
+	"github.com/kissen/fed/proxy"
+	"github.com/kissen/fed/util"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Largest file we accept for upload in bytes.
+const _MAX_UPLOAD_SIZE = 16 << 20
+
+// POST /{username}/media
+//
+// The uploadMedia endpoint of the Social API. Expects a multipart
+// form with the contents of the file in field file and a shell object
+// in field object. The name property of the shell is used as alt
+// text. Answers with the object that describes the uploaded file
+// which clients can use as attachment.
+func PostUploadMedia(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostUploadMedia(%v)", r.URL)
+
+	// only the owner may upload
+
+	username := mux.Vars(r)["username"]
+	fc := fedcontext.Context(r)
+
+	if apiRequireScope(w, r, "write:media") {
+		return
+	}
+
+	client := fc.Client
+
+	if lu, ok := fedcontext.LocalUsername(client); !ok || lu != username {
+		ApiError(w, r, "authenticated with wrong username", http.StatusForbidden)
+		return
+	}
+
+	// read the form
+
+	r.Body = http.MaxBytesReader(w, r.Body, _MAX_UPLOAD_SIZE)
+
+	if err := r.ParseMultipartForm(_MAX_UPLOAD_SIZE); err != nil {
+		ApiError(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		ApiError(w, r, "missing file", http.StatusBadRequest)
+		return
+	}
+
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	name, err := shellName(r.FormValue("object"))
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// store contents and metadata
+
+	info, err := media.Inspect(contents)
+	if err != nil {
+		ApiError(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	m := db.NewFedMedia(username, info.MediaType, name)
+	m.Width, m.Height, m.Blurhash = info.Width, info.Height, info.Blurhash
+
+	if err := media.Store().Put(m.Id, bytes.NewReader(contents)); err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := fedcontext.Context(r).Storage.StoreMedia(m); err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	// answer with the filled in object
+
+	attachment, err := media.Attachment(m)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	mappings, err := streams.Serialize(attachment)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	bs, err := json.Marshal(mappings)
+	if err != nil {
+		ApiError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", util.AP_TYPE)
+	w.Header().Set("Location", fediri.MediaIRI(m.Id).String())
+	w.WriteHeader(http.StatusCreated)
+
+	if _, err := w.Write(bs); err != nil {
+		log.Printf("writing upload response failed: %v", err)
+	}
+}
+
+// GET /media/{id}
+//
+// Serve the uploaded file with given id.
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetMedia(%v)", r.URL)
+
+	id := mux.Vars(r)["id"]
+
+	m, err := fedcontext.Context(r).Storage.RetrieveMedia(id)
+	if err != nil {
+		DoError(w, r, "no media with that id", http.StatusNotFound)
+		return
+	}
+
+	fd, err := media.Store().Open(m.Id)
+	if err != nil {
+		DoError(w, r, "cannot open media", http.StatusInternalServerError)
+		return
+	}
+
+	defer fd.Close()
+
+	// uploads are user controlled; make sure browsers never run
+	// them as part of our site
+
+	w.Header().Set("Content-Type", m.MediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if m.Kind() == "Document" {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+
+	if _, err := io.Copy(w, fd); err != nil {
+		log.Printf(`serving media id="%v" failed with err="%v"`, m.Id, err)
+	}
+}
+
+// GET /proxy/media?url={url}&sig={sig}
+//
+// Serve the remote image, video or audio file at url through our
+// cache. This way remotes do not learn the addresses of our users
+// and files stay available when remotes go down. The signature sig
+// is created when rendering pages; without it, we would be an open
+// proxy.
+func GetProxyMedia(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GetProxyMedia(%v)", r.URL)
+
+	addr := r.URL.Query().Get("url")
+	sig := r.URL.Query().Get("sig")
+
+	if !proxy.Verify(addr, sig) {
+		DoError(w, r, "bad signature", http.StatusForbidden)
+		return
+	}
+
+	entry, contents, err := proxy.Fetch(addr)
+	if err != nil {
+		status := http.StatusBadGateway
+
+		if es, ok := errors.Status(err); ok {
+			status = es
+		}
+
+		DoError(w, r, err, status)
+		return
+	}
+
+	defer contents.Close()
+
+	w.Header().Set("Content-Type", entry.MediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	if _, err := io.Copy(w, contents); err != nil {
+		log.Printf(`proxying url="%v" failed with err="%v"`, addr, err)
+	}
+}
+
+// Given the JSON shell object sent along with an upload, return its
+// name property. An empty shell is fine.
+func shellName(shell string) (string, error) {
+	if strings.TrimSpace(shell) == "" {
+		return "", nil
+	}
+
+	var mappings map[string]interface{}
+
+	if err := json.Unmarshal([]byte(shell), &mappings); err != nil {
+		return "", err
+	}
+
+	name, _ := mappings["name"].(string)
+	return strings.TrimSpace(name), nil
+}
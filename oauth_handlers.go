@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"github.com/kissen/fed/config"
 	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fedcontext"
 	"github.com/kissen/fed/template"
 	"github.com/kissen/fed/util"
@@ -12,38 +13,74 @@ import (
 	"net/url"
 )
 
+// GET /oauth/authorize
+//
+// Shows the login form that authorizes the client in query parameter
+// client_id.
 func GetOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GetOAuthAuthorize()")
 
-	if done := validateOAuthAuthorize(w, r); done {
+	client, grant, done := validateOAuthAuthorize(w, r)
+	if done {
 		return
 	}
 
-	template.Render(w, r, "res/authorize.page.tmpl", nil)
+	data := map[string]interface{}{
+		"Client":       client,
+		"Scopes":       grant.Scope.Scopes(),
+		"SecondFactor": fedcontext.Context(r).PendingLogin.Valid(),
+	}
+
+	template.Render(w, r, "res/authorize.page.tmpl", data)
 }
 
+// POST /oauth/authorize
+//
+// Checks the submitted credentials and sends the user back to the
+// client with a code the client can exchange for a token. Query
+// parameter state is passed back to the client unchanged.
 func PostOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
 	log.Printf("PostOAuthAuthorize()")
 
-	if done := validateOAuthAuthorize(w, r); done {
+	_, grant, done := validateOAuthAuthorize(w, r)
+	if done {
 		return
 	}
 
-	// get login credentials
+	// the form is only valid if it came from our own page
 
-	username, ok := util.FormValue(r, "username")
-	if !ok {
-		fedcontext.FlashWarning(r, "missing username")
-		fedcontext.Status(r, http.StatusBadRequest)
+	if err := fedcontext.CheckCSRF(r); err != nil {
+		fedcontext.FlashWarning(r, "form expired, please try again")
+		fedcontext.Status(r, http.StatusForbidden)
 
 		GetOAuthAuthorize(w, r)
 		return
 	}
 
-	password, ok := util.FormValue(r, "password")
-	if !ok {
-		fedcontext.FlashWarning(r, "missing password")
-		fedcontext.Status(r, http.StatusBadRequest)
+	// check login credentials; users with a second factor need
+	// to submit the form twice
+
+	user, secondStep, err := checkLogin(r)
+	if err != nil {
+		fedcontext.FlashWarning(r, err.Error())
+		fedcontext.Status(r, statusOf(err, http.StatusUnauthorized))
+
+		GetOAuthAuthorize(w, r)
+		return
+	}
+
+	if secondStep {
+		GetOAuthAuthorize(w, r)
+		return
+	}
+
+	username := user.Name
+
+	// only administrators may hand out administrative scopes
+
+	if grant.Scope.IsAdmin() && !config.Get().IsAdmin(username) {
+		fedcontext.FlashWarning(r, "only administrators may grant admin scopes")
+		fedcontext.Status(r, http.StatusForbidden)
 
 		GetOAuthAuthorize(w, r)
 		return
@@ -52,21 +89,27 @@ func PostOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
 	// generate a code
 
 	storage := fedcontext.Context(r).Storage
-	code, err := db.NewFedOAuthCode(username, password, storage)
+	code, err := db.NewFedOAuthCode(username, grant, storage)
 	if err != nil {
 		ApiError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	// prepare the redirect addr
+	log.Printf("recorded code for username=%v scope=%v", username, code.Scope)
 
-	redirectUris, ok := r.URL.Query()["redirect_uri"]
-	if !ok {
-		ApiError(w, r, "missing redirect_uri", http.StatusBadRequest)
+	// clients that cannot receive redirects show the code to the
+	// user who then copies it over
+
+	if grant.RedirectURI == db.OOB_REDIRECT_URI {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(code.Code))
 		return
 	}
 
-	redirect, err := url.Parse(redirectUris[0])
+	// prepare the redirect addr; it was checked against the
+	// registered redirect URIs before
+
+	redirect, err := url.Parse(grant.RedirectURI)
 	if err != nil {
 		ApiError(w, r, err, http.StatusBadRequest)
 		return
@@ -74,109 +117,294 @@ func PostOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
 
 	redirect = util.WithParam(redirect, "code", code.Code)
 
+	if state := r.URL.Query().Get("state"); state != "" {
+		redirect = util.WithParam(redirect, "state", state)
+	}
+
 	// send out reply
 
 	http.Redirect(w, r, redirect.String(), http.StatusFound)
-	log.Printf("recorded code=%v for username=%v", code.Code, username)
 }
 
+// POST /oauth/token
+//
+// Exchanges a code or a refresh token for a token. Confidential
+// clients authenticate with client_secret; public clients that cannot
+// keep a secret have to use PKCE instead and cannot refresh. Each
+// refresh token can only be used once; refreshing returns a new
+// refresh token.
 func PostOAuthToken(w http.ResponseWriter, r *http.Request) {
 	log.Printf("PostOAuthToken()")
 
 	// parse out args
 
-	args := []string{
-		"client_id", "client_secret", "redirect_uri",
-		"code", "grant_type",
+	qs, err := query([]string{"grant_type"}, r)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	qs, err := query(args, r)
+	// authenticate the client
+
+	client, confidential, err := authenticateClient(r)
 	if err != nil {
-		ApiError(w, r, err, http.StatusBadRequest)
+		ApiError(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
-	// validate args
+	// create token
 
-	code := qs["code"]
-	grantType := qs["grant_type"]
+	var tokenmeta *db.FedOAuthToken
 
-	if grantType != "authorization_code" {
-		ApiError(w, r, "unsupported grant_type", http.StatusBadRequest)
+	switch qs["grant_type"] {
+	case "authorization_code":
+		tokenmeta, err = exchangeCode(r, client, confidential)
+	case "refresh_token":
+		tokenmeta, err = exchangeRefreshToken(r, client, confidential)
+	default:
+		err = errors.NewWith(http.StatusBadRequest, "unsupported grant_type")
+	}
+
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	// look up user
+	// write out reply
+
+	reply := map[string]interface{}{
+		"access_token":  tokenmeta.Token,
+		"token_type":    "Bearer",
+		"scope":         tokenmeta.Scope.String(),
+		"created_at":    tokenmeta.IssuedOn.Unix(),
+		"expires_in":    tokenmeta.ExpiresIn(),
+		"refresh_token": tokenmeta.RefreshToken,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	apiReply(w, r, http.StatusOK, reply)
+
+	log.Printf("recorded session=%v for user=%v", tokenmeta.Id, tokenmeta.Username)
+}
+
+// POST /oauth/revoke
+//
+// Revokes an access token or refresh token as described in RFC 7009.
+// Clients may only revoke tokens issued to them. Unknown tokens are
+// not an error, they might have been revoked already.
+func PostOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PostOAuthRevoke()")
 
-	cm, err := fedcontext.Context(r).Storage.RetrieveCode(code)
+	qs, err := query([]string{"token"}, r)
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	client, _, err := authenticateClient(r)
 	if err != nil {
 		ApiError(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
-	// create token
+	// the token might be an access token or a refresh token
 
 	storage := fedcontext.Context(r).Storage
-	tokenmeta, err := db.NewFedOAuthTokenFor(cm.Username, storage)
+
+	tokenmeta, err := storage.RetrieveToken(qs["token"])
 	if err != nil {
+		tokenmeta, err = db.RetrieveRefreshToken(qs["token"], storage)
+	}
+
+	if err != nil {
+		log.Printf("nothing to revoke for client=%v: %v", client.Id, err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if tokenmeta.ClientId != client.Id {
+		ApiError(w, r, "token was issued to another client", http.StatusForbidden)
+		return
+	}
+
+	if err := storage.DeleteToken(tokenmeta.Token); err != nil {
 		ApiError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	// create reply message
+	w.WriteHeader(http.StatusOK)
+	log.Printf("revoked session=%v of user=%v", tokenmeta.Id, tokenmeta.Username)
+}
 
-	reply := map[string]interface{}{
-		"access_token": tokenmeta.Token,
-		"token_type":   "Bearer",
-		"scope":        "all",
-		"created_at":   tokenmeta.IssuedOn.Unix(),
+// Look up the client identified by form value client_id. Clients
+// registered with a secret are confidential and have to send it as
+// client_secret; leaving it out does not make them public.
+func authenticateClient(r *http.Request) (client *db.FedOAuthClient, confidential bool, err error) {
+	qs, err := query([]string{"client_id"}, r)
+	if err != nil {
+		return nil, false, errors.WithStatus(http.StatusBadRequest, err)
 	}
 
-	replybytes, err := json.Marshal(&reply)
+	client, err = fedcontext.Context(r).Storage.RetrieveClient(qs["client_id"])
 	if err != nil {
-		ApiError(w, r, err, http.StatusInternalServerError)
-		return
+		return nil, false, errors.New("unknown client_id")
 	}
 
-	// write out response
+	if client.Secret == "" {
+		return client, false, nil
+	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	if !client.SecretOK(r.FormValue("client_secret")) {
+		return nil, false, errors.New("bad client_secret")
+	}
+
+	return client, true, nil
+}
+
+// Exchange the code in request r for a token. Codes may only be used
+// once. Public clients need to have used PKCE when requesting the
+// code.
+func exchangeCode(r *http.Request, client *db.FedOAuthClient, confidential bool) (*db.FedOAuthToken, error) {
+	qs, err := query([]string{"redirect_uri", "code"}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// look up code; codes may only be used once, so it is deleted
+	// right away, no matter whether the exchange succeeds
+
+	storage := fedcontext.Context(r).Storage
+
+	cm, err := storage.TakeCode(qs["code"])
+	if err != nil {
+		return nil, errors.NewWith(http.StatusUnauthorized, "bad code")
+	}
 
-	if _, err := w.Write(replybytes); err != nil {
-		log.Printf("repy with token failed: %v", err)
+	if !confidential && cm.Challenge == "" {
+		return nil, errors.NewWith(http.StatusUnauthorized, "missing client_secret")
 	}
 
-	log.Printf("recorded token=%v for user=%v", tokenmeta.Token, cm.Username)
+	if err := cm.Verify(client.Id, qs["redirect_uri"], r.FormValue("code_verifier")); err != nil {
+		return nil, err
+	}
+
+	return db.NewFedOAuthTokenFor(cm.Username, client.Id, cm.Scope, storage)
+}
+
+// Exchange the refresh token in request r for a new token. The old
+// token and refresh token stop working. Optional form value scope
+// narrows down the scope of the new token. There is no PKCE for
+// refreshing, so only confidential clients may refresh; otherwise
+// a leaked refresh token would be all it takes.
+func exchangeRefreshToken(r *http.Request, client *db.FedOAuthClient, confidential bool) (*db.FedOAuthToken, error) {
+	qs, err := query([]string{"refresh_token"}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !confidential {
+		return nil, errors.NewWith(http.StatusUnauthorized, "missing client_secret")
+	}
+
+	storage := fedcontext.Context(r).Storage
+
+	old, err := db.RetrieveRefreshToken(qs["refresh_token"], storage)
+	if err != nil {
+		return nil, errors.WrapWith(http.StatusUnauthorized, err, "bad refresh_token")
+	}
+
+	if old.ClientId != client.Id {
+		return nil, errors.NewWith(http.StatusUnauthorized, "refresh_token was issued to another client")
+	}
+
+	var scope db.FedOAuthScope
+
+	if requested := r.FormValue("scope"); requested != "" {
+		if scope, err = db.ParseOAuthScope(requested); err != nil {
+			return nil, err
+		}
+	}
+
+	return old.Refresh(scope, storage)
 }
 
 // Validate a request to /oauth/authorize, that is look at whether all
-// mandatory query parameters are present.
-func validateOAuthAuthorize(w http.ResponseWriter, r *http.Request) (ok bool) {
+// mandatory query parameters are present, whether the client is
+// registered and whether it may use the given redirect_uri and scope.
+//
+// Returns the client and the grant a code would be issued for. If the
+// request is not valid, an error is written out and done is true.
+func validateOAuthAuthorize(w http.ResponseWriter, r *http.Request) (client *db.FedOAuthClient, grant db.FedOAuthGrant, done bool) {
 	ks := []string{
 		"response_type", "client_id", "redirect_uri",
 	}
 
 	ps, err := query(ks, r)
 	if err != nil {
-		ApiError(w, r, err, http.StatusInternalServerError)
-		return true
+		ApiError(w, r, err, http.StatusBadRequest)
+		return nil, grant, true
 	}
 
 	if ps["response_type"] != "code" {
 		ApiError(w, r, "unsupported response_type", http.StatusBadRequest)
-		return true
+		return nil, grant, true
+	}
+
+	// we never redirect to addresses the client did not register;
+	// otherwise anyone could have codes sent to their server
+
+	client, err = fedcontext.Context(r).Storage.RetrieveClient(ps["client_id"])
+	if err != nil {
+		ApiError(w, r, "unknown client_id", http.StatusBadRequest)
+		return nil, grant, true
+	}
+
+	if !client.RedirectAllowed(ps["redirect_uri"]) {
+		ApiError(w, r, "redirect_uri not registered for client", http.StatusBadRequest)
+		return nil, grant, true
 	}
 
-	return false
+	// clients may ask for at most what they registered for
+
+	scope, err := db.ParseOAuthScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		ApiError(w, r, err, http.StatusBadRequest)
+		return nil, grant, true
+	}
+
+	if !client.Scope.Covers(scope) {
+		ApiError(w, r, "scope exceeds scopes registered for client", http.StatusBadRequest)
+		return nil, grant, true
+	}
+
+	// PKCE is optional; if it is used, it has to be S256
+
+	grant = db.FedOAuthGrant{
+		ClientId:        client.Id,
+		RedirectURI:     ps["redirect_uri"],
+		Scope:           scope,
+		Challenge:       r.URL.Query().Get("code_challenge"),
+		ChallengeMethod: r.URL.Query().Get("code_challenge_method"),
+	}
+
+	if grant.Challenge != "" && grant.ChallengeMethod != db.PKCE_S256 {
+		ApiError(w, r, "unsupported code_challenge_method", http.StatusBadRequest)
+		return nil, grant, true
+	}
+
+	return client, grant, false
 }
 
 // Given a set of keys, return a map that maps each key to the query
-// parameter value in request r. Returns an r if at least one key
-// in keys is not present in request r.
+// parameter or form value in request r. Returns an error if at least
+// one key in keys is not present in request r.
 func query(keys []string, r *http.Request) (params map[string]string, err error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "bad form")
+	}
+
 	params = make(map[string]string)
-	q := r.URL.Query()
+	q := r.Form
 
 	for _, k := range keys {
 		vs, ok := q[k]
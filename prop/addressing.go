@@ -0,0 +1,93 @@
+package prop
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"log"
+	"net/url"
+)
+
+// The special collection that addresses everyone; see section 5.6 of
+// the ActivityPub specification.
+const PUBLIC = "https://www.w3.org/ns/activitystreams#Public"
+
+// Return all IRIs object is addressed to, that is the contents of
+// the to, cc, bto, bcc and audience properties.
+func Recipients(object vocab.Type) []*url.URL {
+	return IRIs(object, "to", "cc", "bto", "bcc", "audience")
+}
+
+// Return all IRIs contained in the properties with names keys
+// on object.
+func IRIs(object vocab.Type, keys ...string) (iris []*url.URL) {
+	mappings, err := object.Serialize()
+	if err != nil {
+		log.Println("cannot serialize:", err)
+		return nil
+	}
+
+	for _, key := range keys {
+		for _, s := range Strings(mappings[key]) {
+			if iri, err := url.Parse(s); err == nil {
+				iris = append(iris, iri)
+			}
+		}
+	}
+
+	return iris
+}
+
+// Return the IRIs of all actors mentioned in object, that is the
+// targets of all Mention entries in the tag property.
+func Mentions(object vocab.Type) (iris []*url.URL) {
+	mappings, err := object.Serialize()
+	if err != nil {
+		log.Println("cannot serialize:", err)
+		return nil
+	}
+
+	for _, m := range tags(mappings, "Mention") {
+		if href, ok := m["href"].(string); !ok {
+			continue
+		} else if iri, err := url.Parse(href); err == nil {
+			iris = append(iris, iri)
+		}
+	}
+
+	return iris
+}
+
+// Return whether object is addressed to the public collection.
+func IsPublic(object vocab.Type) bool {
+	for _, iri := range Recipients(object) {
+		if IsPublicIRI(iri) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether object is meant to be shown on public timelines.
+// That is the case if the public collection is in the to property.
+// Unlisted objects only have it in cc.
+func IsListed(object vocab.Type) bool {
+	for _, iri := range IRIs(object, "to") {
+		if IsPublicIRI(iri) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether iri points to the public collection. Besides the
+// full IRI, the compacted forms "as:Public" and "Public" are
+// also accepted as these are common on the fediverse.
+func IsPublicIRI(iri *url.URL) bool {
+	switch iri.String() {
+	case PUBLIC, "as:Public", "Public":
+		return true
+	default:
+		return false
+	}
+}
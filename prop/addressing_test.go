@@ -0,0 +1,75 @@
+package prop
+
+import (
+	"github.com/go-fed/activity/streams"
+	"testing"
+)
+
+func TestIsPublic_NoRecipients(t *testing.T) {
+	note := streams.NewActivityStreamsNote()
+
+	if IsPublic(note) {
+		t.Error("note without recipients considered public")
+	}
+}
+
+func TestIsPublic_To(t *testing.T) {
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(toUrl(t, "https://example.com/fed/alice"))
+	to.AppendIRI(toUrl(t, PUBLIC))
+
+	note := streams.NewActivityStreamsNote()
+	note.SetActivityStreamsTo(to)
+
+	if !IsPublic(note) {
+		t.Error("note addressed to public not considered public")
+	}
+
+	if count := len(Recipients(note)); count != 2 {
+		t.Errorf("bad number of recipients expected=2 got=%v", count)
+	}
+
+	if !IsListed(note) {
+		t.Error("note addressed to public not considered listed")
+	}
+}
+
+func TestIsPublic_CompactCc(t *testing.T) {
+	cc := streams.NewActivityStreamsCcProperty()
+	cc.AppendIRI(toUrl(t, "as:Public"))
+
+	note := streams.NewActivityStreamsNote()
+	note.SetActivityStreamsCc(cc)
+
+	if !IsPublic(note) {
+		t.Error("note with compacted public cc not considered public")
+	}
+
+	if IsListed(note) {
+		t.Error("unlisted note with public cc considered listed")
+	}
+}
+
+func TestMentions(t *testing.T) {
+	href := streams.NewActivityStreamsHrefProperty()
+	href.Set(toUrl(t, "https://example.com/fed/alice"))
+
+	mention := streams.NewActivityStreamsMention()
+	mention.SetActivityStreamsHref(href)
+
+	tag := streams.NewActivityStreamsTagProperty()
+	tag.AppendActivityStreamsMention(mention)
+
+	note := streams.NewActivityStreamsNote()
+	note.SetActivityStreamsTag(tag)
+
+	mentions := Mentions(note)
+
+	if count := len(mentions); count != 1 {
+		t.Fatalf("bad number of mentions expected=1 got=%v", count)
+	}
+
+	if s := mentions[0].String(); s != "https://example.com/fed/alice" {
+		t.Errorf("bad mention got=%v", s)
+	}
+}
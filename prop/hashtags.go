@@ -0,0 +1,66 @@
+package prop
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"log"
+	"strings"
+)
+
+// Return the names of all hashtags object is tagged with in lower
+// case and without the leading '#'. If object is an activity,
+// hashtags of embedded objects are also returned.
+func Hashtags(object vocab.Type) (hashtags []string) {
+	mappings, err := object.Serialize()
+	if err != nil {
+		log.Println("cannot serialize:", err)
+		return nil
+	}
+
+	candidates := []map[string]interface{}{mappings}
+
+	if embedded, ok := mappings["object"].(map[string]interface{}); ok {
+		candidates = append(candidates, embedded)
+	}
+
+	for _, candidate := range candidates {
+		for _, m := range tags(candidate, "Hashtag") {
+			if name, ok := m["name"].(string); ok {
+				hashtag := strings.ToLower(strings.TrimPrefix(name, "#"))
+				hashtags = append(hashtags, hashtag)
+			}
+		}
+	}
+
+	return hashtags
+}
+
+// Return whether object is tagged with hashtag. The comparison
+// ignores case and a leading '#'.
+func HasHashtag(object vocab.Type, hashtag string) bool {
+	needle := strings.ToLower(strings.TrimPrefix(hashtag, "#"))
+
+	for _, h := range Hashtags(object) {
+		if h == needle {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return all entries of the tag property in mappings that have
+// the given type.
+func tags(mappings map[string]interface{}, kind string) (ms []map[string]interface{}) {
+	entries, ok := mappings["tag"].([]interface{})
+	if !ok {
+		entries = []interface{}{mappings["tag"]}
+	}
+
+	for _, entry := range entries {
+		if m, ok := entry.(map[string]interface{}); ok && m["type"] == kind {
+			ms = append(ms, m)
+		}
+	}
+
+	return ms
+}
@@ -0,0 +1,69 @@
+package prop
+
+import (
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"net/url"
+)
+
+// Add reply to the replies collection of object. If object does not
+// have a replies collection yet, a new one is created.
+//
+// Only embedded replies collections are supported. If the replies
+// collection of object is just an IRI, an error is returned.
+func AddReply(object vocab.Type, reply *url.URL) error {
+	type replier interface {
+		GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+		SetActivityStreamsReplies(vocab.ActivityStreamsRepliesProperty)
+	}
+
+	r, ok := object.(replier)
+	if !ok {
+		return fmt.Errorf("%T does not have replies property", object)
+	}
+
+	// get the collection; create it if necessary
+
+	replies := r.GetActivityStreamsReplies()
+	if replies == nil {
+		replies = streams.NewActivityStreamsRepliesProperty()
+	}
+
+	var collection vocab.ActivityStreamsCollection
+
+	if replies.IsActivityStreamsCollection() {
+		collection = replies.GetActivityStreamsCollection()
+	} else if replies.IsIRI() {
+		return fmt.Errorf("replies of %v is only an IRI", Id(object))
+	} else {
+		collection = streams.NewActivityStreamsCollection()
+	}
+
+	// add the reply unless it is already in there
+
+	items := collection.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+	}
+
+	for it := items.Begin(); it != items.End(); it = it.Next() {
+		if it.IsIRI() && it.GetIRI().String() == reply.String() {
+			return nil
+		}
+	}
+
+	items.AppendIRI(reply)
+
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(items.Len())
+
+	// write everything back
+
+	collection.SetActivityStreamsItems(items)
+	collection.SetActivityStreamsTotalItems(totalItems)
+	replies.SetActivityStreamsCollection(collection)
+	r.SetActivityStreamsReplies(replies)
+
+	return nil
+}
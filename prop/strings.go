@@ -0,0 +1,29 @@
+package prop
+
+// Given the value of a serialized property (e.g. from calling
+// Serialize on a vocab.Type), return all IRIs or strings it
+// contains.
+//
+// Properties might be a single string, an array of strings, an
+// embedded object or an array of embedded objects. For embedded
+// objects, the "id" (or "href" for links) is returned.
+func Strings(value interface{}) (ss []string) {
+	switch v := value.(type) {
+	case string:
+		ss = append(ss, v)
+
+	case []interface{}:
+		for _, entry := range v {
+			ss = append(ss, Strings(entry)...)
+		}
+
+	case map[string]interface{}:
+		if id, ok := v["id"].(string); ok {
+			ss = append(ss, id)
+		} else if href, ok := v["href"].(string); ok {
+			ss = append(ss, href)
+		}
+	}
+
+	return ss
+}
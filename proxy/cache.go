@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/kissen/fed/errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Suffix of the files that contain the metadata of cached entries.
+const _META_SUFFIX = ".meta"
+
+// What we remember about a cached remote file.
+type Entry struct {
+	// Where we got the file from.
+	URL string
+
+	// MIME type of the file, e.g. "image/png".
+	MediaType string
+
+	// Size of the file in bytes.
+	Size int64
+}
+
+// An on-disk cache of remote files. If the files in the cache
+// take up more than Quota bytes, the least recently used files
+// are evicted.
+type Cache struct {
+	Directory string
+	Quota     int64
+
+	lock sync.Mutex
+
+	// Entries ordered by last use, most recently used first. The
+	// values are the keys of the entries.
+	lru *list.List
+
+	// All entries by key together with their element in lru.
+	entries map[string]*cached
+
+	// Sum of the sizes of all entries.
+	size int64
+}
+
+type cached struct {
+	entry   *Entry
+	element *list.Element
+}
+
+// Return the entry for addr and its contents. If addr is not
+// cached, an error with status http.StatusNotFound is returned. The
+// caller has to close the returned reader.
+func (c *Cache) Get(addr string) (*Entry, io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.load(); err != nil {
+		return nil, nil, err
+	}
+
+	key := c.key(addr)
+
+	ce, ok := c.entries[key]
+	if !ok {
+		return nil, nil, errors.NewfWith(http.StatusNotFound, "addr=%v not cached", addr)
+	}
+
+	fd, err := os.Open(c.filename(key))
+	if err != nil {
+		c.remove(key)
+		return nil, nil, errors.NewfWith(http.StatusNotFound, "addr=%v went missing", addr)
+	}
+
+	c.lru.MoveToFront(ce.element)
+	return ce.entry, fd, nil
+}
+
+// Write contents of the file at entry.URL into the cache. Older
+// entries are evicted if the cache grows beyond its quota.
+func (c *Cache) Put(entry *Entry, contents []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.load(); err != nil {
+		return err
+	}
+
+	key := c.key(entry.URL)
+	entry.Size = int64(len(contents))
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "cannot serialize cache entry")
+	}
+
+	if err := ioutil.WriteFile(c.filename(key), contents, 0600); err != nil {
+		return errors.Wrap(err, "cannot write cache file")
+	}
+
+	if err := ioutil.WriteFile(c.filename(key)+_META_SUFFIX, meta, 0600); err != nil {
+		return errors.Wrap(err, "cannot write cache metadata")
+	}
+
+	c.remember(key, entry)
+	c.evict()
+
+	return nil
+}
+
+// Fill in the index from the cache directory if we did not do so
+// yet. Files that were used most recently are considered to be the
+// most recently used entries.
+func (c *Cache) load() error {
+	if c.entries != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.Directory, 0700); err != nil {
+		return errors.Wrap(err, "cannot create cache directory")
+	}
+
+	infos, err := ioutil.ReadDir(c.Directory)
+	if err != nil {
+		return errors.Wrap(err, "cannot list cache directory")
+	}
+
+	c.lru = list.New()
+	c.entries = make(map[string]*cached)
+
+	// oldest first s.t. the newest entry ends up in front
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), _META_SUFFIX) {
+			continue
+		}
+
+		key := strings.TrimSuffix(info.Name(), _META_SUFFIX)
+
+		bs, err := ioutil.ReadFile(c.filename(key) + _META_SUFFIX)
+		if err != nil {
+			log.Printf("skipping cache entry=%v: %v", key, err)
+			continue
+		}
+
+		var entry Entry
+
+		if err := json.Unmarshal(bs, &entry); err != nil {
+			log.Printf("skipping cache entry=%v: %v", key, err)
+			continue
+		}
+
+		c.remember(key, &entry)
+	}
+
+	c.evict()
+	return nil
+}
+
+// Add entry with given key to the index as most recently used entry.
+func (c *Cache) remember(key string, entry *Entry) {
+	if ce, ok := c.entries[key]; ok {
+		c.size -= ce.entry.Size
+		c.lru.Remove(ce.element)
+	}
+
+	c.entries[key] = &cached{
+		entry:   entry,
+		element: c.lru.PushFront(key),
+	}
+
+	c.size += entry.Size
+}
+
+// Remove least recently used entries until we are within quota.
+func (c *Cache) evict() {
+	for c.size > c.Quota && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		c.remove(oldest.Value.(string))
+	}
+}
+
+// Remove the entry with given key from index and disk.
+func (c *Cache) remove(key string) {
+	if ce, ok := c.entries[key]; ok {
+		c.size -= ce.entry.Size
+		c.lru.Remove(ce.element)
+		delete(c.entries, key)
+	}
+
+	for _, filename := range []string{c.filename(key), c.filename(key) + _META_SUFFIX} {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			log.Printf("cannot remove filename=%v: %v", filename, err)
+		}
+	}
+}
+
+// Return the key for the file at addr. Keys are safe to use as
+// filenames.
+func (c *Cache) key(addr string) string {
+	sum := sha256.Sum256([]byte(addr))
+	return hex.EncodeToString(sum[:])
+}
+
+// Return the path of the file that holds the contents of the entry
+// with given key.
+func (c *Cache) filename(key string) string {
+	return filepath.Join(c.Directory, key)
+}
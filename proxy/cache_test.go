@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testCache(t *testing.T, quota int64) *Cache {
+	dir, err := ioutil.TempDir("", "fed-proxy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Cache{
+		Directory: dir,
+		Quota:     quota,
+	}
+}
+
+func TestCacheGetPut(t *testing.T) {
+	cache := testCache(t, 1024)
+	defer os.RemoveAll(cache.Directory)
+
+	addr := "https://example.com/bird.png"
+
+	if _, _, err := cache.Get(addr); err == nil {
+		t.Fatalf("expected error for uncached addr")
+	}
+
+	if err := cache.Put(&Entry{URL: addr, MediaType: "image/png"}, []byte("tweet")); err != nil {
+		t.Fatalf("put failed err=%v", err)
+	}
+
+	entry, fd, err := cache.Get(addr)
+	if err != nil {
+		t.Fatalf("get failed err=%v", err)
+	}
+
+	defer fd.Close()
+
+	if contents, err := ioutil.ReadAll(fd); err != nil {
+		t.Fatalf("read failed err=%v", err)
+	} else if string(contents) != "tweet" {
+		t.Errorf("bad contents expected=tweet got=%v", string(contents))
+	}
+
+	if entry.MediaType != "image/png" || entry.Size != 5 {
+		t.Errorf("bad entry got=%v", *entry)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := testCache(t, 10)
+	defer os.RemoveAll(cache.Directory)
+
+	put := func(addr string) {
+		if err := cache.Put(&Entry{URL: addr, MediaType: "image/png"}, []byte("12345")); err != nil {
+			t.Fatalf("put failed err=%v", err)
+		}
+	}
+
+	cached := func(addr string) bool {
+		if _, fd, err := cache.Get(addr); err != nil {
+			return false
+		} else {
+			fd.Close()
+			return true
+		}
+	}
+
+	put("https://example.com/a")
+	put("https://example.com/b")
+
+	// use a s.t. b is the least recently used entry
+
+	if !cached("https://example.com/a") {
+		t.Fatalf("a should be cached")
+	}
+
+	put("https://example.com/c")
+
+	if cached("https://example.com/b") {
+		t.Errorf("b should have been evicted")
+	}
+
+	if !cached("https://example.com/a") || !cached("https://example.com/c") {
+		t.Errorf("a and c should be cached")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	addr := "https://example.com/bird.png"
+
+	if !Verify(addr, sign(addr)) {
+		t.Errorf("valid signature rejected")
+	}
+
+	if Verify("https://example.com/other.png", sign(addr)) {
+		t.Errorf("signature for other addr accepted")
+	}
+
+	if Verify(addr, "nothex") {
+		t.Errorf("garbage signature accepted")
+	}
+}
@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kissen/fed/config"
+	"github.com/kissen/fed/errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Largest remote file we are willing to proxy in bytes.
+const _MAX_SIZE = 16 << 20
+
+const _HTTP_TIMEOUT = 16 * time.Second
+
+// The cache all proxied files go through.
+var cache *Cache
+var cacheOnce sync.Once
+
+// The client used for talking to remotes.
+var client = &http.Client{
+	Timeout: _HTTP_TIMEOUT,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: _HTTP_TIMEOUT,
+			Control: DialPublicOnly,
+		}).DialContext,
+	},
+}
+
+// Ranges of addresses the proxy never connects to. Otherwise remotes
+// could make us fetch things from our own network by attaching
+// links to it. These are the special-purpose ranges from the IANA
+// registries that are not globally reachable, together with ranges
+// like 6to4 that can be used to reach them in disguise.
+var forbidden = parseCIDRs(
+	// IPv4
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+	"169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24",
+	"192.88.99.0/24", "192.168.0.0/16", "198.18.0.0/15",
+	"198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+
+	// IPv6
+	"::/96", "64:ff9b::/96", "64:ff9b:1::/48", "100::/64", "2001::/23",
+	"2001:db8::/32", "2002::/16", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// Return the remote media at addr and its contents. If we have a
+// cached copy, that one is returned. Otherwise the file is downloaded
+// and added to the cache. The caller has to close the returned
+// reader.
+//
+// Only images, videos and audio files are proxied.
+func Fetch(addr string) (*Entry, io.ReadCloser, error) {
+	c := defaultCache()
+
+	if entry, contents, err := c.Get(addr); err == nil {
+		return entry, contents, nil
+	}
+
+	contents, mediaType, err := download(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &Entry{
+		URL:       addr,
+		MediaType: mediaType,
+	}
+
+	// we can still serve the file if caching fails
+
+	if err := c.Put(entry, contents); err != nil {
+		log.Printf("cannot cache addr=%v: %v", addr, err)
+	}
+
+	return entry, ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// Return the cache configured for this instance.
+func defaultCache() *Cache {
+	cacheOnce.Do(func() {
+		cache = &Cache{
+			Directory: config.Get().MediaCachePath(),
+			Quota:     config.Get().MediaCacheSize(),
+		}
+	})
+
+	return cache
+}
+
+// Download the file at addr. Returns the contents and the media type
+// of the file.
+func download(addr string) (contents []byte, mediaType string, err error) {
+	log.Printf("download(%v)", addr)
+
+	target, err := url.Parse(addr)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") {
+		return nil, "", errors.NewfWith(http.StatusBadRequest, "bad addr=%v", addr)
+	}
+
+	req, err := http.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot set up request")
+	}
+
+	req.Header.Set("User-Agent", "fed/0.x")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", errors.WrapWith(http.StatusBadGateway, err, "cannot reach remote")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.NewfWith(http.StatusBadGateway, "%v returned status=%v", addr, resp.Status)
+	}
+
+	// check the size; the content length might be missing or
+	// lying, so we also limit what we read
+
+	if resp.ContentLength > _MAX_SIZE {
+		return nil, "", errors.NewfWith(http.StatusRequestEntityTooLarge, "%v too large", addr)
+	}
+
+	contents, err = ioutil.ReadAll(io.LimitReader(resp.Body, _MAX_SIZE+1))
+	if err != nil {
+		return nil, "", errors.WrapWith(http.StatusBadGateway, err, "cannot read remote")
+	}
+
+	if len(contents) > _MAX_SIZE {
+		return nil, "", errors.NewfWith(http.StatusRequestEntityTooLarge, "%v too large", addr)
+	}
+
+	// check the type
+
+	if mediaType, err = validate(resp.Header.Get("Content-Type"), contents); err != nil {
+		return nil, "", err
+	}
+
+	return contents, mediaType, nil
+}
+
+// Given the content type claimed by a remote and the contents of the
+// file, return the media type we serve the file as. Returns an error
+// for files that are not images, videos or audio files.
+func validate(claimed string, contents []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(claimed)
+	if err != nil {
+		return "", errors.WrapWith(http.StatusUnsupportedMediaType, err, "bad content type")
+	}
+
+	kind := strings.SplitN(mediaType, "/", 2)[0]
+
+	switch {
+	case mediaType == "image/svg+xml":
+		// svgs can contain scripts
+		return "", errors.NewfWith(http.StatusUnsupportedMediaType, "refusing to proxy type=%v", mediaType)
+
+	case kind == "image":
+		// for images, sniffing is reliable enough to check that
+		// the remote does not lie to us
+
+		if sniffed := http.DetectContentType(contents); !strings.HasPrefix(sniffed, "image/") {
+			return "", errors.NewfWith(http.StatusUnsupportedMediaType, "claimed type=%v but got type=%v", mediaType, sniffed)
+		}
+
+		return mediaType, nil
+
+	case kind == "video" || kind == "audio":
+		return mediaType, nil
+
+	default:
+		return "", errors.NewfWith(http.StatusUnsupportedMediaType, "refusing to proxy type=%v", mediaType)
+	}
+}
+
+// Control function for net.Dialer that refuses connections to
+// addresses that are not on the public internet. Use it for all
+// requests to addresses provided by users or remotes.
+func DialPublicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("bad address=%v", address)
+	}
+
+	if !isPublic(ip) {
+		return fmt.Errorf("refusing to connect to address=%v", address)
+	}
+
+	return nil
+}
+
+// Return whether ip is on the public internet.
+func isPublic(ip net.IP) bool {
+	// IPv4 addresses might come mapped into IPv6, e.g.
+	// ::ffff:169.254.169.254; look at them as what they are
+
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, block := range forbidden {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Parse all CIDRs in cidrs or panic.
+func parseCIDRs(cidrs ...string) (nets []*net.IPNet) {
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err != nil {
+			panic(err)
+		} else {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
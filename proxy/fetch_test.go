@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	public := []string{
+		"93.184.216.34", "1.1.1.1", "2606:4700:4700::1111",
+	}
+
+	for _, addr := range public {
+		if !isPublic(net.ParseIP(addr)) {
+			t.Errorf("addr=%v not public", addr)
+		}
+	}
+
+	internal := []string{
+		"0.0.0.0", "0.1.2.3", "127.0.0.1", "10.1.2.3", "172.16.0.1",
+		"192.168.1.1", "100.64.0.1", "169.254.169.254", "192.0.0.1",
+		"198.18.0.1", "198.19.255.255", "224.0.0.1", "255.255.255.255",
+		"::", "::1", "::ffff:169.254.169.254", "::ffff:127.0.0.1",
+		"::ffff:10.0.0.1", "64:ff9b::a9fe:a9fe", "2002:a9fe:a9fe::1",
+		"fc00::1", "fd12:3456::1", "fe80::1", "ff02::1",
+	}
+
+	for _, addr := range internal {
+		if isPublic(net.ParseIP(addr)) {
+			t.Errorf("addr=%v is public", addr)
+		}
+	}
+}
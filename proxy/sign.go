@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"sync"
+)
+
+// Key used for signing proxy URLs. It is created on first use and
+// only lives as long as the process; links from pages rendered by
+// an earlier run stop working, but those pages are re-rendered
+// anyway.
+var key []byte
+var keyOnce sync.Once
+
+// Return the path on this instance that serves the remote media at
+// target through the proxy.
+//
+// Proxy URLs are signed s.t. the proxy cannot be abused to fetch
+// arbitrary content from anywhere.
+func URL(target *url.URL) string {
+	params := url.Values{}
+	params.Set("url", target.String())
+	params.Set("sig", sign(target.String()))
+
+	return "/proxy/media?" + params.Encode()
+}
+
+// Return whether sig is a valid signature for addr.
+func Verify(addr, sig string) bool {
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	actual, _ := hex.DecodeString(sign(addr))
+	return hmac.Equal(expected, actual)
+}
+
+// Return the hex encoded signature of addr.
+func sign(addr string) string {
+	keyOnce.Do(func() {
+		key = make([]byte, 32)
+
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("could not generate proxy key:", err)
+		}
+	})
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(addr))
+	return hex.EncodeToString(mac.Sum(nil))
+}
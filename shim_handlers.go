@@ -4,13 +4,15 @@ import (
 	"github.com/kissen/fed/util"
 	"log"
 	"net/http"
-	"path"
 )
 
 // GET /shim/ostatus_subscribe?acct={uri}
 //
 // A certain elephant is doing weird things; see
 // https://git.pleroma.social/pleroma/pleroma/issues/286
+//
+// The acct is either the IRI of the remote actor or a handle
+// of the form user@host which we resolve with WebFinger.
 func GetOStatusSubscribe(w http.ResponseWriter, r *http.Request) {
 	log.Println("GetOStatusSubscribe()")
 
@@ -20,6 +22,11 @@ func GetOStatusSubscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	location := path.Join("/remote", acct)
-	http.Redirect(w, r, location, http.StatusFound)
+	iri, err := resolveAddress(acct)
+	if err != nil {
+		ApiError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, remoteLocation(iri), http.StatusFound)
 }
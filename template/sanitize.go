@@ -2,7 +2,9 @@ package template
 
 import (
 	"github.com/microcosm-cc/bluemonday"
+	"html"
 	"html/template"
+	"strings"
 )
 
 // Given a string containing arbitrary HTML, return a sanitized
@@ -11,12 +13,21 @@ func sanitize(html string) string {
 	policy := bluemonday.NewPolicy()
 
 	policy.AllowStandardURLs()
-	policy.AllowAttrs("href").OnElements("a")
-	policy.AllowElements("p")
+	policy.AllowAttrs("href", "rel").OnElements("a")
+	policy.AllowAttrs("class").OnElements("a", "span")
+	policy.AllowElements("p", "br", "span")
 
 	return policy.Sanitize(html)
 }
 
+// Given a string containing HTML, return the plain text it
+// contains. Paragraphs and line breaks are kept as new lines.
+func Plaintext(s string) string {
+	breaks := strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n\n")
+	stripped := bluemonday.StrictPolicy().Sanitize(breaks.Replace(s))
+	return strings.TrimSpace(html.UnescapeString(stripped))
+}
+
 // Sanitize s and return the results as type template.URL.
 func URL(s string) template.URL {
 	sanitized := sanitize(s)
@@ -0,0 +1,160 @@
+package template
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/errors"
+	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// How many objects we look at in each direction when building up
+// a thread. Threads can get long and each object might involve a
+// request over the network.
+const _THREAD_LIMIT = 32
+
+// Write out a page showing the conversation the object at iri
+// is part of.
+//
+// Starting from the object at iri, we walk the inReplyTo chain
+// upwards and the replies collections downwards.
+func Thread(w http.ResponseWriter, r *http.Request, iri *url.URL) {
+	// fetch the object we start from
+
+	focus, err := fetch.Fetch(iri)
+	if err != nil {
+		Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	// build up the whole conversation; lookups in both directions
+	// are best effort, if something fails we just show less
+
+	vs := ancestors(focus)
+	vs = append(vs, focus)
+	vs = append(vs, descendants(focus)...)
+
+	// wrap objects and render
+
+	fc := fedcontext.Context(r)
+	wrapped, err := News(fc, vs...)
+	if err != nil {
+		Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Items": wrapped,
+	}
+
+	fedcontext.Title(r, "Thread")
+	Render(w, r, "res/collection.page.tmpl", data)
+}
+
+// Return the objects obj is replying to, oldest first.
+func ancestors(obj vocab.Type) (vs []vocab.Type) {
+	for len(vs) < _THREAD_LIMIT {
+		parents := prop.IRIs(obj, "inReplyTo")
+		if len(parents) == 0 {
+			break
+		}
+
+		parent, err := fetch.Fetch(parents[0])
+		if err != nil {
+			log.Printf("cannot fetch parent=%v: %v", parents[0], err)
+			break
+		}
+
+		vs = append([]vocab.Type{parent}, vs...)
+		obj = parent
+	}
+
+	return vs
+}
+
+// Return all replies to obj, the replies to those replies and
+// so on in depth-first order.
+func descendants(obj vocab.Type) (vs []vocab.Type) {
+	var visit func(vocab.Type)
+
+	visit = func(parent vocab.Type) {
+		children, err := replies(parent)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		for _, child := range children {
+			if len(vs) >= _THREAD_LIMIT {
+				return
+			}
+
+			vs = append(vs, child)
+			visit(child)
+		}
+	}
+
+	visit(obj)
+	return vs
+}
+
+// Return the direct replies to obj. Only the first page of paged
+// replies collections is considered.
+func replies(obj vocab.Type) ([]vocab.Type, error) {
+	type replier interface {
+		GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	}
+
+	type firster interface {
+		GetActivityStreamsFirst() vocab.ActivityStreamsFirstProperty
+	}
+
+	// get the replies collection
+
+	r, ok := obj.(replier)
+	if !ok || r.GetActivityStreamsReplies() == nil {
+		return nil, nil
+	}
+
+	collection, err := dereference(r.GetActivityStreamsReplies())
+	if err != nil {
+		return nil, errors.Wrap(err, "bad replies collection")
+	}
+
+	// remote collections usually only contain a link to their
+	// first page; we have to look at that one instead
+
+	if f, ok := collection.(firster); ok && f.GetActivityStreamsFirst() != nil {
+		if collection, err = dereference(f.GetActivityStreamsFirst()); err != nil {
+			return nil, errors.Wrap(err, "bad first page of replies")
+		}
+	}
+
+	// load the actual objects
+
+	it, err := fetch.Begin(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetch.FetchIters(it)
+}
+
+// Given a functional property, return the object it contains.
+// If property only contains an IRI, that IRI is dereferenced.
+func dereference(property interface {
+	IsIRI() bool
+	GetIRI() *url.URL
+	GetType() vocab.Type
+}) (vocab.Type, error) {
+	if property.IsIRI() {
+		return fetch.Fetch(property.GetIRI())
+	} else if t := property.GetType(); t != nil {
+		return t, nil
+	} else {
+		return nil, errors.New("property is empty")
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/kissen/fed/db"
 	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
 	"github.com/kissen/fed/fetch"
 	"github.com/kissen/fed/prop"
+	"github.com/kissen/fed/proxy"
+	"github.com/kissen/fed/util"
 	"golang.org/x/sync/errgroup"
 	"html/template"
 	"log"
@@ -91,6 +95,9 @@ func wrap(fc *fedcontext.FedContext, target vocab.Type) (*webVocab, error) {
 	case vocab.ActivityStreamsCreate:
 		page = "res/create.fragment.tmpl"
 
+	case vocab.ActivityStreamsAnnounce:
+		page = "res/announce.fragment.tmpl"
+
 	case vocab.ActivityStreamsPerson:
 		page = "res/person.fragment.tmpl"
 
@@ -191,6 +198,189 @@ func (v *webVocab) Content() template.HTML {
 	return HTML(html)
 }
 
+// Return the summary property.
+func (v *webVocab) Summary() template.HTML {
+	html := v.mapping("summary")
+	return HTML(html)
+}
+
+// Return the content property as plain text, e.g. for filling
+// in a form when editing this object.
+func (v *webVocab) XText() string {
+	return Plaintext(v.mapping("content"))
+}
+
+// A file attached to an object as far as we need it for rendering.
+type Attachment struct {
+	// One of "Image", "Video", "Audio" or "Document".
+	Kind string
+
+	URL       template.URL
+	MediaType string
+	Name      string
+	Width     int
+	Height    int
+	Blurhash  string
+}
+
+// Return the files attached to this object. Attachments without
+// a URL are skipped.
+func (v *webVocab) XAttachments() (as []Attachment) {
+	var entries []interface{}
+
+	switch a := v.mappings["attachment"].(type) {
+	case []interface{}:
+		entries = a
+	case map[string]interface{}:
+		entries = append(entries, a)
+	}
+
+	for _, entry := range entries {
+		mappings, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		addrs := prop.Strings(mappings["url"])
+		if len(addrs) == 0 {
+			continue
+		}
+
+		a := Attachment{
+			URL: proxied(addrs[0]),
+		}
+
+		a.Kind, _ = mappings["type"].(string)
+		a.MediaType, _ = mappings["mediaType"].(string)
+		a.Name, _ = mappings["name"].(string)
+		a.Blurhash, _ = mappings["blurhash"].(string)
+
+		a.Width = number(mappings["width"])
+		a.Height = number(mappings["height"])
+
+		as = append(as, a)
+	}
+
+	return as
+}
+
+// Return the URL of the avatar of this actor. Returns the empty
+// string if there is none.
+func (v *webVocab) XIcon() template.URL {
+	return v.image("icon")
+}
+
+// Return the URL of the header image of this actor. Returns the
+// empty string if there is none.
+func (v *webVocab) XImage() template.URL {
+	return v.image("image")
+}
+
+// A name/value pair shown on the profile of an actor.
+type Field struct {
+	Name  string
+	Value template.HTML
+
+	// Whether the page linked in Value links back to the actor.
+	Verified bool
+}
+
+// Return the profile fields of this actor, that is the PropertyValue
+// entries in the attachment property.
+//
+// Verification is only shown for actors on this instance; remote
+// servers could claim whatever they want.
+func (v *webVocab) XFields() (fs []Field) {
+	local := false
+
+	if id, err := url.Parse(v.mapping("id")); err == nil {
+		local = fediri.IRI{id}.IsLocal()
+	}
+
+	entries, ok := v.mappings["attachment"].([]interface{})
+	if !ok {
+		entries = []interface{}{v.mappings["attachment"]}
+	}
+
+	for _, entry := range entries {
+		mappings, ok := entry.(map[string]interface{})
+		if !ok || mappings["type"] != "PropertyValue" {
+			continue
+		}
+
+		name, _ := mappings["name"].(string)
+		value, _ := mappings["value"].(string)
+
+		_, verified := mappings["verified_at"].(string)
+
+		fs = append(fs, Field{
+			Name:     Plaintext(name),
+			Value:    HTML(value),
+			Verified: local && verified,
+		})
+	}
+
+	return fs
+}
+
+// Return the URL of the image in property key, e.g. the icon of an
+// actor. Returns the empty string if there is none.
+func (v *webVocab) image(key string) template.URL {
+	var image interface{}
+
+	switch i := v.mappings[key].(type) {
+	case []interface{}:
+		if len(i) > 0 {
+			image = i[0]
+		}
+	default:
+		image = i
+	}
+
+	if mappings, ok := image.(map[string]interface{}); ok {
+		image = mappings["url"]
+	}
+
+	if addrs := prop.Strings(image); len(addrs) == 0 {
+		return ""
+	} else {
+		return proxied(addrs[0])
+	}
+}
+
+// Return the URL under which the web interface should load the media
+// at addr. Remote media goes through our proxy s.t. remotes do not
+// learn the addresses of our users.
+func proxied(addr string) template.URL {
+	target, err := url.Parse(addr)
+	if err != nil || target.Host == "" {
+		return ""
+	}
+
+	if (fediri.IRI{target}).IsLocal() {
+		return URL(addr)
+	}
+
+	// we built this URL ourselves and all parameters are escaped;
+	// sanitizing would mangle the query string
+
+	return template.URL(proxy.URL(target))
+}
+
+// Return value as int if it is a number. Numbers are float64 when
+// they come out of JSON, but might also be ints if we built up the
+// mappings ourselves. Returns zero for everything else.
+func number(value interface{}) int {
+	switch n := value.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	default:
+		return 0
+	}
+}
+
 // Return the published timestamp.
 func (v *webVocab) Published() string {
 	if t, err := time.Parse(time.RFC3339, v.mapping("published")); err != nil {
@@ -216,6 +406,22 @@ func (v *webVocab) XIdBase64() string {
 	return base64.StdEncoding.EncodeToString([]byte(v.Id()))
 }
 
+// Return the link to the thread view for this object.
+func (v *webVocab) XThreadURL() template.URL {
+	id, err := url.Parse(v.mapping("id"))
+	if err != nil || id.Host == "" {
+		return ""
+	}
+
+	thread := "/remote/thread/" + id.Host + id.EscapedPath()
+
+	if id.RawQuery != "" {
+		thread += "?" + id.RawQuery
+	}
+
+	return URL(thread)
+}
+
 // If this object is some kind of collection, return the individual
 // items in this collection as wrapped elements.
 func (v *webVocab) XChildren() []*webVocab {
@@ -227,20 +433,106 @@ func (v *webVocab) XChildren() []*webVocab {
 	}
 }
 
+// Returns whether a user is logged in for the current request.
+// Visitors that are not logged in cannot interact with
+// content.
+func (v *webVocab) XLoggedIn() bool {
+	return v.fc.LoggedIn()
+}
+
 // Returns whether the currently logged in user has liked this
 // item.
 func (v *webVocab) XLiked() bool {
-	storage := v.fc.Storage
-	client := v.fc.Client
+	if user := v.user(); user == nil {
+		return false
+	} else {
+		return user.HasLiked(prop.Id(v.target))
+	}
+}
 
-	user, err := storage.RetrieveUser(client.Username())
-	if err != nil {
-		log.Println(err)
+// Returns whether the currently logged in user has repeated this
+// item.
+func (v *webVocab) XRepeated() bool {
+	if user := v.user(); user == nil {
 		return false
+	} else {
+		return user.HasRepeated(prop.Id(v.target))
 	}
+}
 
-	id := prop.Id(v.target)
-	return user.HasLiked(id)
+// Returns whether the currently logged in user is following this
+// actor.
+func (v *webVocab) XFollowing() bool {
+	if user := v.user(); user == nil {
+		return false
+	} else {
+		return user.IsFollowing(prop.Id(v.target))
+	}
+}
+
+// Returns whether the currently logged in user sent a follow request
+// to this actor that was not answered yet.
+func (v *webVocab) XPendingFollow() bool {
+	if user := v.user(); user == nil {
+		return false
+	} else {
+		return user.IsPendingFollowing(prop.Id(v.target))
+	}
+}
+
+// Returns whether this actor is following the currently logged
+// in user.
+func (v *webVocab) XFollowsYou() bool {
+	if user := v.user(); user == nil {
+		return false
+	} else {
+		return user.IsFollowedBy(prop.Id(v.target))
+	}
+}
+
+// Returns whether the currently logged in user blocked this actor.
+func (v *webVocab) XBlocked() bool {
+	if user := v.user(); user == nil {
+		return false
+	} else {
+		return util.UrlIn(prop.Id(v.target), user.BlockedActors)
+	}
+}
+
+// Returns whether the currently logged in user blocked the domain
+// this actor is hosted on.
+func (v *webVocab) XDomainBlocked() bool {
+	if user := v.user(); user == nil {
+		return false
+	} else if id := prop.Id(v.target); id == nil {
+		return false
+	} else {
+		return user.HasBlockedDomain(id.Hostname())
+	}
+}
+
+// Returns the CSRF token forms of the fragment need to carry.
+func (v *webVocab) XCSRF() string {
+	return v.fc.CSRF
+}
+
+// Returns whether this actor is the currently logged in user.
+func (v *webVocab) XIsSelf() bool {
+	if client := v.fc.Client; client == nil {
+		return false
+	} else {
+		return util.UrlEq(client.IRI(), prop.Id(v.target))
+	}
+}
+
+// Returns whether this object was written by the currently logged
+// in user.
+func (v *webVocab) XAuthored() bool {
+	if client := v.fc.Client; client == nil {
+		return false
+	} else {
+		return util.UrlIn(client.IRI(), prop.IRIs(v.target, "attributedTo"))
+	}
 }
 
 func (v *webVocab) XObject() []*webVocab {
@@ -252,6 +544,24 @@ func (v *webVocab) XObject() []*webVocab {
 	}
 }
 
+// Return the metadata of the currently logged in user. Returns nil
+// if nobody is logged in or the lookup failed.
+func (v *webVocab) user() *db.FedUser {
+	client := v.fc.Client
+
+	if client == nil {
+		return nil
+	}
+
+	user, err := v.fc.Storage.RetrieveUser(client.Username())
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return user
+}
+
 func (v *webVocab) mapping(key string) string {
 	if s, ok := v.mappings[key].(string); !ok {
 		return ""
@@ -0,0 +1,118 @@
+package throttle
+
+import (
+	"github.com/kissen/fed/config"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The limiter for all attempts to log in.
+var logins *Limiter
+var loginsOnce sync.Once
+
+// Return the limiter that counts failed logins. It is persisted to
+// the ThrottleFile from the configuration if one is set.
+func Logins() *Limiter {
+	loginsOnce.Do(func() {
+		logins = &Limiter{
+			File: config.Get().ThrottleFile,
+		}
+	})
+
+	return logins
+}
+
+// Check credentials of username sent with r by calling check. Failed
+// attempts are counted both for the address r came from and for
+// username. If there were too many failed attempts recently, check
+// is not called at all and an error with http.StatusTooManyRequests
+// is returned.
+func Login(r *http.Request, username string, check func() error) error {
+	l := Logins()
+
+	ip := AddressKey(r)
+	account := AccountKey(username)
+
+	// the attempt is counted as failed before we check; otherwise
+	// an attacker could send many attempts at once that would all
+	// be checked before the first failure is recorded
+
+	if err := l.Reserve(ip, account); err != nil {
+		log.Printf("throttled login for user=%v from addr=%v", username, ip)
+		return err
+	}
+
+	if err := check(); err != nil {
+		log.Printf("failed login for user=%v from addr=%v", username, ip)
+		l.Flush()
+		return err
+	}
+
+	// we only forget about failures for the account; otherwise an
+	// attacker could reset the counter for their address by logging
+	// into their own account every now and then
+
+	l.Credit(ip)
+	l.Reset(account)
+	return nil
+}
+
+// Like Login, but only failed attempts are recorded. Use this for
+// credentials sent along with every request, e.g. with basic
+// authentication, where counting each request up front would be
+// too expensive. Unlike Login, concurrent attempts may all be
+// checked before the first failure is recorded.
+func Verify(r *http.Request, username string, check func() error) error {
+	l := Logins()
+
+	ip := AddressKey(r)
+	account := AccountKey(username)
+
+	if err := l.Check(ip, account); err != nil {
+		log.Printf("throttled request for user=%v from addr=%v", username, ip)
+		return err
+	}
+
+	if err := check(); err != nil {
+		log.Printf("failed request for user=%v from addr=%v", username, ip)
+		l.Fail(ip, account)
+		return err
+	}
+
+	return nil
+}
+
+// Return the key failed attempts for username are counted under.
+func AccountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// Return the key failed attempts from the address r came from are
+// counted under. If fed runs behind a reverse proxy, configure
+// ClientAddressHeader s.t. we see the actual address of clients.
+func AddressKey(r *http.Request) string {
+	return "ip:" + clientAddress(r)
+}
+
+// Return the address r came from.
+func clientAddress(r *http.Request) string {
+	if header := config.Get().ClientAddressHeader; header != "" {
+		// headers like X-Forwarded-For contain a list of addresses;
+		// the last one was added by our proxy
+
+		fields := strings.Split(r.Header.Get(header), ",")
+
+		if addr := strings.TrimSpace(fields[len(fields)-1]); addr != "" {
+			return addr
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
@@ -0,0 +1,379 @@
+package throttle
+
+import (
+	"encoding/json"
+	"github.com/kissen/fed/errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of failed attempts that are not delayed at all. Everyone
+// mistypes their password from time to time.
+const _FREE_ATTEMPTS = 3
+
+// Delay after the first failed attempt that is not free. The delay
+// doubles with each further failed attempt.
+const _BASE_DELAY = time.Second
+
+// Number of failed attempts after which a key is locked out.
+const _LOCKOUT_ATTEMPTS = 10
+
+// How long a key that is locked out stays locked out. Each failed
+// attempt during a lockout is rejected without being counted.
+const _LOCKOUT_DURATION = 15 * time.Minute
+
+// Failed attempts are forgotten after this long without any new
+// failed attempt.
+const _FORGET_AFTER = 24 * time.Hour
+
+// Changes that are not failed attempts, e.g. credits for successful
+// attempts, are written to File at most this often.
+const _SAVE_INTERVAL = time.Minute
+
+// What we remember about failed attempts for some key, e.g. an
+// address or an account.
+type Entry struct {
+	// The key the attempts were made for, e.g. "ip:192.0.2.1" or
+	// "user:alice".
+	Key string
+
+	// Number of failed attempts.
+	Failures int
+
+	// When the most recent failed attempt was made.
+	LastFailure time.Time
+
+	// Until when no attempts are accepted at all. Zero if the key
+	// is not locked out.
+	LockedUntil time.Time
+}
+
+// Counts failed attempts per key. Once there were too many failed
+// attempts for a key, further attempts are delayed exponentially
+// and eventually the key is locked out for some time.
+//
+// Entries are kept in memory. If File is set, they are also
+// written to that file s.t. they survive a restart. Failed attempts
+// are written right away, everything else only every now and then.
+type Limiter struct {
+	File string
+
+	lock sync.Mutex
+
+	// All entries by key. Nil until loaded.
+	entries map[string]*Entry
+
+	// Whether entries changed since they were last written to File.
+	dirty bool
+
+	// When entries were last written to File.
+	saved time.Time
+
+	// Returns the current time. Nil means time.Now.
+	now func() time.Time
+}
+
+// Return an error if any of keys may not make an attempt right now.
+// The error carries http.StatusTooManyRequests.
+func (l *Limiter) Check(keys ...string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+	return l.check(l.clock(), keys)
+}
+
+// Like Check, but if the attempt may be made, it is counted as failed
+// right away. Call Credit if the attempt turns out to be successful.
+//
+// Checking and counting happen at once s.t. concurrent attempts
+// cannot all pass the check before any of them is counted.
+func (l *Limiter) Reserve(keys ...string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+	now := l.clock()
+
+	if err := l.check(now, keys); err != nil {
+		return err
+	}
+
+	l.prune(now)
+
+	for _, key := range keys {
+		l.fail(now, key)
+	}
+
+	// most reservations are credited right away, so there is no
+	// need to write them out yet
+
+	l.changed(now, false)
+	return nil
+}
+
+// Take back the failed attempt counted for each of keys by Reserve.
+func (l *Limiter) Credit(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+
+	for _, key := range keys {
+		e, ok := l.entries[key]
+		if !ok {
+			continue
+		}
+
+		// while a key is locked out, Reserve does not let anyone
+		// through, so a lockout can only be the one our own
+		// reservation caused
+
+		e.Failures -= 1
+		e.LockedUntil = time.Time{}
+
+		if e.Failures <= 0 {
+			delete(l.entries, key)
+		}
+	}
+
+	l.changed(l.clock(), false)
+}
+
+// Return an error if any of keys may not make an attempt at time now.
+func (l *Limiter) check(now time.Time, keys []string) error {
+	var wait time.Duration
+
+	for _, key := range keys {
+		if e, ok := l.entries[key]; ok {
+			if w := e.wait(now); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait > 0 {
+		wait = wait.Round(time.Second) + time.Second
+		return errors.NewfWith(http.StatusTooManyRequests, "too many failed attempts, try again in %v", wait)
+	}
+
+	return nil
+}
+
+// Record a failed attempt for each of keys.
+func (l *Limiter) Fail(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+	now := l.clock()
+
+	l.prune(now)
+
+	for _, key := range keys {
+		l.fail(now, key)
+	}
+
+	l.changed(now, true)
+}
+
+// Count a failed attempt for key at time now. Attempts during a
+// lockout are not counted.
+func (l *Limiter) fail(now time.Time, key string) {
+	e, ok := l.entries[key]
+	if !ok {
+		e = &Entry{Key: key}
+		l.entries[key] = e
+	}
+
+	if now.Before(e.LockedUntil) {
+		return
+	}
+
+	e.Failures += 1
+	e.LastFailure = now
+
+	if e.Failures >= _LOCKOUT_ATTEMPTS {
+		e.LockedUntil = now.Add(_LOCKOUT_DURATION)
+		log.Printf("locked out key=%v after failures=%v until=%v", key, e.Failures, e.LockedUntil)
+	}
+}
+
+// Forget all failed attempts for key, e.g. after a successful
+// attempt. Returns whether there were any.
+func (l *Limiter) Reset(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+
+	if _, ok := l.entries[key]; !ok {
+		return false
+	}
+
+	delete(l.entries, key)
+	l.changed(l.clock(), false)
+
+	return true
+}
+
+// Write all changes to File right away, e.g. after an attempt
+// reserved with Reserve failed.
+func (l *Limiter) Flush() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+	l.flush(l.clock(), true)
+}
+
+// Return all keys with failed attempts that are not forgotten yet,
+// most recent failed attempt first.
+func (l *Limiter) Entries() []Entry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.load()
+	l.prune(l.clock())
+
+	var es []Entry
+
+	for _, e := range l.entries {
+		es = append(es, *e)
+	}
+
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].LastFailure.After(es[j].LastFailure)
+	})
+
+	return es
+}
+
+// Return how long the holder of e has to wait until it may make
+// another attempt at time now.
+func (e *Entry) wait(now time.Time) time.Duration {
+	if now.Before(e.LockedUntil) {
+		return e.LockedUntil.Sub(now)
+	}
+
+	// after a lockout there is one more attempt; if it fails,
+	// the key is locked out again
+
+	if e.Failures < _FREE_ATTEMPTS || e.Failures >= _LOCKOUT_ATTEMPTS {
+		return 0
+	}
+
+	delay := _BASE_DELAY << uint(e.Failures-_FREE_ATTEMPTS)
+	return e.LastFailure.Add(delay).Sub(now)
+}
+
+// Return the current time.
+func (l *Limiter) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+
+	return time.Now()
+}
+
+// Remove entries that are neither locked out nor had a failed
+// attempt in a long time. Otherwise the entries would grow without
+// bounds.
+func (l *Limiter) prune(now time.Time) {
+	for key, e := range l.entries {
+		if now.After(e.LockedUntil) && now.Sub(e.LastFailure) > _FORGET_AFTER {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Load the entries from File if they were not loaded yet. If File
+// cannot be read, we start out without entries.
+func (l *Limiter) load() {
+	if l.entries != nil {
+		return
+	}
+
+	l.entries = make(map[string]*Entry)
+
+	if l.File == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(l.File)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Printf("cannot read throttle file=%v: %v", l.File, err)
+		return
+	}
+
+	var es []*Entry
+
+	if err := json.Unmarshal(data, &es); err != nil {
+		log.Printf("cannot parse throttle file=%v: %v", l.File, err)
+		return
+	}
+
+	for _, e := range es {
+		l.entries[e.Key] = e
+	}
+}
+
+// Remember that entries changed at time now. They are written to
+// File right away if force is set or the last write was long enough
+// ago; otherwise they are written with some later change.
+func (l *Limiter) changed(now time.Time, force bool) {
+	l.dirty = true
+	l.flush(now, force)
+}
+
+// Write the entries to File if they changed since the last write
+// and either force is set or the last write was long enough ago.
+func (l *Limiter) flush(now time.Time, force bool) {
+	if !l.dirty || (!force && now.Sub(l.saved) < _SAVE_INTERVAL) {
+		return
+	}
+
+	l.save()
+	l.dirty = false
+	l.saved = now
+}
+
+// Write the entries to File if it is set.
+func (l *Limiter) save() {
+	if l.File == "" {
+		return
+	}
+
+	var es []*Entry
+
+	for _, e := range l.entries {
+		es = append(es, e)
+	}
+
+	data, err := json.Marshal(es)
+	if err != nil {
+		log.Printf("cannot encode throttle entries: %v", err)
+		return
+	}
+
+	// write to a temporary file first s.t. we never end up with a
+	// half written file
+
+	tmp := l.File + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("cannot write throttle file=%v: %v", tmp, err)
+		return
+	}
+
+	if err := os.Rename(tmp, l.File); err != nil {
+		log.Printf("cannot write throttle file=%v: %v", l.File, err)
+	}
+}
@@ -0,0 +1,211 @@
+package throttle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLimiter(now *time.Time) *Limiter {
+	return &Limiter{
+		now: func() time.Time { return *now },
+	}
+}
+
+func TestLimiterDelays(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := testLimiter(&now)
+
+	for i := 0; i < _FREE_ATTEMPTS; i++ {
+		if err := l.Check("user:alice"); err != nil {
+			t.Fatalf("attempt=%v throttled err=%v", i, err)
+		}
+
+		l.Fail("user:alice")
+	}
+
+	if err := l.Check("user:alice"); err == nil {
+		t.Fatalf("expected delay after free attempts")
+	}
+
+	if err := l.Check("user:bob"); err != nil {
+		t.Fatalf("other key throttled err=%v", err)
+	}
+
+	now = now.Add(_BASE_DELAY)
+
+	if err := l.Check("user:alice"); err != nil {
+		t.Fatalf("still throttled after delay err=%v", err)
+	}
+
+	l.Fail("user:alice")
+	now = now.Add(_BASE_DELAY)
+
+	if err := l.Check("user:alice"); err == nil {
+		t.Fatalf("expected delay to double")
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := testLimiter(&now)
+
+	for i := 0; i < _LOCKOUT_ATTEMPTS; i++ {
+		l.Fail("ip:192.0.2.1")
+		now = now.Add(time.Hour)
+	}
+
+	now = now.Add(-time.Hour)
+
+	if err := l.Check("user:alice", "ip:192.0.2.1"); err == nil {
+		t.Fatalf("expected lockout")
+	}
+
+	now = now.Add(_LOCKOUT_DURATION)
+
+	if err := l.Check("ip:192.0.2.1"); err != nil {
+		t.Fatalf("still locked out err=%v", err)
+	}
+
+	l.Fail("ip:192.0.2.1")
+
+	if err := l.Check("ip:192.0.2.1"); err == nil {
+		t.Fatalf("expected lockout after another failure")
+	}
+
+	if !l.Reset("ip:192.0.2.1") {
+		t.Fatalf("reset found no entry")
+	}
+
+	if err := l.Check("ip:192.0.2.1"); err != nil {
+		t.Fatalf("locked out after reset err=%v", err)
+	}
+}
+
+func TestLimiterPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fed-throttle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+
+	l := testLimiter(&now)
+	l.File = filepath.Join(dir, "throttle.json")
+
+	for i := 0; i < _LOCKOUT_ATTEMPTS; i++ {
+		l.Fail("user:alice")
+	}
+
+	restarted := testLimiter(&now)
+	restarted.File = l.File
+
+	if err := restarted.Check("user:alice"); err == nil {
+		t.Fatalf("lockout did not survive restart")
+	}
+
+	if es := restarted.Entries(); len(es) != 1 || es[0].Key != "user:alice" {
+		t.Fatalf("got entries=%v", es)
+	}
+}
+
+func TestLimiterReserveConcurrent(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := testLimiter(&now)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+
+	passed := 0
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := l.Reserve("ip:192.0.2.1", "user:alice"); err == nil {
+				lock.Lock()
+				passed += 1
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if passed != _FREE_ATTEMPTS {
+		t.Fatalf("expected attempts=%v to pass but got passed=%v", _FREE_ATTEMPTS, passed)
+	}
+}
+
+func TestLimiterCredit(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := testLimiter(&now)
+
+	for i := 0; i < _LOCKOUT_ATTEMPTS-1; i++ {
+		l.Fail("ip:192.0.2.1")
+	}
+
+	now = now.Add(time.Hour)
+
+	if err := l.Reserve("ip:192.0.2.1"); err != nil {
+		t.Fatalf("reserve failed err=%v", err)
+	}
+
+	if err := l.Check("ip:192.0.2.1"); err == nil {
+		t.Fatalf("expected lockout after reservation")
+	}
+
+	l.Credit("ip:192.0.2.1")
+
+	es := l.Entries()
+
+	if len(es) != 1 || es[0].Failures != _LOCKOUT_ATTEMPTS-1 || !es[0].LockedUntil.IsZero() {
+		t.Fatalf("got entries=%v", es)
+	}
+}
+
+func TestLimiterFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fed-throttle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+
+	l := testLimiter(&now)
+	l.File = filepath.Join(dir, "throttle.json")
+
+	// the first change is written, later ones wait for the
+	// interval to pass
+
+	l.Fail("user:alice")
+
+	if err := l.Reserve("user:bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := testLimiter(&now)
+	restarted.File = l.File
+
+	if es := restarted.Entries(); len(es) != 1 || es[0].Key != "user:alice" {
+		t.Fatalf("got entries=%v", es)
+	}
+
+	l.Flush()
+
+	restarted = testLimiter(&now)
+	restarted.File = l.File
+
+	if es := restarted.Entries(); len(es) != 2 {
+		t.Fatalf("got entries=%v after flush", es)
+	}
+}
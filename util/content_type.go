@@ -1,6 +1,9 @@
 package util
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 // Return the content type requested (GET) or povided (POST)
 // by request r.
@@ -19,3 +22,18 @@ func ContentType(r *http.Request) string {
 		return ""
 	}
 }
+
+// Return whether request r asks for an ActivityPub document. Other
+// software on the fediverse does not always send exactly AP_TYPE,
+// so we also accept the other common ActivityStreams types.
+func WantsActivityPub(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+
+	for _, t := range []string{"application/activity+json", "application/ld+json"} {
+		if strings.Contains(accept, t) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,12 @@
+package util
+
+// Return a copy of haystack with all occurrences of needle removed.
+func StringsRemove(needle string, haystack []string) (filtered []string) {
+	for _, hay := range haystack {
+		if hay != needle {
+			filtered = append(filtered, hay)
+		}
+	}
+
+	return filtered
+}
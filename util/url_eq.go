@@ -52,3 +52,27 @@ func UrlInAny(needle *url.URL, haystacks [][]*url.URL) bool {
 
 	return false
 }
+
+// Return a copy of haystack with all URLs that we consider equal
+// to needle removed.
+func UrlRemove(needle *url.URL, haystack []*url.URL) (filtered []*url.URL) {
+	for _, hay := range haystack {
+		if !UrlEq(hay, needle) {
+			filtered = append(filtered, hay)
+		}
+	}
+
+	return filtered
+}
+
+// Return a copy of haystack with all URLs that we consider equal
+// to any of the URLs in needles removed.
+func UrlsRemove(needles []*url.URL, haystack []*url.URL) (filtered []*url.URL) {
+	for _, hay := range haystack {
+		if !UrlIn(hay, needles) {
+			filtered = append(filtered, hay)
+		}
+	}
+
+	return filtered
+}
@@ -1,24 +1,44 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/gorilla/mux"
+	"github.com/kissen/fed/compose"
+	"github.com/kissen/fed/config"
 	"github.com/kissen/fed/db"
+	"github.com/kissen/fed/errors"
 	"github.com/kissen/fed/fedcontext"
+	"github.com/kissen/fed/fediri"
+	"github.com/kissen/fed/fetch"
+	"github.com/kissen/fed/prop"
 	"github.com/kissen/fed/template"
 	"github.com/kissen/fed/util"
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 	"time"
 )
 
+// The maximum length of notes submitted via the web interface.
+const _MAX_NOTE_LENGTH = 1024
+
 // GET /
 func WebGetIndex(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebGetIndex(%v)", r.URL)
-	WebGetStream(w, r)
+
+	// visitors that are not logged in do not have a stream; show
+	// them what is going on on this instance instead
+
+	if fedcontext.Context(r).Client == nil {
+		WebGetLocal(w, r)
+	} else {
+		WebGetStream(w, r)
+	}
 }
 
 // GET /stream
@@ -48,6 +68,109 @@ func WebGetStream(w http.ResponseWriter, r *http.Request) {
 	template.Iter(w, r, stream)
 }
 
+// GET /local
+func WebGetLocal(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetLocal(%v)", r.URL)
+
+	fedcontext.Title(r, "Local Timeline")
+	fedcontext.Selected(r, "Local")
+
+	storage := fedcontext.Context(r).Storage
+
+	timeline, err := fedcontext.LocalTimeline(storage)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	template.Iter(w, r, timeline)
+}
+
+// GET /federated
+func WebGetFederated(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetFederated(%v)", r.URL)
+
+	fedcontext.Title(r, "Federated Timeline")
+	fedcontext.Selected(r, "Federated")
+
+	storage := fedcontext.Context(r).Storage
+
+	timeline, err := fedcontext.FederatedTimeline(storage)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	template.Iter(w, r, timeline)
+}
+
+// GET /tags/{tag}
+func WebGetTag(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetTag(%v)", r.URL)
+
+	tag := mux.Vars(r)["tag"]
+	fedcontext.Title(r, "#"+tag)
+
+	storage := fedcontext.Context(r).Storage
+
+	timeline, err := fedcontext.TagTimeline(storage, tag)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	template.Iter(w, r, timeline)
+}
+
+// GET /{username}
+func WebGetUser(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetUser(%v)", r.URL)
+
+	// not every ActivityPub client sends exactly the Accept header
+	// we route on; make sure they still get an ActivityPub document
+
+	if util.WantsActivityPub(r) {
+		ApGetPostActivity(w, r)
+		return
+	}
+
+	// look up the user
+
+	username := mux.Vars(r)["username"]
+	storage := fedcontext.Context(r).Storage
+
+	if _, err := storage.RetrieveUser(username); err != nil {
+		template.Error(w, r, http.StatusNotFound, err, nil)
+		return
+	}
+
+	fedcontext.Title(r, username)
+
+	// the profile page starts with the actor and is followed by
+	// everything they posted publicly
+
+	actor, err := fetch.Fetch(fediri.ActorIRI(username).URL())
+	if err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	timeline, err := fedcontext.UserTimeline(storage, username)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	posts, err := fetch.FetchIters(timeline)
+	if err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	items := append([]vocab.Type{actor}, posts...)
+	template.Iter(w, r, fetch.Slice(items))
+}
+
 // GET /liked
 func WebGetLiked(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebGetLiked(%v)", r.URL)
@@ -72,7 +195,16 @@ func WebGetFollowing(w http.ResponseWriter, r *http.Request) {
 	fedcontext.Title(r, "Following")
 	fedcontext.Selected(r, "Following")
 
-	template.Error(w, r, http.StatusNotImplemented, nil, nil)
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	// show both accepted and pending follows; the cards show
+	// which is which
+
+	actors := append(user.Following, user.PendingFollowing...)
+	template.Iter(w, r, fetchActors(actors))
 }
 
 // GET /followers
@@ -82,42 +214,64 @@ func WebGetFollowers(w http.ResponseWriter, r *http.Request) {
 	fedcontext.Title(r, "Followers")
 	fedcontext.Selected(r, "Followers")
 
-	template.Error(w, r, http.StatusNotImplemented, nil, nil)
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	template.Iter(w, r, fetchActors(user.Followers))
+}
+
+// GET /search?q={query}
+//
+// Query can either be an IRI or a handle of the form @user@host.
+// In both cases, we show the actor (or object) found.
+func WebGetSearch(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetSearch(%v)", r.URL)
+
+	query, ok := util.FormValue(r, "q")
+	if !ok {
+		fedcontext.FlashWarning(r, "missing search query")
+		fedcontext.Redirect(w, r, "/")
+		return
+	}
+
+	iri, err := resolveAddress(query)
+	if err != nil {
+		template.Error(w, r, http.StatusNotFound, err, nil)
+		return
+	}
+
+	fedcontext.Title(r, query)
+	template.Remote(w, r, iri)
 }
 
 // GET /remote/{remote_path}
 func WebGetRemote(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebGetRemote(%v)", r.URL)
 
-	// get and sanitize iri
-
-	query := mux.Vars(r)["remote_path"]
-
-	iri, err := url.Parse(query)
+	iri, err := remoteIri(r)
 	if err != nil {
 		template.Error(w, r, http.StatusBadRequest, err, nil)
 		return
 	}
 
-	iri.Path = strings.TrimLeft(iri.Path, "/")
-
-	// re-add query params for the remote if there were any
+	// let our friend Remote take care of it
 
-	s := iri.String()
+	template.Remote(w, r, iri)
+}
 
-	for key, value := range r.URL.Query() {
-		s += fmt.Sprintf("?%v=%v", key, value[0])
-	}
+// GET /remote/thread/{remote_path}
+func WebGetRemoteThread(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetRemoteThread(%v)", r.URL)
 
-	iri, err = url.Parse(s)
+	iri, err := remoteIri(r)
 	if err != nil {
-		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		template.Error(w, r, http.StatusBadRequest, err, nil)
 		return
 	}
 
-	// let our friend Remote take care of it
-
-	template.Remote(w, r, iri)
+	template.Thread(w, r, iri)
 }
 
 // GET /login
@@ -132,10 +286,15 @@ func WebGetLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// we are not logged in; show the login form
+	// we are not logged in; show the login form or, if the
+	// password was already checked, ask for the second factor
+
+	data := map[string]interface{}{
+		"SecondFactor": fedcontext.Context(r).PendingLogin.Valid(),
+	}
 
 	fedcontext.Title(r, "Login")
-	template.Render(w, r, "res/login.page.tmpl", nil)
+	template.Render(w, r, "res/login.page.tmpl", data)
 }
 
 // POST /login
@@ -143,33 +302,29 @@ func WebPostLogin(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebPostLogin(%v)", r.URL)
 	context := fedcontext.Context(r)
 
-	// check whether we have valid input
-	username, ok := util.FormValue(r, "username")
-	if !ok {
-		fedcontext.FlashWarning(r, "missing username")
-		fedcontext.Status(r, http.StatusBadRequest)
+	// check credentials; users with a second factor need
+	// to submit the form twice
+	user, secondStep, err := checkLogin(r)
+	if err != nil {
+		fedcontext.FlashWarning(r, err.Error())
+		fedcontext.Status(r, statusOf(err, http.StatusUnauthorized))
 		WebGetLogin(w, r)
 		return
 	}
-	password, ok := util.FormValue(r, "password")
-	if !ok {
-		fedcontext.FlashWarning(r, "missing password")
-		fedcontext.Status(r, http.StatusBadRequest)
+	if secondStep {
 		WebGetLogin(w, r)
 		return
 	}
 
-	// try to create a session with the supplied credentials
-	tm, err := db.NewFedOAuthToken(username, password, context.Storage)
+	// create a session for the user
+	tm, err := db.NewFedOAuthSession(user.Name, fedcontext.PasswordScope(user.Name), context.Storage)
 	if err != nil {
-		fedcontext.FlashWarning(r, err.Error())
-		fedcontext.Status(r, http.StatusUnauthorized)
-		WebGetLogin(w, r)
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
 		return
 	}
 
 	// success; set context and write cookie for later
-	context.Token = &tm.Token
+	context.NewSession(&tm.Token)
 
 	// we are just logged on; forward to stream page for now
 	fedcontext.Flash(r, "successfully logged in")
@@ -180,9 +335,17 @@ func WebPostLogin(w http.ResponseWriter, r *http.Request) {
 func WebPostLogout(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebPostLogout()")
 
-	// remove credentials and client from context
+	// revoke the session and remove credentials and client
+	// from context
 	context := fedcontext.Context(r)
-	context.Token = nil
+
+	if context.Token != nil {
+		if err := context.Storage.DeleteToken(*context.Token); err != nil {
+			log.Printf("revoking token on logout failed: %v", err)
+		}
+	}
+
+	context.NewSession(nil)
 
 	// redirect to login page
 	fedcontext.Flash(r, "logged out")
@@ -205,9 +368,9 @@ func WebPostSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(payload) > 1024 {
-		StatusPayloadTooLarge := 413
-		template.Error(w, r, StatusPayloadTooLarge, nil, nil)
+	if len(payload) > _MAX_NOTE_LENGTH {
+		template.Error(w, r, http.StatusRequestEntityTooLarge, nil, nil)
+		return
 	}
 
 	// retreive the client session
@@ -219,25 +382,22 @@ func WebPostSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// build up the note
-
-	note := streams.NewActivityStreamsNote()
-
-	attrib := streams.NewActivityStreamsAttributedToProperty()
-	attrib.AppendIRI(client.IRI())
-	note.SetActivityStreamsAttributedTo(attrib)
+	// post it to the server
 
-	content := streams.NewActivityStreamsContentProperty()
-	content.AppendXMLSchemaString(payload)
-	note.SetActivityStreamsContent(content)
+	visibility, err := fedcontext.ParseVisibility(r.FormValue("visibility"))
+	if err != nil {
+		template.Error(w, r, http.StatusBadRequest, err, nil)
+		return
+	}
 
-	published := streams.NewActivityStreamsPublishedProperty()
-	published.Set(time.Now())
-	note.SetActivityStreamsPublished(published)
+	note := newNote(client, payload)
 
-	// post it to the server
+	if err := attachUpload(r, client, note); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
 
-	if err := client.Create(note); err != nil {
+	if _, err := client.Create(note, visibility); err != nil {
 		template.Error(w, r, http.StatusBadGateway, err, nil)
 		return
 	}
@@ -249,20 +409,86 @@ func WebPostSubmit(w http.ResponseWriter, r *http.Request) {
 }
 
 // POST /reply
+//
+// Without postinput, shows a form for replying to the object
+// at iri_base64. With postinput, submits the reply.
 func WebPostReply(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebPostReply()")
-	template.Error(w, r, http.StatusNotImplemented, nil, nil)
+
+	iri, done := getIri(w, r)
+	if done {
+		return
+	}
+
+	client := fedcontext.Context(r).Client
+	if client == nil {
+		fedcontext.FlashWarning(r, "authorization requried")
+		fedcontext.Redirect(w, r, "/login")
+		return
+	}
+
+	// if there is no content yet, show the compose page
+
+	payload, ok := util.FormValue(r, "postinput")
+	if !ok {
+		webGetReply(w, r, iri)
+		return
+	}
+
+	if len(payload) > _MAX_NOTE_LENGTH {
+		template.Error(w, r, http.StatusRequestEntityTooLarge, nil, nil)
+		return
+	}
+
+	// post the reply
+
+	visibility, err := fedcontext.ParseVisibility(r.FormValue("visibility"))
+	if err != nil {
+		template.Error(w, r, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	if _, err := client.Reply(iri, newNote(client, payload), visibility); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "replied")
+	fedcontext.Redirect(w, r, "/")
 }
 
-// POST /repeat
-func WebPostRepeat(w http.ResponseWriter, r *http.Request) {
-	log.Printf("WebPostRepeat()")
-	template.Error(w, r, http.StatusNotImplemented, nil, nil)
+// Write out the page for composing a reply to the object at parent.
+// The parent is looked up with the permissions of the logged in
+// client.
+func webGetReply(w http.ResponseWriter, r *http.Request, parent *url.URL) {
+	fc := fedcontext.Context(r)
+
+	obj, err := fc.Client.Get(parent)
+	if err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	wrapped, err := template.New(fc, obj)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Parent": wrapped,
+	}
+
+	fedcontext.Title(r, "Reply")
+	template.Render(w, r, "res/reply.page.tmpl", data)
 }
 
-// POST /like
-func WebPostLike(w http.ResponseWriter, r *http.Request) {
-	log.Printf("WebPostLike()")
+// POST /edit
+//
+// Without postinput, shows a form for editing the object at
+// iri_base64. With postinput, submits the edited version.
+func WebPostEdit(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostEdit()")
 
 	iri, done := getIri(w, r)
 	if done {
@@ -271,40 +497,904 @@ func WebPostLike(w http.ResponseWriter, r *http.Request) {
 
 	client := fedcontext.Context(r).Client
 	if client == nil {
-		template.Error(w, r, http.StatusUnauthorized, nil, nil)
+		fedcontext.FlashWarning(r, "authorization requried")
+		fedcontext.Redirect(w, r, "/login")
 		return
 	}
 
-	if err := client.Like(iri); err != nil {
+	// if there is no content yet, show the edit page
+
+	payload, ok := util.FormValue(r, "postinput")
+	if !ok {
+		webGetEdit(w, r, iri)
+		return
+	}
+
+	if len(payload) > _MAX_NOTE_LENGTH {
+		template.Error(w, r, http.StatusRequestEntityTooLarge, nil, nil)
+		return
+	}
+
+	// submit the new version
+
+	if err := client.Edit(iri, newNote(client, payload)); err != nil {
 		template.Error(w, r, http.StatusBadGateway, err, nil)
 		return
 	}
 
-	fedcontext.Flash(r, "liked")
+	fedcontext.Flash(r, "edited")
 	fedcontext.Redirect(w, r, "/")
 }
 
-// Try to get the iri_base64 form value from POST request r.
-// If it is missing or malformed, this functions writes out
-// and error and returns (nil, true).
-func getIri(w http.ResponseWriter, r *http.Request) (iri *url.URL, handled bool) {
-	payload64, ok := util.FormValue(r, "iri_base64")
-	if !ok {
-		template.Error(w, r, http.StatusBadRequest, nil, nil)
-		return nil, true
+// Write out the page for editing the object at iri.
+func webGetEdit(w http.ResponseWriter, r *http.Request, iri *url.URL) {
+	wrapped, err := template.Fetch(fedcontext.Context(r), iri)
+	if err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
 	}
 
-	payload, err := util.DecodeBase64ToString(payload64)
-	if err != nil {
-		template.Error(w, r, http.StatusBadRequest, err, nil)
-		return nil, true
+	data := map[string]interface{}{
+		"Original": wrapped,
 	}
 
-	iri, err = url.Parse(payload)
-	if err != nil {
-		template.Error(w, r, http.StatusBadRequest, err, nil)
-		return nil, true
+	fedcontext.Title(r, "Edit")
+	template.Render(w, r, "res/edit.page.tmpl", data)
+}
+
+// POST /delete
+//
+// Deletes the object at iri_base64. Only objects written by
+// the logged in user can be deleted.
+func WebPostDelete(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostDelete()")
+
+	iri, done := getIri(w, r)
+	if done {
+		return
 	}
 
-	return iri, false
+	client := fedcontext.Context(r).Client
+	if client == nil {
+		fedcontext.FlashWarning(r, "authorization required")
+		fedcontext.Redirect(w, r, "/login")
+		return
+	}
+
+	if err := client.Delete(iri); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "deleted")
+	fedcontext.Redirect(w, r, "/")
+}
+
+// POST /repeat
+//
+// Repeats the object at iri_base64. If the object was already
+// repeated, the repeat is undone.
+func WebPostRepeat(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostRepeat()")
+
+	iri, done := getIri(w, r)
+	if done {
+		return
+	}
+
+	context := fedcontext.Context(r)
+
+	client := context.Client
+	if client == nil {
+		fedcontext.FlashWarning(r, "authorization required")
+		fedcontext.Redirect(w, r, "/login")
+		return
+	}
+
+	user, err := context.Storage.RetrieveUser(client.Username())
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	if user.HasRepeated(iri) {
+		if err := client.Unrepeat(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "no longer repeated")
+	} else {
+		if err := client.Repeat(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "repeated")
+	}
+
+	fedcontext.Redirect(w, r, "/")
+}
+
+// POST /follow
+//
+// Follows the actor at iri_base64. If we are already following the
+// actor or a request is pending, we unfollow instead.
+func WebPostFollow(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostFollow()")
+
+	iri, done := getIri(w, r)
+	if done {
+		return
+	}
+
+	client := fedcontext.Context(r).Client
+	if client == nil {
+		fedcontext.FlashWarning(r, "authorization required")
+		fedcontext.Redirect(w, r, "/login")
+		return
+	}
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	if user.IsFollowing(iri) || user.IsPendingFollowing(iri) {
+		if err := client.Unfollow(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "unfollowed")
+	} else {
+		if err := client.Follow(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "follow request sent")
+	}
+
+	fedcontext.Redirect(w, r, "/following")
+}
+
+// POST /block
+//
+// Blocks the actor at iri_base64. If the form value domain is set,
+// the whole domain that actor is hosted on is blocked instead. Blocks
+// that are already in place are undone.
+func WebPostBlock(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostBlock()")
+
+	iri, done := getIri(w, r)
+	if done {
+		return
+	}
+
+	client := fedcontext.Context(r).Client
+	if client == nil {
+		fedcontext.FlashWarning(r, "authorization required")
+		fedcontext.Redirect(w, r, "/login")
+		return
+	}
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	// domain blocks are private to our instance, there is no
+	// activity we could submit; just update storage
+
+	if _, ok := util.FormValue(r, "domain"); ok {
+		domain := db.NormalizeDomain(iri.Hostname())
+
+		if user.HasBlockedDomain(domain) {
+			user.BlockedDomains = util.StringsRemove(domain, user.BlockedDomains)
+			fedcontext.Flash(r, "unblocked domain")
+		} else {
+			user.BlockedDomains = append(user.BlockedDomains, domain)
+			fedcontext.Flash(r, "blocked domain")
+		}
+
+		if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+			template.Error(w, r, http.StatusInternalServerError, err, nil)
+			return
+		}
+
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	// actor blocks go through the outbox
+
+	if util.UrlIn(iri, user.BlockedActors) {
+		if err := client.Unblock(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "unblocked")
+	} else {
+		if err := client.Block(iri); err != nil {
+			template.Error(w, r, http.StatusBadGateway, err, nil)
+			return
+		}
+
+		fedcontext.Flash(r, "blocked")
+	}
+
+	fedcontext.Redirect(w, r, "/")
+}
+
+// GET /settings
+//
+// Shows the profile, mutes, domain blocks and sessions of the logged
+// in user.
+func WebGetSettings(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebGetSettings(%v)", r.URL)
+
+	fedcontext.Title(r, "Settings")
+	fedcontext.Selected(r, "Settings")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	// the unblock forms need something that looks like an IRI
+	// on the blocked domain
+
+	var domains []map[string]string
+
+	for _, domain := range user.BlockedDomains {
+		iri := "https://" + domain + "/"
+
+		domains = append(domains, map[string]string{
+			"Domain":    domain,
+			"IriBase64": base64.StdEncoding.EncodeToString([]byte(iri)),
+		})
+	}
+
+	// always show the same number of rows for profile fields,
+	// empty ones can be filled in
+
+	fields := make([]db.FedProfileField, db.MAX_PROFILE_FIELDS)
+
+	for i, field := range user.Profile.Fields {
+		if i < len(fields) {
+			fields[i] = *field
+		}
+	}
+
+	sessions, err := sessionsOf(r, user)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Profile":        user.Profile,
+		"Summary":        template.Plaintext(user.Profile.Summary),
+		"Fields":         fields,
+		"Mutes":          user.ActiveMutes(),
+		"BlockedDomains": domains,
+		"Sessions":       sessions,
+		"TOTP":           user.TOTP,
+	}
+
+	if user.TOTP != nil && !user.TOTP.Confirmed {
+		data["TOTPURI"] = user.TOTP.URI(config.Get().Hostname, user.Name)
+	}
+
+	template.Render(w, r, "res/settings.page.tmpl", data)
+}
+
+// POST /settings/profile
+//
+// Updates the profile of the logged in user. Form values display_name
+// and summary hold the new display name and biography, field_name_N
+// and field_value_N the profile fields. Optional files icon and image
+// replace the avatar and the header image.
+func WebPostProfile(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostProfile()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	client := fedcontext.Context(r).Client
+	profile := user.Profile
+
+	profile.DisplayName = strings.TrimSpace(r.FormValue("display_name"))
+
+	if summary := strings.TrimSpace(r.FormValue("summary")); len(summary) > _MAX_NOTE_LENGTH {
+		template.Error(w, r, http.StatusRequestEntityTooLarge, nil, nil)
+		return
+	} else if summary == "" {
+		profile.Summary = ""
+	} else {
+		profile.Summary = newComposer().Compose(summary).Content
+	}
+
+	profile.Fields = nil
+
+	for i := 0; i < db.MAX_PROFILE_FIELDS; i++ {
+		name := r.FormValue(fmt.Sprintf("field_name_%d", i))
+		value := r.FormValue(fmt.Sprintf("field_value_%d", i))
+
+		if field := db.NewFedProfileField(name, value); field != nil {
+			profile.Fields = append(profile.Fields, field)
+		}
+	}
+
+	// images are only replaced if a new file was picked
+
+	if icon, err := uploadImage(r, client, "icon"); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	} else if icon != nil {
+		profile.Icon = icon
+	}
+
+	if image, err := uploadImage(r, client, "image"); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	} else if image != nil {
+		profile.Image = image
+	}
+
+	if err := client.UpdateProfile(&profile); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "profile updated")
+	fedcontext.Redirect(w, r, "/settings")
+}
+
+// POST /settings/mute
+//
+// Adds a mute for the logged in user. Form value kind is one of
+// keyword, actor or thread; value is the keyword or IRI (or handle)
+// to mute. Optional form value duration limits how long the mute
+// is applied.
+func WebPostMute(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostMute()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	kind, err := db.ParseMuteKind(r.FormValue("kind"))
+	if err != nil {
+		template.Error(w, r, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	value, ok := util.FormValue(r, "value")
+	if !ok {
+		fedcontext.FlashWarning(r, "nothing to mute")
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	var duration time.Duration
+
+	if d, ok := util.FormValue(r, "duration"); ok {
+		if duration, err = time.ParseDuration(d); err != nil {
+			template.Error(w, r, http.StatusBadRequest, err, nil)
+			return
+		}
+	}
+
+	// actors and threads are matched by IRI; allow for handles
+	// as well
+
+	if kind == db.MUTE_ACTOR || kind == db.MUTE_THREAD {
+		iri, err := resolveAddress(value)
+		if err != nil {
+			template.Error(w, r, http.StatusBadRequest, err, nil)
+			return
+		}
+
+		value = iri.String()
+	}
+
+	// drop expired mutes while we are at it
+
+	user.Mutes = append(user.ActiveMutes(), db.NewFedMute(kind, value, duration))
+
+	if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "muted")
+	fedcontext.Redirect(w, r, "/settings")
+}
+
+// POST /settings/unmute
+//
+// Removes the mute with form value id from the logged in user.
+func WebPostUnmute(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostUnmute()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	id, ok := util.FormValue(r, "id")
+	if !ok {
+		template.Error(w, r, http.StatusBadRequest, nil, nil)
+		return
+	}
+
+	user.RemoveMute(id)
+
+	if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "unmuted")
+	fedcontext.Redirect(w, r, "/settings")
+}
+
+// POST /settings/revoke
+//
+// Ends the session with form value id of the logged in user. Tokens
+// of that session stop working immediately.
+func WebPostRevoke(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostRevoke()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	id, ok := util.FormValue(r, "id")
+	if !ok {
+		template.Error(w, r, http.StatusBadRequest, nil, nil)
+		return
+	}
+
+	context := fedcontext.Context(r)
+
+	sessions, err := db.RetrieveSessions(user.Name, context.Storage)
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	for _, session := range sessions {
+		if session.Id != id {
+			continue
+		}
+
+		if err := context.Storage.DeleteToken(session.Token); err != nil {
+			template.Error(w, r, http.StatusInternalServerError, err, nil)
+			return
+		}
+
+		// revoking the current session is the same as logging out
+
+		if context.Token != nil && *context.Token == session.Token {
+			context.NewSession(nil)
+
+			fedcontext.Flash(r, "logged out")
+			fedcontext.Redirect(w, r, "/login")
+			return
+		}
+
+		fedcontext.Flash(r, "session revoked")
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	template.Error(w, r, http.StatusNotFound, nil, nil)
+}
+
+// POST /settings/totp
+//
+// Starts setting up two-factor authentication for the logged in user.
+// The second factor is only required once it was confirmed with
+// /settings/totp/confirm.
+func WebPostTOTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostTOTP()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	if user.SecondFactorRequired() {
+		fedcontext.FlashWarning(r, "two-factor authentication is already enabled")
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	user.TOTP = db.NewFedTOTP()
+
+	if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "enter the secret shown below into your authenticator app, then enter a code to confirm")
+	fedcontext.Redirect(w, r, "/settings")
+}
+
+// POST /settings/totp/confirm
+//
+// Finishes setting up two-factor authentication. Form value otp
+// needs to be a current code from the authenticator app. Shows the
+// recovery codes.
+func WebPostConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostConfirmTOTP()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	if user.TOTP == nil || user.TOTP.Confirmed {
+		template.Error(w, r, http.StatusBadRequest, nil, nil)
+		return
+	}
+
+	verify := func(code string) bool {
+		return user.TOTP.Verify(code, time.Now())
+	}
+
+	if err := checkOTP(r, user, verify); err != nil {
+		fedcontext.FlashWarning(r, err.Error())
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	user.TOTP.Confirmed = true
+	webShowRecoveryCodes(w, r, user)
+}
+
+// POST /settings/totp/recovery
+//
+// Replaces the recovery codes of the logged in user with new ones.
+// Form value otp needs to be a current code or a recovery code.
+func WebPostRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostRecoveryCodes()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	if !user.SecondFactorRequired() {
+		fedcontext.FlashWarning(r, "bad code")
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	if err := checkOTP(r, user, user.CheckSecondFactor); err != nil {
+		fedcontext.FlashWarning(r, err.Error())
+		fedcontext.Redirect(w, r, "/settings")
+		return
+	}
+
+	webShowRecoveryCodes(w, r, user)
+}
+
+// POST /settings/totp/disable
+//
+// Turns off two-factor authentication for the logged in user. Form
+// value otp needs to be a current code or a recovery code.
+func WebPostDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostDisableTOTP()")
+
+	user, done := getUser(w, r)
+	if done {
+		return
+	}
+
+	if user.SecondFactorRequired() {
+		if err := checkOTP(r, user, user.CheckSecondFactor); err != nil {
+			fedcontext.FlashWarning(r, err.Error())
+			fedcontext.Redirect(w, r, "/settings")
+			return
+		}
+	}
+
+	user.TOTP = nil
+
+	if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "two-factor authentication disabled")
+	fedcontext.Redirect(w, r, "/settings")
+}
+
+// Give user new recovery codes and show them. The codes are only
+// kept as hashes, so this is the only time they can be shown.
+func webShowRecoveryCodes(w http.ResponseWriter, r *http.Request, user *db.FedUser) {
+	codes := user.TOTP.NewRecoveryCodes()
+
+	if err := fedcontext.Context(r).Storage.StoreUser(user); err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"RecoveryCodes": codes,
+	}
+
+	fedcontext.Title(r, "Recovery Codes")
+	fedcontext.Selected(r, "Settings")
+	template.Render(w, r, "res/recovery.page.tmpl", data)
+}
+
+// POST /like
+func WebPostLike(w http.ResponseWriter, r *http.Request) {
+	log.Printf("WebPostLike()")
+
+	iri, done := getIri(w, r)
+	if done {
+		return
+	}
+
+	client := fedcontext.Context(r).Client
+	if client == nil {
+		template.Error(w, r, http.StatusUnauthorized, nil, nil)
+		return
+	}
+
+	if err := client.Like(iri); err != nil {
+		template.Error(w, r, http.StatusBadGateway, err, nil)
+		return
+	}
+
+	fedcontext.Flash(r, "liked")
+	fedcontext.Redirect(w, r, "/")
+}
+
+// Return the active sessions of user prepared for rendering on the
+// settings page.
+func sessionsOf(r *http.Request, user *db.FedUser) (sessions []map[string]interface{}, err error) {
+	context := fedcontext.Context(r)
+
+	tokens, err := db.RetrieveSessions(user.Name, context.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		application := "Web interface"
+
+		if token.ClientId != "" {
+			if client, err := context.Storage.RetrieveClient(token.ClientId); err != nil {
+				application = "Unknown application"
+			} else {
+				application = client.Name
+			}
+		}
+
+		sessions = append(sessions, map[string]interface{}{
+			"Id":          token.Id,
+			"Application": application,
+			"Scopes":      token.Scope.Scopes(),
+			"CreatedOn":   token.CreatedOn,
+			"Current":     context.Token != nil && *context.Token == token.Token,
+		})
+	}
+
+	return sessions, nil
+}
+
+// Try to get the iri_base64 form value from POST request r.
+// If it is missing or malformed, this functions writes out
+// and error and returns (nil, true).
+func getIri(w http.ResponseWriter, r *http.Request) (iri *url.URL, handled bool) {
+	payload64, ok := util.FormValue(r, "iri_base64")
+	if !ok {
+		template.Error(w, r, http.StatusBadRequest, nil, nil)
+		return nil, true
+	}
+
+	payload, err := util.DecodeBase64ToString(payload64)
+	if err != nil {
+		template.Error(w, r, http.StatusBadRequest, err, nil)
+		return nil, true
+	}
+
+	iri, err = url.Parse(payload)
+	if err != nil {
+		template.Error(w, r, http.StatusBadRequest, err, nil)
+		return nil, true
+	}
+
+	return iri, false
+}
+
+// Try to get the metadata of the currently logged in user. If nobody
+// is logged in, this function redirects to the login page and returns
+// (nil, true).
+func getUser(w http.ResponseWriter, r *http.Request) (user *db.FedUser, handled bool) {
+	context := fedcontext.Context(r)
+
+	if context.Client == nil {
+		fedcontext.FlashWarning(r, "authorization requried")
+		fedcontext.Redirect(w, r, "/login")
+		return nil, true
+	}
+
+	user, err := context.Storage.RetrieveUser(context.Client.Username())
+	if err != nil {
+		template.Error(w, r, http.StatusInternalServerError, err, nil)
+		return nil, true
+	}
+
+	return user, false
+}
+
+// Return an iterator over the actors at iris. Actors that cannot
+// be fetched are skipped.
+func fetchActors(iris []*url.URL) fetch.Iter {
+	var actors []vocab.Type
+
+	for _, iri := range iris {
+		if actor, err := fetch.Fetch(iri); err != nil {
+			log.Printf("skipping actor=%v: %v", iri, err)
+		} else {
+			actors = append(actors, actor)
+		}
+	}
+
+	return fetch.Slice(actors)
+}
+
+// Given addr which is either an IRI or a handle of the form
+// @user@host, return the IRI it refers to.
+func resolveAddress(addr string) (*url.URL, error) {
+	if strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "http://") {
+		return url.Parse(addr)
+	} else {
+		return fetch.WebFinger(addr)
+	}
+}
+
+// Return the path of the page in the web interface that shows
+// the remote object at iri.
+func remoteLocation(iri *url.URL) string {
+	location := path.Join("/remote", iri.Host, iri.EscapedPath())
+
+	if iri.RawQuery != "" {
+		location += "?" + iri.RawQuery
+	}
+
+	return location
+}
+
+// Build up a new note with content payload, written by the user
+// of client. Payload is plain text as entered by the user; mentions,
+// hashtags and links are converted to HTML.
+func newNote(client fedcontext.FedClient, payload string) vocab.ActivityStreamsNote {
+	note := streams.NewActivityStreamsNote()
+
+	attrib := streams.NewActivityStreamsAttributedToProperty()
+	attrib.AppendIRI(client.IRI())
+	note.SetActivityStreamsAttributedTo(attrib)
+
+	published := streams.NewActivityStreamsPublishedProperty()
+	published.Set(time.Now())
+	note.SetActivityStreamsPublished(published)
+
+	newComposer().Compose(payload).Apply(note)
+
+	return note
+}
+
+// Return the composer that turns text entered in the web interface
+// into HTML.
+func newComposer() *compose.Composer {
+	return &compose.Composer{
+		Resolve: fetch.WebFinger,
+		TagIRI: func(tag string) *url.URL {
+			return fediri.TagIRI(tag).URL()
+		},
+	}
+}
+
+// If the form in r contains a file in field attachment, upload it
+// with client and attach it to note. The alt text is taken from field
+// attachment_name.
+func attachUpload(r *http.Request, client fedcontext.FedClient, note vocab.ActivityStreamsNote) error {
+	file, header, err := r.FormFile("attachment")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "bad attachment")
+	}
+
+	defer file.Close()
+
+	attachment, err := client.Upload(file, header.Filename, r.FormValue("attachment_name"))
+	if err != nil {
+		return errors.Wrap(err, "upload failed")
+	}
+
+	property := streams.NewActivityStreamsAttachmentProperty()
+	if err := property.AppendType(attachment); err != nil {
+		return errors.Wrap(err, "cannot attach upload")
+	}
+
+	note.SetActivityStreamsAttachment(property)
+	return nil
+}
+
+// If the form in r contains a file in field, upload it with client
+// and return the URL it is served under. Returns (nil, nil) if there
+// is no such file. Only images are accepted.
+func uploadImage(r *http.Request, client fedcontext.FedClient, field string) (*url.URL, error) {
+	file, header, err := r.FormFile(field)
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "bad file in field=%v", field)
+	}
+
+	defer file.Close()
+
+	upload, err := client.Upload(file, header.Filename, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "upload failed")
+	}
+
+	if _, ok := upload.(vocab.ActivityStreamsImage); !ok {
+		return nil, errors.NewfWith(http.StatusBadRequest, "file in field=%v is not an image", field)
+	}
+
+	if addrs := prop.IRIs(upload, "url"); len(addrs) == 0 {
+		return nil, errors.New("upload has no url")
+	} else {
+		return addrs[0], nil
+	}
+}
+
+// Return the remote IRI encoded in the remote_path variable of
+// request r. The scheme may be omitted in which case we assume
+// https. Query parameters of r are passed on to the remote.
+func remoteIri(r *http.Request) (*url.URL, error) {
+	path := mux.Vars(r)["remote_path"]
+
+	// the router cleans up the path, so "https://" might
+	// have turned into "https:/"
+
+	scheme := "https"
+
+	for _, candidate := range []string{"https", "http"} {
+		prefix := candidate + ":/"
+
+		if strings.HasPrefix(path, prefix) {
+			scheme = candidate
+			path = strings.TrimPrefix(path, prefix)
+			break
+		}
+	}
+
+	path = strings.TrimLeft(path, "/")
+
+	// re-add query params for the remote if there were any
+
+	s := fmt.Sprintf("%v://%v", scheme, path)
+
+	if query := r.URL.RawQuery; query != "" {
+		s += "?" + query
+	}
+
+	return url.Parse(s)
 }